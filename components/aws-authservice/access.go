@@ -0,0 +1,351 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Files read from the access policy directory, one list entry per line.
+// They match the keys of the aws-authservice-access-policy ConfigMap.
+const (
+	denyEmailsFile   = "denyEmails"
+	denyDomainsFile  = "denyDomains"
+	denyGroupsFile   = "denyGroups"
+	allowEmailsFile  = "allowEmails"
+	allowDomainsFile = "allowDomains"
+	allowGroupsFile  = "allowGroups"
+	adminEmailsFile  = "adminEmails"
+	adminGroupsFile  = "adminGroups"
+)
+
+// adminHeader is set on every allowed request so that a value sent by the client is overwritten
+const adminHeader = "kubeflow-admin"
+
+// AccessPolicy holds the allow, deny and admin lists. Emails and domains are matched case-insensitively.
+type AccessPolicy struct {
+	DenyEmails   map[string]bool
+	DenyDomains  map[string]bool
+	DenyGroups   map[string]bool
+	AllowEmails  map[string]bool
+	AllowDomains map[string]bool
+	AllowGroups  map[string]bool
+	AdminEmails  map[string]bool
+	AdminGroups  map[string]bool
+}
+
+// Identity is the user an ALB authenticated request belongs to
+type Identity struct {
+	Email  string
+	Groups []string
+}
+
+func (i Identity) domain() string {
+	if at := strings.LastIndex(i.Email, "@"); at >= 0 {
+		return i.Email[at+1:]
+	}
+	return ""
+}
+
+// Decision is the outcome of evaluating an AccessPolicy for an Identity
+type Decision struct {
+	Allowed bool
+	Admin   bool
+	Reason  string
+}
+
+// decide evaluates the lists in order: deny, admin, allow. Deny always wins, admins bypass the
+// allow lists, and when no allow list is configured every identity that is not denied is allowed.
+func (p *AccessPolicy) decide(id Identity) Decision {
+	if p == nil {
+		return Decision{Allowed: true}
+	}
+	email := strings.ToLower(id.Email)
+	domain := strings.ToLower(id.domain())
+
+	if p.DenyEmails[email] {
+		return Decision{Reason: "email is on the deny list"}
+	}
+	if domain != "" && p.DenyDomains[domain] {
+		return Decision{Reason: fmt.Sprintf("domain %s is on the deny list", domain)}
+	}
+	for _, g := range id.Groups {
+		if p.DenyGroups[g] {
+			return Decision{Reason: fmt.Sprintf("group %s is on the deny list", g)}
+		}
+	}
+
+	if email != "" && p.AdminEmails[email] {
+		return Decision{Allowed: true, Admin: true, Reason: "email is on the admin list"}
+	}
+	for _, g := range id.Groups {
+		if p.AdminGroups[g] {
+			return Decision{Allowed: true, Admin: true, Reason: fmt.Sprintf("group %s is on the admin list", g)}
+		}
+	}
+
+	if len(p.AllowEmails) == 0 && len(p.AllowDomains) == 0 && len(p.AllowGroups) == 0 {
+		return Decision{Allowed: true}
+	}
+	if email != "" && p.AllowEmails[email] {
+		return Decision{Allowed: true}
+	}
+	if domain != "" && p.AllowDomains[domain] {
+		return Decision{Allowed: true}
+	}
+	for _, g := range id.Groups {
+		if p.AllowGroups[g] {
+			return Decision{Allowed: true}
+		}
+	}
+	if email == "" {
+		return Decision{Reason: "request has no identity and allow lists are configured"}
+	}
+	return Decision{Reason: "identity is not on any allow list"}
+}
+
+// loadAccessPolicy reads the lists from dir. Missing files are treated as empty lists.
+func loadAccessPolicy(dir string) (*AccessPolicy, error) {
+	p := &AccessPolicy{}
+	lists := []struct {
+		file       string
+		target     *map[string]bool
+		ignoreCase bool
+	}{
+		{denyEmailsFile, &p.DenyEmails, true},
+		{denyDomainsFile, &p.DenyDomains, true},
+		{denyGroupsFile, &p.DenyGroups, false},
+		{allowEmailsFile, &p.AllowEmails, true},
+		{allowDomainsFile, &p.AllowDomains, true},
+		{allowGroupsFile, &p.AllowGroups, false},
+		{adminEmailsFile, &p.AdminEmails, true},
+		{adminGroupsFile, &p.AdminGroups, false},
+	}
+	for _, l := range lists {
+		entries, err := readList(filepath.Join(dir, l.file), l.ignoreCase)
+		if err != nil {
+			return nil, err
+		}
+		*l.target = entries
+	}
+	return p, nil
+}
+
+// readList parses a file with one entry per line. Blank lines and lines starting with # are ignored.
+func readList(path string, ignoreCase bool) (map[string]bool, error) {
+	entries := map[string]bool{}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if ignoreCase {
+			line = strings.ToLower(line)
+		}
+		entries[line] = true
+	}
+	return entries, scanner.Err()
+}
+
+// accessPolicyWatcher reloads the access policy when the content of its directory changes.
+// Kubernetes updates mounted ConfigMaps in place, so polling picks up edits without a restart.
+type accessPolicyWatcher struct {
+	dir         string
+	policy      atomic.Value
+	fingerprint string
+}
+
+func newAccessPolicyWatcher(dir string) (*accessPolicyWatcher, error) {
+	w := &accessPolicyWatcher{dir: dir}
+	if err := w.reload(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Policy returns the most recently loaded access policy
+func (w *accessPolicyWatcher) Policy() *AccessPolicy {
+	if w == nil {
+		return nil
+	}
+	return w.policy.Load().(*AccessPolicy)
+}
+
+// reload loads the policy if the directory content changed since the last load
+func (w *accessPolicyWatcher) reload() error {
+	fingerprint, err := dirFingerprint(w.dir)
+	if err != nil {
+		return err
+	}
+	if fingerprint == w.fingerprint {
+		return nil
+	}
+	p, err := loadAccessPolicy(w.dir)
+	if err != nil {
+		return err
+	}
+	w.policy.Store(p)
+	w.fingerprint = fingerprint
+	log.Printf("Loaded access policy from %s", w.dir)
+	return nil
+}
+
+// watch reloads the policy every interval. A policy that fails to load keeps the previous one active.
+func (w *accessPolicyWatcher) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := w.reload(); err != nil {
+			log.Printf("Failed to reload access policy, keeping the previous one: %v", err)
+		}
+	}
+}
+
+// dirFingerprint hashes the names and contents of the list files in dir
+func dirFingerprint(dir string) (string, error) {
+	h := sha256.New()
+	for _, name := range []string{denyEmailsFile, denyDomainsFile, denyGroupsFile, allowEmailsFile,
+		allowDomainsFile, allowGroupsFile, adminEmailsFile, adminGroupsFile} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", name, len(data))
+		h.Write(data)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// identityFromRequest extracts the user from the headers added by the ALB. The email is read from
+// the x-amzn-oidc-data claims, groups from the groups claim of both tokens, once each.
+// Like the kubeflow-userid EnvoyFilter, this trusts the headers because the ingress gateway only
+// receives traffic through the ALB, which overwrites them.
+func identityFromRequest(r *http.Request, groupsClaim string) Identity {
+	id := Identity{}
+	if claims, err := jwtClaims(r.Header.Get("x-amzn-oidc-data")); err == nil {
+		if email, ok := claims["email"].(string); ok {
+			id.Email = email
+		}
+		id.Groups = append(id.Groups, stringsClaim(claims[groupsClaim])...)
+	}
+	if claims, err := jwtClaims(r.Header.Get("x-amzn-oidc-accesstoken")); err == nil {
+		id.Groups = append(id.Groups, stringsClaim(claims[groupsClaim])...)
+	}
+	id.Groups = uniqueStrings(id.Groups)
+	return id
+}
+
+// uniqueStrings returns the strings without repetitions, in the order of their first occurrence
+func uniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	for _, s := range values {
+		if !seen[s] {
+			seen[s] = true
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// jwtClaims decodes the payload of a JWT without verifying its signature. The tokens must come
+// from the x-amzn-oidc-* headers, which the ALB sets after it authenticated the user and verified
+// the tokens of the identity provider, and which it overwrites when a client sends them. Don't
+// pass tokens from other sources, they can be forged.
+func jwtClaims(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed JWT")
+	}
+	// ALB pads its tokens, Cognito does not
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, err
+	}
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// stringsClaim converts a claim that is either a list of strings or a single string
+func stringsClaim(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var result []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// auditRecord is logged as a single JSON line for every denied request
+type auditRecord struct {
+	Time   time.Time `json:"time"`
+	Event  string    `json:"event"`
+	Email  string    `json:"email"`
+	Groups []string  `json:"groups,omitempty"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	Reason string    `json:"reason"`
+}
+
+func auditDeny(r *http.Request, id Identity, reason string) {
+	record := auditRecord{
+		Time:   time.Now().UTC(),
+		Event:  "access-denied",
+		Email:  id.Email,
+		Groups: id.Groups,
+		Method: r.Method,
+		Path:   strings.TrimPrefix(r.URL.Path, authorizePathPrefix),
+		Reason: reason,
+	}
+	jsonBytes, err := json.Marshal(record)
+	if err != nil {
+		log.Printf("Failed to marshal audit record: %v", err)
+		return
+	}
+	log.Printf("AUDIT %s", jsonBytes)
+}
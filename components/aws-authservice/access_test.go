@@ -0,0 +1,185 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func set(entries ...string) map[string]bool {
+	m := map[string]bool{}
+	for _, e := range entries {
+		m[e] = true
+	}
+	return m
+}
+
+func TestAccessPolicyDecide(t *testing.T) {
+	policy := &AccessPolicy{
+		DenyEmails:   set("offboarded@example.com"),
+		DenyDomains:  set("blocked.com"),
+		DenyGroups:   set("suspended"),
+		AllowEmails:  set("guest@other.com"),
+		AllowDomains: set("example.com"),
+		AllowGroups:  set("data-science"),
+		AdminEmails:  set("root@other.com", "offboarded@example.com"),
+		AdminGroups:  set("platform", "suspended"),
+	}
+	testCases := []struct {
+		name     string
+		policy   *AccessPolicy
+		identity Identity
+		allowed  bool
+		admin    bool
+	}{
+		{name: "no policy", policy: nil, identity: Identity{Email: "anyone@anywhere.com"}, allowed: true},
+		{name: "no lists", policy: &AccessPolicy{}, identity: Identity{Email: "anyone@anywhere.com"}, allowed: true},
+		{name: "allowed domain", policy: policy, identity: Identity{Email: "user@example.com"}, allowed: true},
+		{name: "allowed domain in another case", policy: policy, identity: Identity{Email: "User@EXAMPLE.com"}, allowed: true},
+		{name: "allowed email", policy: policy, identity: Identity{Email: "guest@other.com"}, allowed: true},
+		{name: "allowed group", policy: policy, identity: Identity{Email: "user@other.com", Groups: []string{"data-science"}}, allowed: true},
+		{name: "not on an allow list", policy: policy, identity: Identity{Email: "user@other.com"}},
+		{name: "no identity", policy: policy, identity: Identity{}},
+		{name: "admin email bypasses the allow lists", policy: policy, identity: Identity{Email: "root@other.com"}, allowed: true, admin: true},
+		{name: "admin group", policy: policy, identity: Identity{Email: "user@example.com", Groups: []string{"platform"}}, allowed: true, admin: true},
+		{name: "denied email wins over admin", policy: policy, identity: Identity{Email: "offboarded@example.com"}},
+		{name: "denied group wins over admin", policy: policy, identity: Identity{Email: "user@example.com", Groups: []string{"platform", "suspended"}}},
+		{name: "denied domain wins over allow", policy: &AccessPolicy{DenyDomains: set("example.com"), AllowEmails: set("user@example.com")}, identity: Identity{Email: "user@example.com"}},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			d := c.policy.decide(c.identity)
+			if d.Allowed != c.allowed || d.Admin != c.admin {
+				t.Errorf("got allowed %v, admin %v (%q); want allowed %v, admin %v", d.Allowed, d.Admin, d.Reason, c.allowed, c.admin)
+			}
+			if !d.Allowed && d.Reason == "" {
+				t.Errorf("got a denial without a reason")
+			}
+		})
+	}
+}
+
+// fakeJWT returns an unsigned token with the claims, in the format of the x-amzn-oidc-* headers
+func fakeJWT(t *testing.T, claims map[string]interface{}) string {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "e30." + base64.RawURLEncoding.EncodeToString(payload) + ".signature"
+}
+
+func TestIdentityFromRequest(t *testing.T) {
+	testCases := []struct {
+		name         string
+		dataGroups   interface{}
+		accessGroups interface{}
+		groups       []string
+	}{
+		{name: "no groups"},
+		{name: "groups of the access token", accessGroups: []string{"platform", "data-science"}, groups: []string{"platform", "data-science"}},
+		{name: "single group", dataGroups: "platform", groups: []string{"platform"}},
+		{name: "group in both tokens", dataGroups: []string{"platform"}, accessGroups: []string{"data-science", "platform"}, groups: []string{"platform", "data-science"}},
+		{name: "repeated group", accessGroups: []string{"platform", "platform"}, groups: []string{"platform"}},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, authorizePathPrefix+"/notebooks", nil)
+			r.Header.Set("x-amzn-oidc-data", fakeJWT(t, map[string]interface{}{"email": "user@example.com", defaultGroupsClaim: c.dataGroups}))
+			r.Header.Set("x-amzn-oidc-accesstoken", fakeJWT(t, map[string]interface{}{defaultGroupsClaim: c.accessGroups}))
+
+			id := identityFromRequest(r, defaultGroupsClaim)
+			if id.Email != "user@example.com" {
+				t.Errorf("got email %q; want user@example.com", id.Email)
+			}
+			if !reflect.DeepEqual(id.Groups, c.groups) {
+				t.Errorf("got groups %q; want %q", id.Groups, c.groups)
+			}
+		})
+	}
+}
+
+func TestAuthorizeHandlerAccessPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "access-policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		denyEmailsFile:   "# offboarded\noffboarded@example.com\n",
+		adminGroupsFile:  "platform\n",
+		allowDomainsFile: "example.com\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	watcher, err := newAccessPolicyWatcher(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(p *accessPolicyWatcher, s SessionPolicy) { accessPolicy, sessionPolicy = p, s }(accessPolicy, sessionPolicy)
+	accessPolicy, sessionPolicy = watcher, SessionPolicy{}
+
+	testCases := []struct {
+		name   string
+		email  string
+		groups []string
+		status int
+		admin  string
+	}{
+		{name: "admin", email: "admin@example.com", groups: []string{"platform"}, status: http.StatusOK, admin: "true"},
+		{name: "user", email: "user@example.com", status: http.StatusOK, admin: "false"},
+		{name: "denied", email: "offboarded@example.com", groups: []string{"platform"}, status: http.StatusForbidden},
+		{name: "not allowed", email: "user@other.com", status: http.StatusForbidden},
+	}
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, authorizePathPrefix+"/notebooks", nil)
+			r.Header.Set("x-amzn-oidc-data", fakeJWT(t, map[string]interface{}{"email": c.email}))
+			r.Header.Set("x-amzn-oidc-accesstoken", fakeJWT(t, map[string]interface{}{defaultGroupsClaim: c.groups}))
+			// A value sent by the client must never reach the upstream
+			r.Header.Set(adminHeader, "true")
+			w := httptest.NewRecorder()
+			AuthorizeHandler(w, r)
+
+			if w.Code != c.status {
+				t.Errorf("got status %v; want %v", w.Code, c.status)
+			}
+			if admin := w.Header().Get(adminHeader); admin != c.admin {
+				t.Errorf("got %v header %q; want %q", adminHeader, admin, c.admin)
+			}
+		})
+	}
+
+	// An edit of the mounted ConfigMap is picked up by the next reload
+	if err := ioutil.WriteFile(filepath.Join(dir, adminGroupsFile), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := watcher.reload(); err != nil {
+		t.Fatal(err)
+	}
+	if d := watcher.Policy().decide(Identity{Email: "admin@example.com", Groups: []string{"platform"}}); !d.Allowed || d.Admin {
+		t.Errorf("got allowed %v, admin %v after removing the admin group; want allowed, not admin", d.Allowed, d.Admin)
+	}
+}
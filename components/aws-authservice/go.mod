@@ -1,4 +1,4 @@
-module main
+module github.com/awslabs/kubeflow-manifests/components/aws-authservice
 
 go 1.17
 
@@ -20,30 +20,164 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 )
 
+// There are 4 possible AWSELBAuthSessionCookies
+// https://docs.aws.amazon.com/elasticloadbalancing/latest/application/listener-authenticate-users.html#authentication-logout
+const albCookieShards = 4
+
+// Default retention of session records matches the default ALB SessionTimeout of 7 days
+const defaultSessionRetention = 7 * 24 * time.Hour
+
+// Default maximum number of sessions kept by the memory session store
+const defaultSessionStoreSize = 100000
+
+// Envoy ext_authz appends the original request path to this prefix
+const authorizePathPrefix = "/authservice/authorize"
+
+// Cognito puts the groups of a user in the cognito:groups claim of the access token
+const defaultGroupsClaim = "cognito:groups"
+
+const accessPolicyReloadInterval = 10 * time.Second
+
 var port string
 var redirectURL string
+var sessionPolicy SessionPolicy
+var sessionStore SessionStore
+var groupsClaim string
+var accessPolicy *accessPolicyWatcher
 
 func init() {
 	port = "8082"
 	redirectURL = os.Getenv("LOGOUT_URL")
 
+	sessionPolicy = SessionPolicy{
+		IdleTimeout: durationFromEnv("SESSION_IDLE_TIMEOUT", 0),
+		MaxLifetime: durationFromEnv("SESSION_MAX_LIFETIME", 0),
+		Retention:   durationFromEnv("SESSION_RETENTION", defaultSessionRetention),
+	}
+	var err error
+	sessionStore, err = newSessionStore(os.Getenv("SESSION_STORE"), intFromEnv("SESSION_STORE_SIZE", defaultSessionStoreSize))
+	if err != nil {
+		log.Fatalf("Failed to create session store: %v", err)
+	}
+
+	groupsClaim = os.Getenv("GROUPS_CLAIM")
+	if groupsClaim == "" {
+		groupsClaim = defaultGroupsClaim
+	}
+	if dir := os.Getenv("ACCESS_POLICY_DIR"); dir != "" {
+		accessPolicy, err = newAccessPolicyWatcher(dir)
+		if err != nil {
+			log.Fatalf("Failed to load access policy: %v", err)
+		}
+	}
+}
+
+// durationFromEnv parses the environment variable key as a time.Duration, e.g. "30m".
+// An unset or empty variable yields def.
+func durationFromEnv(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.Fatalf("Invalid duration %q for %s", value, key)
+	}
+	return d
+}
+
+// intFromEnv parses the environment variable key as a positive integer.
+// An unset or empty variable yields def.
+func intFromEnv(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil || i <= 0 {
+		log.Fatalf("Invalid number %q for %s", value, key)
+	}
+	return i
+}
+
+func albCookieName(cookieIndex int) string {
+	return fmt.Sprintf("AWSELBAuthSessionCookie-%s", strconv.Itoa(cookieIndex))
+}
+
+// expireALBCookies instructs the browser to drop every ALB session cookie
+func expireALBCookies(w http.ResponseWriter) {
+	for cookieIndex := 0; cookieIndex < albCookieShards; cookieIndex++ {
+		expireALBCookie := &http.Cookie{Value: "Expired", Name: albCookieName(cookieIndex), MaxAge: -1, Path: "/"}
+		http.SetCookie(w, expireALBCookie)
+	}
+}
+
+// AuthorizeHandler is the Envoy ext_authz check for requests authenticated by the ALB.
+// It responds with 403 when the user is denied by the access policy, and marks allowed
+// requests of admins with the kubeflow-admin header. It also records the activity of the
+// ALB session and responds with 401 and expired ALB cookies once the session exceeds the
+// idle timeout or maximum lifetime, which makes the ALB re-authenticate the user on the
+// next request.
+func AuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	identity := identityFromRequest(r, groupsClaim)
+	decision := accessPolicy.Policy().decide(identity)
+	if !decision.Allowed {
+		auditDeny(r, identity, decision.Reason)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	w.Header().Set(adminHeader, strconv.FormatBool(decision.Admin))
+
+	if !sessionPolicy.Enabled() {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	id := sessionID(r)
+	if id == "" {
+		// Nothing to track, authentication is left to the ALB
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	reason, err := sessionPolicy.check(sessionStore, id, time.Now())
+	if err != nil {
+		log.Printf("Failed to check session: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if reason != "" {
+		log.Printf("Denying session %.12s: %s", id, reason)
+		expireALBCookies(w)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// evictSessions periodically drops session records that are past the retention period
+func evictSessions(store *memorySessionStore, retention time.Duration) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		store.evictBefore(now.Add(-retention))
+	}
 }
 
 // LogoutHandler expires ALB Cookies and redirects to Cognito Logout Endpoint
 func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("Traffic reached LogoutHandler")
-	// There are 4 possible AWSELBAuthSessionCookies
-	// https://docs.aws.amazon.com/elasticloadbalancing/latest/application/listener-authenticate-users.html#authentication-logout
-	for cookieIndex := 0; cookieIndex < 4; cookieIndex++ {
-		name := fmt.Sprintf("AWSELBAuthSessionCookie-%s", strconv.Itoa(cookieIndex))
-		expireALBCookie := &http.Cookie{Value: "Expired", Name: name, MaxAge: -1, Path: "/"}
-		http.SetCookie(w, expireALBCookie)
+	if id := sessionID(r); id != "" && sessionPolicy.Enabled() {
+		if err := sessionPolicy.revoke(sessionStore, id, time.Now()); err != nil {
+			log.Printf("Failed to revoke session: %v", err)
+		}
 	}
+	expireALBCookies(w)
 
 	// Central Dashboard expects to redirect to event.detail.response['afterLogoutURL']) after logout
 	// https://github.com/kubeflow/kubeflow/blob/master/components/centraldashboard/public/components/logout-button.js#L49
@@ -54,7 +188,7 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	jsonBytes, err := json.Marshal(resp)
 	if err != nil {
-		log.Println("Failed to marshal struct to json: %v", err)
+		log.Printf("Failed to marshal struct to json: %v", err)
 	}
 
 	w.Write(jsonBytes)
@@ -66,6 +200,13 @@ func main() {
 
 	router := mux.NewRouter()
 	router.HandleFunc("/authservice/logout", LogoutHandler).Methods(http.MethodPost)
+	router.PathPrefix(authorizePathPrefix).HandlerFunc(AuthorizeHandler)
+	if store, ok := sessionStore.(*memorySessionStore); ok && sessionPolicy.Enabled() {
+		go evictSessions(store, sessionPolicy.Retention)
+	}
+	if accessPolicy != nil {
+		go accessPolicy.watch(accessPolicyReloadInterval)
+	}
 	var listenPort = ":" + port
 	log.Println("Starting web server at", listenPort)
 	log.Println(http.ListenAndServe(listenPort, handlers.CORS()(router)))
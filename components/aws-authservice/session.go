@@ -0,0 +1,215 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Session is the activity record kept for a single ALB session
+type Session struct {
+	FirstSeen time.Time
+	LastSeen  time.Time
+	// Revoked sessions are denied until they are evicted from the store
+	Revoked bool
+}
+
+// SessionStore keeps track of session activity keyed by session id.
+// Implementations must be safe for concurrent use.
+type SessionStore interface {
+	// Get returns the session for id and whether it exists
+	Get(id string) (Session, bool, error)
+	// Put stores the session for id
+	Put(id string, session Session) error
+	// Delete removes the session for id
+	Delete(id string) error
+}
+
+// newSessionStore returns the SessionStore implementation registered under name that
+// keeps at most size sessions
+func newSessionStore(name string, size int) (SessionStore, error) {
+	switch name {
+	case "", "memory":
+		return newMemorySessionStore(size), nil
+	default:
+		return nil, fmt.Errorf("unknown session store %q", name)
+	}
+}
+
+// memorySessionStore is an in-process SessionStore. Sessions are not shared
+// between replicas and are lost on restart. The store holds at most size
+// sessions, so that requests with made-up cookies can't grow it without bound.
+// When it is full the least recently stored session is evicted, which restarts
+// the clocks of that session if its cookie comes back.
+type memorySessionStore struct {
+	mu   sync.Mutex
+	size int
+	// order holds the *memorySession of every id, the most recently stored first
+	order    *list.List
+	sessions map[string]*list.Element
+}
+
+type memorySession struct {
+	id      string
+	session Session
+}
+
+func newMemorySessionStore(size int) *memorySessionStore {
+	return &memorySessionStore{size: size, order: list.New(), sessions: map[string]*list.Element{}}
+}
+
+func (s *memorySessionStore) Get(id string) (Session, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.sessions[id]
+	if !ok {
+		return Session{}, false, nil
+	}
+	return e.Value.(*memorySession).session, true, nil
+}
+
+func (s *memorySessionStore) Put(id string, session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.sessions[id]; ok {
+		e.Value.(*memorySession).session = session
+		s.order.MoveToFront(e)
+		return nil
+	}
+	for s.size > 0 && s.order.Len() >= s.size {
+		s.remove(s.order.Back())
+	}
+	s.sessions[id] = s.order.PushFront(&memorySession{id: id, session: session})
+	return nil
+}
+
+func (s *memorySessionStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.sessions[id]; ok {
+		s.remove(e)
+	}
+	return nil
+}
+
+func (s *memorySessionStore) remove(e *list.Element) {
+	s.order.Remove(e)
+	delete(s.sessions, e.Value.(*memorySession).id)
+}
+
+// Len returns the number of sessions in the store
+func (s *memorySessionStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+// evictBefore removes every session last seen before cutoff
+func (s *memorySessionStore) evictBefore(cutoff time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for e := s.order.Front(); e != nil; {
+		next := e.Next()
+		if e.Value.(*memorySession).session.LastSeen.Before(cutoff) {
+			s.remove(e)
+		}
+		e = next
+	}
+}
+
+// SessionPolicy decides whether a session is still valid
+type SessionPolicy struct {
+	// IdleTimeout is the maximum time between two requests of a session. Zero disables the check.
+	IdleTimeout time.Duration
+	// MaxLifetime is the maximum time since the first request of a session. Zero disables the check.
+	MaxLifetime time.Duration
+	// Retention is how long a session record is kept after its last request. It should be at
+	// least the ALB SessionTimeout so that a revoked cookie is not mistaken for a new session.
+	Retention time.Duration
+}
+
+// revoke marks the session id as revoked, e.g. on logout
+func (p SessionPolicy) revoke(store SessionStore, id string, now time.Time) error {
+	session, ok, err := store.Get(id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		session = Session{FirstSeen: now}
+	}
+	session.LastSeen = now
+	session.Revoked = true
+	return store.Put(id, session)
+}
+
+// Enabled reports whether any session limit is configured
+func (p SessionPolicy) Enabled() bool {
+	return p.IdleTimeout > 0 || p.MaxLifetime > 0
+}
+
+// check records activity for the session id at now and returns a non-empty
+// reason if the session must be denied. Denied sessions stay in the store as
+// revoked so that replaying the same ALB cookie keeps being denied, while the
+// cookie issued after re-authentication starts a new session.
+func (p SessionPolicy) check(store SessionStore, id string, now time.Time) (string, error) {
+	session, ok, err := store.Get(id)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", store.Put(id, Session{FirstSeen: now, LastSeen: now})
+	}
+
+	reason := ""
+	if session.Revoked {
+		reason = "session was revoked"
+	} else if p.IdleTimeout > 0 && now.Sub(session.LastSeen) > p.IdleTimeout {
+		reason = fmt.Sprintf("idle for %v, limit is %v", now.Sub(session.LastSeen).Round(time.Second), p.IdleTimeout)
+	} else if p.MaxLifetime > 0 && now.Sub(session.FirstSeen) > p.MaxLifetime {
+		reason = fmt.Sprintf("session age %v exceeds limit of %v", now.Sub(session.FirstSeen).Round(time.Second), p.MaxLifetime)
+	}
+	if reason != "" {
+		session.Revoked = true
+		return reason, store.Put(id, session)
+	}
+
+	session.LastSeen = now
+	return "", store.Put(id, session)
+}
+
+// sessionID derives a stable identifier from the ALB session cookie shards.
+// The raw cookie value is never stored. An empty id means the request carries
+// no ALB session.
+func sessionID(r *http.Request) string {
+	h := sha256.New()
+	found := false
+	for cookieIndex := 0; cookieIndex < albCookieShards; cookieIndex++ {
+		c, err := r.Cookie(albCookieName(cookieIndex))
+		if err != nil {
+			continue
+		}
+		found = true
+		h.Write([]byte(c.Value))
+	}
+	if !found {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
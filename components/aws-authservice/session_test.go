@@ -0,0 +1,156 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSessionPolicyCheck(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	policy := SessionPolicy{IdleTimeout: time.Hour, MaxLifetime: 12 * time.Hour}
+
+	// request is a request of the session at an offset from start, or a logout if revoke is set
+	type request struct {
+		at     time.Duration
+		revoke bool
+		denied bool
+	}
+	testCases := []struct {
+		name     string
+		policy   SessionPolicy
+		requests []request
+	}{
+		{
+			name:   "active session",
+			policy: policy,
+			requests: []request{
+				{at: 0},
+				{at: 50 * time.Minute},
+				{at: 100 * time.Minute},
+			},
+		},
+		{
+			name:   "idle expiry",
+			policy: policy,
+			requests: []request{
+				{at: 0},
+				{at: 61 * time.Minute, denied: true},
+				// The cookie stays denied once it expired
+				{at: 62 * time.Minute, denied: true},
+			},
+		},
+		{
+			name:   "idle expiry measured from the last request",
+			policy: policy,
+			requests: []request{
+				{at: 0},
+				{at: 59 * time.Minute},
+				{at: 118 * time.Minute},
+				{at: 179 * time.Minute, denied: true},
+			},
+		},
+		{
+			name:   "absolute expiry",
+			policy: SessionPolicy{MaxLifetime: 12 * time.Hour},
+			requests: []request{
+				{at: 0},
+				{at: 11 * time.Hour},
+				{at: 11*time.Hour + 50*time.Minute},
+				{at: 12*time.Hour + 30*time.Minute, denied: true},
+			},
+		},
+		{
+			name:   "no limits",
+			policy: SessionPolicy{},
+			requests: []request{
+				{at: 0},
+				{at: 30 * 24 * time.Hour},
+			},
+		},
+		{
+			name:   "revoke",
+			policy: policy,
+			requests: []request{
+				{at: 0},
+				{at: time.Minute, revoke: true},
+				{at: 2 * time.Minute, denied: true},
+			},
+		},
+		{
+			name:   "revoke of an unknown session",
+			policy: policy,
+			requests: []request{
+				{at: 0, revoke: true},
+				{at: time.Minute, denied: true},
+			},
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			store := newMemorySessionStore(defaultSessionStoreSize)
+			for i, r := range c.requests {
+				now := start.Add(r.at)
+				if r.revoke {
+					if err := c.policy.revoke(store, "session", now); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				reason, err := c.policy.check(store, "session", now)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if denied := reason != ""; denied != r.denied {
+					t.Errorf("request %d at %v: got denied %v (%q); want %v", i, r.at, denied, reason, r.denied)
+				}
+			}
+		})
+	}
+}
+
+func TestMemorySessionStoreSize(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := newMemorySessionStore(3)
+	for i := 0; i < 3; i++ {
+		store.Put(fmt.Sprint(i), Session{FirstSeen: start, LastSeen: start.Add(time.Duration(i) * time.Minute)})
+	}
+	// Storing session 0 again makes session 1 the least recently stored
+	store.Put("0", Session{FirstSeen: start, LastSeen: start.Add(3 * time.Minute)})
+	for i := 3; i < 5; i++ {
+		store.Put(fmt.Sprint(i), Session{FirstSeen: start, LastSeen: start.Add(time.Duration(i) * time.Minute)})
+	}
+
+	if store.Len() != 3 {
+		t.Errorf("got %d sessions; want 3", store.Len())
+	}
+	for id, expected := range map[string]bool{"0": true, "1": false, "2": false, "3": true, "4": true} {
+		if _, ok, _ := store.Get(id); ok != expected {
+			t.Errorf("session %v: got stored %v; want %v", id, ok, expected)
+		}
+	}
+
+	store.evictBefore(start.Add(4 * time.Minute))
+	for id, expected := range map[string]bool{"0": false, "3": false, "4": true} {
+		if _, ok, _ := store.Get(id); ok != expected {
+			t.Errorf("session %v after eviction: got stored %v; want %v", id, ok, expected)
+		}
+	}
+	if store.Len() != 1 {
+		t.Errorf("got %d sessions after eviction; want 1", store.Len())
+	}
+}
@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// allowlistEntry is an entry of an allowlist, see loadAllowlist
+type allowlistEntry interface {
+	// validate returns an error if a required field of the entry is missing or invalid
+	validate() error
+}
+
+// loadAllowlist reads the allowlist in path into v, a pointer to a list of allowlistEntry or to a struct of such
+// lists, and validates every entry. Patterns of the entries are matched with matchPattern.
+func loadAllowlist(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("could not parse %v; error: %v", path, err)
+	}
+	return validateAllowlist(path, "", reflect.ValueOf(v).Elem())
+}
+
+// validateAllowlist validates the entries of the list v, or of every list field of the struct v, which are named
+// after their key in the file
+func validateAllowlist(path string, list string, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			name := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+			if err := validateAllowlist(path, name+" ", v.Field(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			e, ok := v.Index(i).Interface().(allowlistEntry)
+			if !ok {
+				continue
+			}
+			var err error
+			if v.Index(i).Kind() == reflect.Ptr && v.Index(i).IsNil() {
+				err = errors.New("is empty")
+			} else {
+				err = e.validate()
+			}
+			if err != nil {
+				return fmt.Errorf("%v: %ventry %d %v", path, list, i, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadAllowlist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "allowlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testCases := []struct {
+		name     string
+		content  string
+		v        interface{}
+		expected string
+	}{
+		{
+			name:    "valid list",
+			content: "- resource: v1 Service istio-system/*\n  reason: deployed by Istio\n",
+			v:       &[]*ServiceException{},
+		},
+		{
+			name:     "entry without a reason",
+			content:  "- resource: v1 Service istio-system/*\n  reason: deployed by Istio\n- resource: v1 Service kubeflow/*\n",
+			v:        &[]*ServiceException{},
+			expected: "entry 1 needs a resource and a reason",
+		},
+		{
+			name:     "empty entry",
+			content:  "-\n",
+			v:        &[]*ServiceException{},
+			expected: "entry 0 is empty",
+		},
+		{
+			name:     "list of a struct",
+			content:  "registries:\n- registry: docker.io\n  reason: Kubeflow\nfloating:\n- image: docker.io/prom/prometheus\n",
+			v:        &ImagePolicy{},
+			expected: "floating entry 0 needs an image and a reason",
+		},
+	}
+
+	for _, c := range testCases {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(dir, "allowlist.yaml")
+			if err := ioutil.WriteFile(path, []byte(c.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := loadAllowlist(path, c.v)
+			if c.expected == "" {
+				if err != nil {
+					t.Errorf("got error %v; want none", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != path+": "+c.expected {
+				t.Errorf("got error %v; want %v: %v", err, path, c.expected)
+			}
+		})
+	}
+}
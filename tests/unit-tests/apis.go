@@ -0,0 +1,224 @@
+package tests
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// DeprecatedAPIsFile is the catalog of deprecated and removed APIs
+	DeprecatedAPIsFile = "deprecated_apis.yaml"
+	// KubernetesComponent is the component of the Kubernetes APIs in the catalog
+	KubernetesComponent = "k8s"
+)
+
+// targetVersions overrides the target versions of the catalog. It can also be set with TARGET_VERSIONS.
+var targetVersions = flag.String("target-versions", "", "target versions of the deprecated API catalog, e.g. k8s=v1.26.0,istio=v1.17.0")
+
+// DeprecatedAPI is an API version of a kind that is deprecated or removed in a version of its component
+type DeprecatedAPI struct {
+	// Version is the apiVersion, e.g. batch/v1beta1
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+	// DeprecatedIn is the first version of the component that deprecates the API, if any
+	DeprecatedIn string `json:"deprecated-in"`
+	// RemovedIn is the first version of the component that no longer serves the API, if any
+	RemovedIn string `json:"removed-in"`
+	// ReplacementAPI is the apiVersion to migrate to
+	ReplacementAPI string `json:"replacement-api"`
+	// Component serves the API, e.g. k8s or istio
+	Component string `json:"component"`
+}
+
+// apiCatalog is the content of DeprecatedAPIsFile
+type apiCatalog struct {
+	// TargetVersions are the versions of each component that resources are checked against
+	TargetVersions     map[string][]string `json:"target-versions"`
+	DeprecatedVersions []*DeprecatedAPI    `json:"deprecated-versions"`
+}
+
+// loadAPICatalog reads the catalog in path. The target versions of k8s default to KubernetesVersions.
+func loadAPICatalog(path string) (*apiCatalog, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &apiCatalog{}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("could not parse %v; error: %v", path, err)
+	}
+	if c.TargetVersions == nil {
+		c.TargetVersions = map[string][]string{}
+	}
+	if _, ok := c.TargetVersions[KubernetesComponent]; !ok {
+		c.TargetVersions[KubernetesComponent] = KubernetesVersions
+	}
+
+	for i, d := range c.DeprecatedVersions {
+		if d.Version == "" || d.Kind == "" || d.Component == "" {
+			return nil, fmt.Errorf("%v: entry %d needs a version, a kind and a component", path, i)
+		}
+		if d.DeprecatedIn == "" && d.RemovedIn == "" {
+			return nil, fmt.Errorf("%v: entry %d needs deprecated-in or removed-in", path, i)
+		}
+		for _, v := range []string{d.DeprecatedIn, d.RemovedIn} {
+			if _, err := parseVersion(v); v != "" && err != nil {
+				return nil, fmt.Errorf("%v: entry %d: %v", path, i, err)
+			}
+		}
+		if _, ok := c.TargetVersions[d.Component]; !ok {
+			return nil, fmt.Errorf("%v: entry %d: component %v has no target versions", path, i, d.Component)
+		}
+	}
+	return c, nil
+}
+
+// setTargetVersions replaces the target versions of the components in override, which has the format of
+// the -target-versions flag of pluto, e.g. k8s=v1.26.0,istio=v1.17.0. A component may be repeated.
+func (c *apiCatalog) setTargetVersions(override string) error {
+	replaced := map[string]bool{}
+	for _, target := range strings.Split(override, ",") {
+		target = strings.TrimSpace(target)
+		if target == "" {
+			continue
+		}
+		parts := strings.SplitN(target, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("target version %q should be <component>=<version>", target)
+		}
+		if _, err := parseVersion(parts[1]); err != nil {
+			return err
+		}
+		if !replaced[parts[0]] {
+			c.TargetVersions[parts[0]] = nil
+			replaced[parts[0]] = true
+		}
+		c.TargetVersions[parts[0]] = append(c.TargetVersions[parts[0]], parts[1])
+	}
+	return nil
+}
+
+// lookup returns the entry of the catalog for kind in apiVersion or nil if the API isn't deprecated
+func (c *apiCatalog) lookup(apiVersion string, kind string) *DeprecatedAPI {
+	for _, d := range c.DeprecatedVersions {
+		if d.Version == apiVersion && d.Kind == kind {
+			return d
+		}
+	}
+	return nil
+}
+
+// check returns an error message if kind in apiVersion is removed in a target version of its component,
+// or else a warning if it is deprecated in one
+func (c *apiCatalog) check(apiVersion string, kind string) (removed string, deprecated string) {
+	d := c.lookup(apiVersion, kind)
+	if d == nil {
+		return "", ""
+	}
+	var removedTargets, deprecatedTargets []string
+	for _, target := range c.TargetVersions[d.Component] {
+		if versionAtLeast(target, d.RemovedIn) {
+			removedTargets = append(removedTargets, target)
+		} else if versionAtLeast(target, d.DeprecatedIn) {
+			deprecatedTargets = append(deprecatedTargets, target)
+		}
+	}
+
+	migrate := "; it has no replacement"
+	if d.ReplacementAPI != "" {
+		migrate = "; migrate to " + d.ReplacementAPI
+	}
+	if len(removedTargets) > 0 {
+		removed = fmt.Sprintf("%v %v is removed in %v %v, target versions %v%v",
+			d.Version, d.Kind, d.Component, d.RemovedIn, strings.Join(removedTargets, ", "), migrate)
+	} else if len(deprecatedTargets) > 0 {
+		deprecated = fmt.Sprintf("%v %v is deprecated in %v %v, target versions %v%v",
+			d.Version, d.Kind, d.Component, d.DeprecatedIn, strings.Join(deprecatedTargets, ", "), migrate)
+	}
+	return removed, deprecated
+}
+
+// parseVersion parses a version like v1.25.0 or 1.25 into its major, minor and patch number
+func parseVersion(v string) ([3]int, error) {
+	var parsed [3]int
+	parts := strings.Split(strings.TrimPrefix(v, "v"), ".")
+	if len(parts) > 3 {
+		return parsed, fmt.Errorf("invalid version %q", v)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return parsed, fmt.Errorf("invalid version %q", v)
+		}
+		parsed[i] = n
+	}
+	return parsed, nil
+}
+
+// versionAtLeast reports whether version v is at or after version min. It is false if min is empty.
+func versionAtLeast(v string, min string) bool {
+	if min == "" {
+		return false
+	}
+	a, errA := parseVersion(v)
+	b, errB := parseVersion(min)
+	if errA != nil || errB != nil {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] > b[i]
+		}
+	}
+	return true
+}
+
+var (
+	defaultCatalogOnce sync.Once
+	defaultCatalog     *apiCatalog
+	defaultCatalogErr  error
+)
+
+// loadDefaultAPICatalog reads DeprecatedAPIsFile with the target versions of -target-versions or TARGET_VERSIONS
+func loadDefaultAPICatalog() (*apiCatalog, error) {
+	defaultCatalogOnce.Do(func() {
+		defaultCatalog, defaultCatalogErr = loadAPICatalog(filepath.Join(unitTestsDir(), DeprecatedAPIsFile))
+		if defaultCatalogErr != nil {
+			return
+		}
+		override := *targetVersions
+		if override == "" {
+			override = os.Getenv("TARGET_VERSIONS")
+		}
+		defaultCatalogErr = defaultCatalog.setTargetVersions(override)
+	})
+	return defaultCatalog, defaultCatalogErr
+}
+
+// checkDeprecatedAPIs fails the test for every resource with an API that is removed in a target version,
+// and logs a warning for every resource with an API that is deprecated in one
+func checkDeprecatedAPIs(t *testing.T, resources []*builtResource) {
+	t.Helper()
+	catalog, err := loadDefaultAPICatalog()
+	if err != nil {
+		t.Fatalf("Could not load %v; error: %v", DeprecatedAPIsFile, err)
+	}
+	for _, r := range resources {
+		removed, deprecated := catalog.check(r.apiVersion, r.kind)
+		if removed != "" {
+			t.Errorf("Resource %v uses a removed API: %v", r.Key(), removed)
+		}
+		if deprecated != "" {
+			t.Logf("Warning: resource %v uses a deprecated API: %v", r.Key(), deprecated)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestAPICatalog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, DeprecatedAPIsFile)
+	err = ioutil.WriteFile(path, []byte(`target-versions:
+  istio: [v1.16.0]
+deprecated-versions:
+- version: batch/v1beta1
+  kind: CronJob
+  deprecated-in: v1.21.0
+  removed-in: v1.25.0
+  replacement-api: batch/v1
+  component: k8s
+- version: autoscaling/v2beta2
+  kind: HorizontalPodAutoscaler
+  deprecated-in: v1.23.0
+  removed-in: v1.26.0
+  replacement-api: autoscaling/v2
+  component: k8s
+- version: rbac.istio.io/v1alpha1
+  kind: ServiceRole
+  deprecated-in: v1.4.0
+  removed-in: v1.6.0
+  component: istio
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := loadAPICatalog(path)
+	if err != nil {
+		t.Fatalf("Could not load catalog; error: %v", err)
+	}
+
+	type testCase struct {
+		apiVersion string
+		kind       string
+		removed    string
+		deprecated string
+	}
+	check := func(testCases []testCase) {
+		for _, c := range testCases {
+			removed, deprecated := catalog.check(c.apiVersion, c.kind)
+			if removed != c.removed || deprecated != c.deprecated {
+				t.Errorf("%v %v: got removed %q, deprecated %q; want removed %q, deprecated %q",
+					c.apiVersion, c.kind, removed, deprecated, c.removed, c.deprecated)
+			}
+		}
+	}
+
+	check([]testCase{
+		{
+			apiVersion: "batch/v1beta1",
+			kind:       "CronJob",
+			removed:    "batch/v1beta1 CronJob is removed in k8s v1.25.0, target versions 1.25; migrate to batch/v1",
+		},
+		{
+			apiVersion: "autoscaling/v2beta2",
+			kind:       "HorizontalPodAutoscaler",
+			deprecated: "autoscaling/v2beta2 HorizontalPodAutoscaler is deprecated in k8s v1.23.0, target versions 1.23, 1.24, 1.25; migrate to autoscaling/v2",
+		},
+		{
+			apiVersion: "rbac.istio.io/v1alpha1",
+			kind:       "ServiceRole",
+			removed:    "rbac.istio.io/v1alpha1 ServiceRole is removed in istio v1.6.0, target versions v1.16.0; it has no replacement",
+		},
+		{
+			apiVersion: "batch/v1",
+			kind:       "CronJob",
+		},
+	})
+
+	if err := catalog.setTargetVersions("k8s=v1.22.0,k8s=v1.26.0"); err != nil {
+		t.Fatal(err)
+	}
+	check([]testCase{
+		{
+			apiVersion: "autoscaling/v2beta2",
+			kind:       "HorizontalPodAutoscaler",
+			removed:    "autoscaling/v2beta2 HorizontalPodAutoscaler is removed in k8s v1.26.0, target versions v1.26.0; migrate to autoscaling/v2",
+		},
+	})
+
+	if err := catalog.setTargetVersions("k8s"); err == nil {
+		t.Errorf("Target version without a version was accepted")
+	}
+}
+
+// TestDeprecatedAPIs loads deprecated_apis.yaml so that a broken entry fails even if no resource uses its API
+func TestDeprecatedAPIs(t *testing.T) {
+	if _, err := loadAPICatalog(DeprecatedAPIsFile); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestKubernetesVersions checks that the default EKS version of each deployment option's Terraform is one of
+// the KubernetesVersions that resources are validated against
+func TestKubernetesVersions(t *testing.T) {
+	eksVersion := regexp.MustCompile(`variable "eks_version" \{[^}]*default\s*=\s*"([^"]+)"`)
+	for _, rpath := range DeploymentOptions {
+		path := filepath.Join(RepoRoot, rpath, "terraform", "variables.tf")
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Errorf("Could not read %v; error: %v", path, err)
+			continue
+		}
+		m := eksVersion.FindSubmatch(data)
+		if m == nil {
+			t.Errorf("%v has no default eks_version", path)
+			continue
+		}
+		found := false
+		for _, v := range KubernetesVersions {
+			found = found || v == string(m[1])
+		}
+		if !found {
+			t.Errorf("Default eks_version %s of %v is not one of the KubernetesVersions %v", m[1], path, KubernetesVersions)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package ext_authz
+
+import (
+	"github.com/kubeflow/manifests/tests"
+	"testing"
+)
+
+func TestKustomize(t *testing.T) {
+	testCase := &tests.KustomizeTestCase{
+		Package:  "../../../../../../../awsconfigs/common/aws-authservice/overlays/ext-authz",
+		Expected: "test_data/expected",
+	}
+
+	tests.RunTestCase(t, testCase)
+}
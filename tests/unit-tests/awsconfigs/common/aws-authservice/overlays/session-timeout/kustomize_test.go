@@ -0,0 +1,15 @@
+package session_timeout
+
+import (
+	"github.com/kubeflow/manifests/tests"
+	"testing"
+)
+
+func TestKustomize(t *testing.T) {
+	testCase := &tests.KustomizeTestCase{
+		Package:  "../../../../../../../awsconfigs/common/aws-authservice/overlays/session-timeout",
+		Expected: "test_data/expected",
+	}
+
+	tests.RunTestCase(t, testCase)
+}
@@ -0,0 +1,231 @@
+package tests
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"sigs.k8s.io/kustomize/api/krusty"
+	kusttypes "sigs.k8s.io/kustomize/api/types"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// Engine selects the kustomize implementation used to build a package
+type Engine int
+
+const (
+	// KrustyEngine builds with sigs.k8s.io/kustomize/api/krusty v0.21.2, the engine of kustomize v5.8
+	KrustyEngine Engine = iota
+	// V3Engine builds with sigs.k8s.io/kustomize/v3 v3.2.0, see buildV3
+	V3Engine
+	// BothEngines builds with both engines and reports every resource on which they diverge.
+	// The output of KrustyEngine is compared against the expected resources.
+	BothEngines
+)
+
+func (e Engine) String() string {
+	switch e {
+	case KrustyEngine:
+		return "krusty"
+	case V3Engine:
+		return "v3"
+	case BothEngines:
+		return "both"
+	}
+	return fmt.Sprintf("Engine(%d)", int(e))
+}
+
+// builtResource is a single resource in the output of a kustomize build
+type builtResource struct {
+	apiVersion string
+	group      string
+	version    string
+	kind       string
+	namespace  string
+	name       string
+	yaml       []byte
+}
+
+// Key returns the identity of the resource, see key
+func (r *builtResource) Key() string {
+	return key(r.apiVersion, r.kind, r.namespace, r.name)
+}
+
+// FileName returns the name of the expected file for the resource
+func (r *builtResource) FileName() string {
+	return expectedFileName(r.group, r.version, r.kind, r.name)
+}
+
+func newBuiltResource(group, version, kind, namespace, name string, yaml []byte) *builtResource {
+	apiVersion := version
+	if group != "" {
+		apiVersion = group + "/" + version
+	}
+	return &builtResource{
+		apiVersion: apiVersion,
+		group:      group,
+		version:    version,
+		kind:       kind,
+		namespace:  namespace,
+		name:       name,
+		yaml:       yaml,
+	}
+}
+
+// buildPackage runs kustomize build on the package directory pkg with the given engine.
+// BothEngines returns the output of KrustyEngine after reporting divergences.
+func buildPackage(t *testing.T, pkg string, engine Engine) []*builtResource {
+	t.Helper()
+	switch engine {
+	case V3Engine:
+		return buildResources(t, pkg, buildV3)
+	case BothEngines:
+		v3 := buildResources(t, pkg, buildV3)
+		krusty := buildResources(t, pkg, buildKrusty)
+		reportEngineDivergence(t, v3, krusty)
+		return krusty
+	default:
+		return buildResources(t, pkg, buildKrusty)
+	}
+}
+
+func buildResources(t *testing.T, pkg string, build func(string) ([]*builtResource, error)) []*builtResource {
+	t.Helper()
+	resources, err := build(pkg)
+	if err != nil {
+		t.Fatalf("Could not build %v; error: %v", pkg, err)
+	}
+	return resources
+}
+
+// KustomizeV3Dir is the module of the command that builds with kustomize v3.2.0, see buildV3
+const KustomizeV3Dir = "kustomizev3"
+
+var (
+	kustomizeV3Once sync.Once
+	kustomizeV3Path string
+	kustomizeV3Err  error
+)
+
+// kustomizeV3 builds the command in KustomizeV3Dir once and returns its path
+func kustomizeV3() (string, error) {
+	kustomizeV3Once.Do(func() {
+		kustomizeV3Path = filepath.Join(os.TempDir(), "kubeflow-manifests-kustomizev3")
+		cmd := exec.Command("go", "build", "-o", kustomizeV3Path, ".")
+		cmd.Dir = filepath.Join(unitTestsDir(), KustomizeV3Dir)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			kustomizeV3Err = fmt.Errorf("could not build %v; error: %v\n%s", KustomizeV3Dir, err, out)
+		}
+	})
+	return kustomizeV3Path, kustomizeV3Err
+}
+
+// buildV3 builds pkg with kustomize v3.2.0. kustomize v3 doesn't compile against the k8s.io/kube-openapi of
+// sigs.k8s.io/kustomize/api, so it runs as a command of its own module.
+func buildV3(pkg string) ([]*builtResource, error) {
+	command, err := kustomizeV3()
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(command, pkg)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%v%s", err, stderr.Bytes())
+	}
+
+	var resources []*builtResource
+	for _, data := range bytes.Split(out, []byte("---\n")) {
+		if len(bytes.TrimSpace(data)) == 0 {
+			continue
+		}
+		object := struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+			Metadata   struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"metadata"`
+		}{}
+		if err := yaml.Unmarshal(data, &object); err != nil {
+			return nil, fmt.Errorf("could not parse the output of %v; error: %v", KustomizeV3Dir, err)
+		}
+		group, version := "", object.APIVersion
+		if i := strings.LastIndex(version, "/"); i >= 0 {
+			group, version = version[:i], version[i+1:]
+		}
+		resources = append(resources, newBuiltResource(group, version, object.Kind, object.Metadata.Namespace, object.Metadata.Name, data))
+	}
+	return resources, nil
+}
+
+// buildKrusty builds pkg with sigs.k8s.io/kustomize/api
+func buildKrusty(pkg string) ([]*builtResource, error) {
+	return buildKrustyFs(filesys.MakeFsOnDisk(), pkg)
+}
+
+// buildKrustyFs builds pkg with sigs.k8s.io/kustomize/api reading files from fSys
+func buildKrustyFs(fSys filesys.FileSystem, pkg string) ([]*builtResource, error) {
+	opts := krusty.MakeDefaultOptions()
+	// Equivalent to kustomize build --load-restrictor LoadRestrictionsNone
+	opts.LoadRestrictions = kusttypes.LoadRestrictionsNone
+	m, err := krusty.MakeKustomizer(opts).Run(fSys, pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []*builtResource
+	for _, r := range m.Resources() {
+		data, err := r.AsYAML()
+		if err != nil {
+			return nil, fmt.Errorf("could not generate YAML for resource %v; error: %v", r.CurId(), err)
+		}
+		gvk := r.GetGvk()
+		resources = append(resources, newBuiltResource(gvk.Group, gvk.Version, gvk.Kind, r.GetNamespace(), r.GetName(), data))
+	}
+	return resources, nil
+}
+
+// reportEngineDivergence reports resources that only one engine produced or that differ between engines
+func reportEngineDivergence(t *testing.T, v3 []*builtResource, krusty []*builtResource) {
+	t.Helper()
+	v3ByKey := map[string]*builtResource{}
+	for _, r := range v3 {
+		v3ByKey[r.Key()] = r
+	}
+
+	var divergences []string
+	for _, r := range krusty {
+		other, ok := v3ByKey[r.Key()]
+		if !ok {
+			divergences = append(divergences, fmt.Sprintf("%v: only built by %v", r.Key(), KrustyEngine))
+			continue
+		}
+		delete(v3ByKey, r.Key())
+
+		paths, err := semanticDiff(r.yaml, other.yaml)
+		if err != nil {
+			t.Errorf("Could not compare resource: %v; error: %v", r.Key(), err)
+			continue
+		}
+		if len(paths) > 0 {
+			divergences = append(divergences, fmt.Sprintf("%v: differs in %v\n%v", r.Key(), paths, labeledDiff(V3Engine.String(), other.yaml, KrustyEngine.String(), r.yaml)))
+		}
+	}
+	for k := range v3ByKey {
+		divergences = append(divergences, fmt.Sprintf("%v: only built by %v", k, V3Engine))
+	}
+
+	sort.Strings(divergences)
+	for _, d := range divergences {
+		t.Errorf("Engines %v and %v diverge for resource %v", V3Engine, KrustyEngine, d)
+	}
+}
@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+const (
+	// ParamsFixtureDir holds the params.env values deployments are built with. Files mirror the
+	// repository layout, e.g. test_data/params/awsconfigs/common/aws-alb-ingress-controller/base/params.env
+	ParamsFixtureDir = "test_data/params"
+	// InventoryFile is the file, relative to the test directory of a deployment option, holding its inventory
+	InventoryFile = "test_data/inventory.txt"
+)
+
+// DeploymentOptions are the top-level deployment options, relative to the repository root, that
+// are built as a whole and compared against their inventory
+var DeploymentOptions = []string{
+	"deployments/vanilla",
+	"deployments/cognito",
+	"deployments/rds-s3",
+	"deployments/cognito-rds-s3",
+}
+
+// IsDeploymentOption reports whether rpath is one of the DeploymentOptions
+func IsDeploymentOption(rpath string) bool {
+	for _, option := range DeploymentOptions {
+		if filepath.Clean(rpath) == option {
+			return true
+		}
+	}
+	return false
+}
+
+// paramsFs is a file system that serves fixture content in place of files on disk
+type paramsFs struct {
+	filesys.FileSystem
+	fixtures map[string][]byte
+}
+
+// newParamsFs returns a file system reading from disk in which every file below fixtureDir replaces
+// the file at the same path relative to repoRoot. A fixture without a counterpart is an error so
+// that fixtures don't silently go stale when a params.env is moved, unless skipMissing is set.
+func newParamsFs(repoRoot string, fixtureDir string, skipMissing bool) (*paramsFs, error) {
+	fSys := &paramsFs{FileSystem: filesys.MakeFsOnDisk(), fixtures: map[string][]byte{}}
+	err := filepath.Walk(fixtureDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(fixtureDir, path)
+		if err != nil {
+			return err
+		}
+		target, err := filepath.Abs(filepath.Join(repoRoot, rel))
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(target); err != nil {
+			if skipMissing && os.IsNotExist(err) {
+				return nil
+			}
+			return fmt.Errorf("fixture %v has no counterpart; error: %v", path, err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fSys.fixtures[target] = data
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fSys, nil
+}
+
+// ReadFile returns the fixture for path if there is one
+func (f *paramsFs) ReadFile(path string) ([]byte, error) {
+	if abs, err := filepath.Abs(path); err == nil {
+		if data, ok := f.fixtures[abs]; ok {
+			return data, nil
+		}
+	}
+	return f.FileSystem.ReadFile(path)
+}
+
+// buildDeployment builds the deployment option at rpath, relative to repoRoot, with the params fixtures applied
+func buildDeployment(repoRoot string, rpath string, fixtureDir string) ([]*builtResource, error) {
+	fSys, err := newParamsFs(repoRoot, fixtureDir, false)
+	if err != nil {
+		return nil, err
+	}
+	return buildKrustyFs(fSys, filepath.Join(repoRoot, rpath))
+}
+
+// Inventory maps the key of every resource in a build to the hash of its content
+type Inventory map[string]string
+
+// newInventory hashes the normalized YAML of each resource so that formatting and key order
+// don't change the inventory
+func newInventory(resources []*builtResource) (Inventory, error) {
+	inventory := Inventory{}
+	for _, r := range resources {
+		var v interface{}
+		if err := yaml.Unmarshal(r.yaml, &v); err != nil {
+			return nil, fmt.Errorf("could not parse resource %v; error: %v", r.Key(), err)
+		}
+		normalized, err := yaml.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("could not normalize resource %v; error: %v", r.Key(), err)
+		}
+		if _, ok := inventory[r.Key()]; ok {
+			return nil, fmt.Errorf("resource %v is built more than once", r.Key())
+		}
+		inventory[r.Key()] = fmt.Sprintf("%x", sha256.Sum256(normalized))
+	}
+	return inventory, nil
+}
+
+// Marshal returns the inventory in the format of sha256sum, one "<hash>  <key>" line per resource sorted by key
+func (i Inventory) Marshal() []byte {
+	keys := make([]string, 0, len(i))
+	for k := range i {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s  %s\n", i[k], k)
+	}
+	return b.Bytes()
+}
+
+// readInventory parses an inventory written by Marshal
+func readInventory(path string) (Inventory, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	inventory := Inventory{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		fields := strings.SplitN(scanner.Text(), "  ", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%v:%d: expected \"<hash>  <resource>\"", path, line)
+		}
+		inventory[fields[1]] = fields[0]
+	}
+	return inventory, scanner.Err()
+}
+
+// diffInventory describes every resource that was added, removed or changed from expected to actual
+func diffInventory(actual Inventory, expected Inventory) []string {
+	var changes []string
+	for k, hash := range actual {
+		expectedHash, ok := expected[k]
+		if !ok {
+			changes = append(changes, "added: "+k)
+		} else if hash != expectedHash {
+			changes = append(changes, "changed: "+k)
+		}
+	}
+	for k := range expected {
+		if _, ok := actual[k]; !ok {
+			changes = append(changes, "removed: "+k)
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDeployments builds each of the DeploymentOptions with the params fixtures in ParamsFixtureDir
+// and compares its resources to the inventory in tests/unit-tests/<deployment>/test_data/inventory.txt
+// and its images to the list in tests/unit-tests/<deployment>/test_data/images.txt. The references between
+// the Istio resources of the components are resolved against the whole deployment, see checkIstioReferences.
+func TestDeployments(t *testing.T) {
+	for _, rpath := range DeploymentOptions {
+		rpath := rpath
+		t.Run(rpath, func(t *testing.T) {
+			skipWithoutUpstream(t, rpath)
+
+			resources, err := buildDeployment(RepoRoot, rpath, ParamsFixtureDir)
+			if err != nil {
+				t.Fatalf("Could not build %v; error: %v", rpath, err)
+			}
+			validateResources(t, resources)
+			checkIstio(t, resources, true)
+			checkServices(t, resources, true)
+
+			actual, err := newInventory(resources)
+			if err != nil {
+				t.Fatalf("Could not create inventory of %v; error: %v", rpath, err)
+			}
+			images, err := collectImages(resources)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actualImages := imageList(images)
+
+			path := filepath.Join(rpath, InventoryFile)
+			imagesPath := filepath.Join(rpath, ImagesFile)
+			if updateGolden() {
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatalf("Could not create %v; error: %v", filepath.Dir(path), err)
+				}
+				if err := ioutil.WriteFile(path, actual.Marshal(), 0644); err != nil {
+					t.Fatalf("Could not write %v; error: %v", path, err)
+				}
+				t.Logf("Updated inventory of %v resources in %v", len(actual), path)
+				if err := ioutil.WriteFile(imagesPath, actualImages, 0644); err != nil {
+					t.Fatalf("Could not write %v; error: %v", imagesPath, err)
+				}
+				return
+			}
+
+			expected, err := readInventory(path)
+			switch {
+			case os.IsNotExist(err):
+				t.Errorf("No inventory in %v; run the test with -update or UPDATE_GOLDEN=1 to create it", path)
+			case err != nil:
+				t.Error(err)
+			default:
+				if changes := diffInventory(actual, expected); len(changes) > 0 {
+					t.Errorf("Resources of %v differ from %v:\n  %v", rpath, path, strings.Join(changes, "\n  "))
+				}
+			}
+
+			// The image list is compared even if the inventory is missing or differs
+			expectedImages, err := ioutil.ReadFile(imagesPath)
+			switch {
+			case os.IsNotExist(err):
+				t.Errorf("No image list in %v; run the test with -update or UPDATE_GOLDEN=1 to create it", imagesPath)
+			case err != nil:
+				t.Error(err)
+			default:
+				if changes := diffImageList(actualImages, expectedImages); len(changes) > 0 {
+					t.Errorf("Images of %v differ from %v:\n  %v", rpath, imagesPath, strings.Join(changes, "\n  "))
+				}
+			}
+		})
+	}
+}
+
+func TestBuildDeploymentParams(t *testing.T) {
+	resources, err := buildDeployment(RepoRoot, "awsconfigs/common/aws-alb-ingress-controller/base", ParamsFixtureDir)
+	if err != nil {
+		t.Fatalf("Could not build with params fixtures; error: %v", err)
+	}
+	for _, r := range resources {
+		if r.kind == "ConfigMap" && strings.HasPrefix(r.name, "aws-load-balancer-controller-config") {
+			if !strings.Contains(string(r.yaml), "clusterName: example-cluster") {
+				t.Errorf("Params fixture was not applied to %v:\n%s", r.Key(), r.yaml)
+			}
+			return
+		}
+	}
+	t.Errorf("No params ConfigMap in the output")
+}
+
+func TestParamsFsMissingCounterpart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "params")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"repo/params.env":           "clusterName=",
+		"fixtures/params.env":       "clusterName=example-cluster",
+		"fixtures/added/params.env": "region=us-west-2",
+	}
+	for path, content := range files {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repoRoot, fixtureDir := filepath.Join(dir, "repo"), filepath.Join(dir, "fixtures")
+
+	if _, err := newParamsFs(repoRoot, fixtureDir, false); err == nil {
+		t.Errorf("got no error for a fixture without a counterpart")
+	}
+	fSys, err := newParamsFs(repoRoot, fixtureDir, true)
+	if err != nil {
+		t.Fatalf("got error %v with skipMissing; want none", err)
+	}
+	if data, err := fSys.ReadFile(filepath.Join(repoRoot, "params.env")); err != nil || string(data) != "clusterName=example-cluster" {
+		t.Errorf("got %q, error %v; want the fixture", data, err)
+	}
+}
+
+func TestInventory(t *testing.T) {
+	expected := Inventory{
+		"v1 Namespace kubeflow":                "a",
+		"apps/v1 Deployment kubeflow/removed":  "b",
+		"apps/v1 Deployment kubeflow/modified": "c",
+	}
+	actual := Inventory{
+		"v1 Namespace kubeflow":                "a",
+		"apps/v1 Deployment kubeflow/modified": "d",
+		"apps/v1 Deployment kubeflow/added":    "e",
+	}
+
+	dir, err := ioutil.TempDir("", "inventory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "inventory.txt")
+	if err := ioutil.WriteFile(path, expected.Marshal(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	read, err := readInventory(path)
+	if err != nil {
+		t.Fatalf("Could not read inventory; error: %v", err)
+	}
+	if changes := diffInventory(read, expected); len(changes) > 0 {
+		t.Errorf("Inventory changed by reading it back: %v", changes)
+	}
+
+	want := []string{
+		"added: apps/v1 Deployment kubeflow/added",
+		"changed: apps/v1 Deployment kubeflow/modified",
+		"removed: apps/v1 Deployment kubeflow/removed",
+	}
+	if changes := diffInventory(actual, expected); strings.Join(changes, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got %v; want %v", changes, want)
+	}
+}
@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// CompareMode selects how RunTestCase compares actual and expected resources
+type CompareMode int
+
+const (
+	// SemanticCompare compares the parsed resources so that key order and formatting don't matter
+	SemanticCompare CompareMode = iota
+	// ByteCompare requires the actual YAML to be identical to the expected file
+	ByteCompare
+)
+
+// simpleFieldName matches map keys that can be written as .key in a field path
+var simpleFieldName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// semanticDiff parses both YAML documents and returns the paths of the fields that differ,
+// e.g. spec.template.spec.containers[0].image. It returns no paths if they are equal.
+func semanticDiff(actual []byte, expected []byte) ([]string, error) {
+	var a, e interface{}
+	if err := yaml.Unmarshal(actual, &a); err != nil {
+		return nil, fmt.Errorf("could not parse actual YAML; error: %v", err)
+	}
+	if err := yaml.Unmarshal(expected, &e); err != nil {
+		return nil, fmt.Errorf("could not parse expected YAML; error: %v", err)
+	}
+	return diffPaths("", a, e), nil
+}
+
+// diffPaths recursively compares a and e and returns the paths below path that differ.
+// Fields only present on one side are reported with their own path.
+func diffPaths(path string, a interface{}, e interface{}) []string {
+	switch aValue := a.(type) {
+	case map[string]interface{}:
+		eValue, ok := e.(map[string]interface{})
+		if !ok {
+			return []string{rootPath(path)}
+		}
+		keys := map[string]bool{}
+		for k := range aValue {
+			keys[k] = true
+		}
+		for k := range eValue {
+			keys[k] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+
+		var paths []string
+		for _, k := range sorted {
+			childA, inA := aValue[k]
+			childE, inE := eValue[k]
+			if !inA || !inE {
+				paths = append(paths, fieldPath(path, k))
+				continue
+			}
+			paths = append(paths, diffPaths(fieldPath(path, k), childA, childE)...)
+		}
+		return paths
+	case []interface{}:
+		eValue, ok := e.([]interface{})
+		if !ok {
+			return []string{rootPath(path)}
+		}
+		var paths []string
+		for i := 0; i < len(aValue) || i < len(eValue); i++ {
+			if i >= len(aValue) || i >= len(eValue) {
+				paths = append(paths, fmt.Sprintf("%s[%d]", path, i))
+				continue
+			}
+			paths = append(paths, diffPaths(fmt.Sprintf("%s[%d]", path, i), aValue[i], eValue[i])...)
+		}
+		return paths
+	default:
+		if !reflect.DeepEqual(a, e) {
+			return []string{rootPath(path)}
+		}
+		return nil
+	}
+}
+
+func fieldPath(path string, field string) string {
+	if !simpleFieldName.MatchString(field) {
+		return fmt.Sprintf("%s[%q]", path, field)
+	}
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+func rootPath(path string) string {
+	if path == "" {
+		return "."
+	}
+	return path
+}
+
+// unifiedDiff returns a unified diff from expected to actual, see labeledDiff
+func unifiedDiff(actual []byte, expected []byte) string {
+	return labeledDiff("expected", expected, "actual", actual)
+}
+
+// labeledDiff returns a unified diff from document a to document b. Both documents are normalized
+// first so that the diff only shows changed values and not reordered keys.
+func labeledDiff(aLabel string, a []byte, bLabel string, b []byte) string {
+	normalize := func(data []byte) string {
+		var v interface{}
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return string(data)
+		}
+		normalized, err := yaml.Marshal(v)
+		if err != nil {
+			return string(data)
+		}
+		return string(normalized)
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(normalize(a)),
+		B:        difflib.SplitLines(normalize(b)),
+		FromFile: aLabel,
+		ToFile:   bLabel,
+		Context:  3,
+	})
+	if err != nil {
+		return fmt.Sprintf("could not compute diff; error: %v", err)
+	}
+	return diff
+}
+
+// ReportSemanticDiff compares actual and expected structurally and reports a test error with a
+// unified diff and the paths of the fields that differ for the resource identified by rKey.
+// It returns true if the resources are equal.
+func ReportSemanticDiff(t *testing.T, rKey string, actual []byte, expected string) bool {
+	t.Helper()
+	paths, err := semanticDiff(actual, []byte(expected))
+	if err != nil {
+		t.Errorf("Could not compare resource: %v; error: %v", rKey, err)
+		return false
+	}
+	if len(paths) == 0 {
+		return true
+	}
+	t.Errorf("Expected not equal to actual for resource: %v\nDiffering fields:\n  %v\n%v",
+		rKey, strings.Join(paths, "\n  "), unifiedDiff(actual, []byte(expected)))
+	return false
+}
@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSemanticDiff(t *testing.T) {
+	type testCase struct {
+		Actual   string
+		Expected string
+		Paths    []string
+	}
+
+	testCases := []testCase{
+		{
+			// Key order and formatting are ignored.
+			Actual: `kind: ConfigMap
+apiVersion: v1
+data: {a: "1", b: "2"}
+`,
+			Expected: `apiVersion: v1
+kind: ConfigMap
+data:
+  b: "2"
+  a: "1"
+`,
+		},
+		{
+			Actual: `spec:
+  template:
+    metadata:
+      annotations:
+        sidecar.istio.io/inject: "true"
+    spec:
+      containers:
+      - name: c
+        image: app:v2
+`,
+			Expected: `spec:
+  template:
+    metadata:
+      annotations:
+        sidecar.istio.io/inject: "false"
+    spec:
+      containers:
+      - name: c
+        image: app:v1
+      - name: d
+`,
+			Paths: []string{
+				`spec.template.metadata.annotations["sidecar.istio.io/inject"]`,
+				"spec.template.spec.containers[0].image",
+				"spec.template.spec.containers[1]",
+			},
+		},
+		{
+			Actual:   "metadata:\n  name: a\n  labels:\n    app: a\n",
+			Expected: "metadata:\n  name: a\n",
+			Paths:    []string{"metadata.labels"},
+		},
+	}
+
+	for _, c := range testCases {
+		paths, err := semanticDiff([]byte(c.Actual), []byte(c.Expected))
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+			continue
+		}
+		if !reflect.DeepEqual(paths, c.Paths) {
+			t.Errorf("got %v; want %v", paths, c.Paths)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package tests
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// KustomizationFile is the file name that marks a directory as a kustomization package
+	KustomizationFile = "kustomization.yaml"
+	// RepoRoot is the path of the repository root relative to the unit-tests directory
+	RepoRoot = "../.."
+	// UpstreamDir is the directory, relative to the repository root, that kubeflow/manifests is cloned into
+	UpstreamDir = "upstream"
+	// ExpectedDir is the directory, relative to the test directory of a package, holding its expected resources
+	ExpectedDir = "test_data/expected"
+	// PackageTestFile is the per package test generated by generate_tests.py
+	PackageTestFile = "kustomize_test.go"
+)
+
+// KustomizeRoots are the directories, relative to the repository root, searched for kustomization packages
+var KustomizeRoots = []string{
+	"awsconfigs",
+	"deployments",
+}
+
+// DiscoverKustomizePackages returns every directory below roots that contains a kustomization.yaml.
+// roots and the returned paths are relative to repoRoot.
+func DiscoverKustomizePackages(repoRoot string, roots []string) ([]string, error) {
+	var packages []string
+	for _, root := range roots {
+		err := filepath.Walk(filepath.Join(repoRoot, root), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || info.Name() != KustomizationFile {
+				return nil
+			}
+			rel, err := filepath.Rel(repoRoot, filepath.Dir(path))
+			if err != nil {
+				return err
+			}
+			packages = append(packages, rel)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(packages)
+	return packages, nil
+}
+
+// kustomizationRefs are the fields of a kustomization that reference other files or packages
+type kustomizationRefs struct {
+	Resources  []string `json:"resources,omitempty"`
+	Bases      []string `json:"bases,omitempty"`
+	Components []string `json:"components,omitempty"`
+}
+
+// RequiresUpstream reports whether the package at rpath, relative to repoRoot, references the
+// upstream kubeflow/manifests checkout either directly or through another package.
+func RequiresUpstream(repoRoot string, rpath string) (bool, error) {
+	upstream, err := filepath.Abs(filepath.Join(repoRoot, UpstreamDir))
+	if err != nil {
+		return false, err
+	}
+	return requiresUpstream(upstream, filepath.Join(repoRoot, rpath), map[string]bool{})
+}
+
+func requiresUpstream(upstream string, dir string, visited map[string]bool) (bool, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false, err
+	}
+	if visited[dir] {
+		return false, nil
+	}
+	visited[dir] = true
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, KustomizationFile))
+	if err != nil {
+		return false, err
+	}
+	refs := &kustomizationRefs{}
+	if err := yaml.Unmarshal(data, refs); err != nil {
+		return false, err
+	}
+
+	for _, ref := range append(append(refs.Resources, refs.Bases...), refs.Components...) {
+		if strings.Contains(ref, "://") || strings.HasPrefix(ref, "github.com/") {
+			// Remote resources are fetched by kustomize
+			continue
+		}
+		path := filepath.Join(dir, ref)
+		if path == upstream || strings.HasPrefix(path, upstream+string(filepath.Separator)) {
+			return true, nil
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(path, KustomizationFile)); err != nil {
+			continue
+		}
+		found, err := requiresUpstream(upstream, path, visited)
+		if err != nil || found {
+			return found, err
+		}
+	}
+	return false, nil
+}
+
+// RootPackages returns the packages that no other of the packages includes as a resource, base or component.
+// packages and the returned paths are relative to repoRoot.
+func RootPackages(repoRoot string, packages []string) ([]string, error) {
+	included := map[string]bool{}
+	for _, rpath := range packages {
+		data, err := ioutil.ReadFile(filepath.Join(repoRoot, rpath, KustomizationFile))
+		if err != nil {
+			return nil, err
+		}
+		refs := &kustomizationRefs{}
+		if err := yaml.Unmarshal(data, refs); err != nil {
+			return nil, fmt.Errorf("could not parse %v; error: %v", filepath.Join(rpath, KustomizationFile), err)
+		}
+		for _, ref := range append(append(refs.Resources, refs.Bases...), refs.Components...) {
+			included[filepath.Join(rpath, ref)] = true
+		}
+	}
+
+	var roots []string
+	for _, rpath := range packages {
+		if !included[filepath.Clean(rpath)] {
+			roots = append(roots, rpath)
+		}
+	}
+	return roots, nil
+}
+
+// HasPackageTest reports whether the package at rpath has its own generated kustomize_test.go
+func HasPackageTest(rpath string) bool {
+	_, err := os.Stat(filepath.Join(rpath, PackageTestFile))
+	return err == nil
+}
+
+// skipWithoutUpstream skips the test if kubeflow/manifests isn't cloned into UpstreamDir, or fails it if
+// REQUIRE_UPSTREAM=1 is set, as in CI, so that tests of the deployment options can't silently stop running
+func skipWithoutUpstream(t *testing.T, what string) {
+	t.Helper()
+	if dirExists(filepath.Join(RepoRoot, UpstreamDir)) {
+		return
+	}
+	if os.Getenv("REQUIRE_UPSTREAM") == "1" {
+		t.Fatalf("%v requires kubeflow/manifests to be cloned into %v, run make upstream", what, UpstreamDir)
+	}
+	t.Skipf("%v requires kubeflow/manifests to be cloned into %v", what, UpstreamDir)
+}
+
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
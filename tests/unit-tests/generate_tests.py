@@ -1,10 +1,13 @@
-"""Regenerate tests for only the files that have changed."""
+"""Regenerate tests for only the files that have changed.
+
+The expected output in test_data/expected is written by running the tests
+in update mode, see "make update".
+"""
 
 import argparse
 import jinja2
 import logging
 import os
-import shutil
 import subprocess
 
 # Search dirs should be directories to search for kustomization packages
@@ -21,11 +24,6 @@ SEARCH_DIRS = [
     "awsconfigs/common"
 ]
 
-# The subdirectory to store the expected manifests in
-# We use a subdirectory of test_data because we could potentially
-# have more than one version of a manifest.
-KUSTOMIZE_OUTPUT_DIR = "test_data/expected"
-
 TEST_NAME = "kustomize_test.go"
 
 
@@ -42,29 +40,6 @@ def generate_test_path(repo_root, kustomize_rpath):
     return test_path
 
 
-def run_kustomize_build(repo_root, package_dir):
-    """Run kustomize build and store the output in the test directory."""
-
-    rpath = os.path.relpath(package_dir, repo_root)
-
-    output_dir = os.path.join(
-        repo_root, "tests/unit-tests", rpath, KUSTOMIZE_OUTPUT_DIR)
-
-    if os.path.exists(output_dir):
-        # Remove any previous version of the directory so that we ensure
-        # that all files in that directory are from the new run
-        # of kustomize build -o
-        logging.info("Removing directory %s", output_dir)
-        shutil.rmtree(output_dir)
-
-    logging.info("Creating directory %s", output_dir)
-    os.makedirs(output_dir)
-
-    subprocess.check_call([os.environ.get("KUSTOMIZE_BIN", "kustomize"), "build", "--load_restrictor", "none",
-                           "-o", output_dir], cwd=os.path.join(repo_root,
-                                                               package_dir))
-
-
 def find_kustomize_dirs(search_dirs):
     """Find all kustomization directories in search_dirs.
 
@@ -149,9 +124,6 @@ if __name__ == "__main__":
         test_path = generate_test_path(repo_root, rpath)
         logging.info("Regenerating test %s for %s ", test_path, full_dir)
 
-        # Generate the kustomize output
-        run_kustomize_build(repo_root, full_dir)
-
         # Create the go test file.
         # TODO(jlewi): We really shouldn't need to redo this if it already
         # exists.
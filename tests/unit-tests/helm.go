@@ -0,0 +1,188 @@
+package tests
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// ChartFile is the file name that marks a directory as a Helm chart
+	ChartFile = "Chart.yaml"
+	// ValuesFixtureFile is the values file, relative to the test directory of a chart, that is merged over
+	// the default values of the chart
+	ValuesFixtureFile = "test_data/values.yaml"
+	// ReleaseName is the release name charts are rendered with, the default of helm template
+	ReleaseName = "release-name"
+	// ReleaseNamespace is the namespace charts are rendered with
+	ReleaseNamespace = "default"
+)
+
+// ChartRoots are the directories, relative to the repository root, searched for Helm charts
+var ChartRoots = []string{
+	"charts",
+}
+
+type HelmTestCase struct {
+	// Chart is the path to the chart directory to render
+	Chart string
+	// Values is an optional path to a values file merged over the values.yaml of the chart
+	Values string
+	// Expected is a path to a directory containing the expected resources
+	Expected string
+	// Compare selects how actual and expected resources are compared; defaults to SemanticCompare
+	Compare CompareMode
+}
+
+// RunHelmTestCase renders the chart of the test case like helm template and compares the resources
+// to the expected resources like RunTestCase. The rendered resources are validated like those of RunTestCase.
+func RunHelmTestCase(t *testing.T, testCase *HelmTestCase) {
+	fmt.Println(testCase.Chart)
+	actual, err := renderChart(testCase.Chart, testCase.Values, false)
+	if err != nil {
+		t.Fatalf("Could not render %v; error: %v", testCase.Chart, err)
+	}
+	validateResources(t, actual)
+	checkIstio(t, actual, false)
+	checkServices(t, actual, false)
+	compareExpected(t, testCase.Expected, actual, testCase.Compare)
+}
+
+// DiscoverCharts returns every directory below roots that contains a Chart.yaml.
+// roots and the returned paths are relative to repoRoot.
+func DiscoverCharts(repoRoot string, roots []string) ([]string, error) {
+	var charts []string
+	for _, root := range roots {
+		err := filepath.Walk(filepath.Join(repoRoot, root), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || info.Name() != ChartFile {
+				return nil
+			}
+			rel, err := filepath.Rel(repoRoot, filepath.Dir(path))
+			if err != nil {
+				return err
+			}
+			charts = append(charts, rel)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(charts)
+	return charts, nil
+}
+
+// renderChart renders the templates of the chart at chartPath with the Helm template engine.
+// valuesFile is merged over the values of the chart unless it is empty. The CRDs in the crds directory
+// are only included if includeCRDs is set, like helm template --include-crds.
+func renderChart(chartPath string, valuesFile string, includeCRDs bool) ([]*builtResource, error) {
+	chrt, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not load chart; error: %v", err)
+	}
+
+	values := chartutil.Values{}
+	if valuesFile != "" {
+		values, err = chartutil.ReadValuesFile(valuesFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read values %v; error: %v", valuesFile, err)
+		}
+	}
+	options := chartutil.ReleaseOptions{
+		Name:      ReleaseName,
+		Namespace: ReleaseNamespace,
+		IsInstall: true,
+	}
+	renderValues, err := chartutil.ToRenderValues(chrt, values, options, chartutil.DefaultCapabilities)
+	if err != nil {
+		return nil, fmt.Errorf("could not compute values; error: %v", err)
+	}
+
+	rendered, err := engine.Render(chrt, renderValues)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(rendered))
+	for name := range rendered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var resources []*builtResource
+	if includeCRDs {
+		for _, crd := range chrt.CRDObjects() {
+			crdResources, err := splitManifests(crd.Filename, string(crd.File.Data))
+			if err != nil {
+				return nil, err
+			}
+			resources = append(resources, crdResources...)
+		}
+	}
+	for _, name := range names {
+		if strings.HasPrefix(path.Base(name), "_") || strings.HasSuffix(name, "NOTES.txt") {
+			continue
+		}
+		templateResources, err := splitManifests(name, rendered[name])
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, templateResources...)
+	}
+	return resources, nil
+}
+
+// splitManifests parses every document of the manifest in the file name
+func splitManifests(name string, manifest string) ([]*builtResource, error) {
+	manifests := releaseutil.SplitManifests(manifest)
+	keys := make([]string, 0, len(manifests))
+	for k := range manifests {
+		keys = append(keys, k)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+	var resources []*builtResource
+	for _, k := range keys {
+		r, err := newRenderedResource(manifests[k])
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %v; error: %v", name, err)
+		}
+		if r != nil {
+			resources = append(resources, r)
+		}
+	}
+	return resources, nil
+}
+
+// newRenderedResource parses a single rendered manifest. It returns nil for documents that only
+// contain whitespace or comments, e.g. templates disabled by a value.
+func newRenderedResource(manifest string) (*builtResource, error) {
+	u := &unstructured.Unstructured{}
+	if err := yaml.Unmarshal([]byte(manifest), &u.Object); err != nil {
+		return nil, err
+	}
+	if len(u.Object) == 0 {
+		return nil, nil
+	}
+	// Normalize the output so that expected files are formatted like the output of kustomize
+	data, err := yaml.Marshal(u.Object)
+	if err != nil {
+		return nil, err
+	}
+	gvk := u.GroupVersionKind()
+	return newBuiltResource(gvk.Group, gvk.Version, gvk.Kind, u.GetNamespace(), u.GetName(), data), nil
+}
@@ -0,0 +1,31 @@
+package tests
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestHelmCharts renders every chart below ChartRoots and compares the output to the expected resources
+// in tests/unit-tests/<chart>/test_data/expected. Values in tests/unit-tests/<chart>/test_data/values.yaml
+// are merged over the values.yaml of the chart.
+func TestHelmCharts(t *testing.T) {
+	charts, err := DiscoverCharts(RepoRoot, ChartRoots)
+	if err != nil {
+		t.Fatalf("Could not discover charts; error: %v", err)
+	}
+
+	for _, rpath := range charts {
+		rpath := rpath
+		t.Run(rpath, func(t *testing.T) {
+			values := filepath.Join(rpath, ValuesFixtureFile)
+			if !fileExists(values) {
+				values = ""
+			}
+			RunHelmTestCase(t, &HelmTestCase{
+				Chart:    filepath.Join(RepoRoot, rpath),
+				Values:   values,
+				Expected: filepath.Join(rpath, ExpectedDir),
+			})
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package tests
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestHelmParity renders each chart declared in the helmify configuration with its default values
+// and compares it to the resources built from its kustomization paths. Intended differences are
+// listed in helm_parity_allowlist.yaml.
+func TestHelmParity(t *testing.T) {
+	charts, err := LoadHelmifyCharts(RepoRoot)
+	if err != nil {
+		t.Fatalf("Could not load charts; error: %v", err)
+	}
+	exceptions, err := loadParityAllowlist(ParityAllowlistFile)
+	if err != nil {
+		t.Fatalf("Could not load allowlist; error: %v", err)
+	}
+
+	tested := map[string]bool{}
+	for _, chart := range charts {
+		chart := chart
+		t.Run(chart.Name, func(t *testing.T) {
+			var built []*builtResource
+			for _, rpath := range chart.KustomizationPaths {
+				upstream := rpath == UpstreamDir || strings.HasPrefix(rpath, UpstreamDir+string(filepath.Separator))
+				if !upstream {
+					var err error
+					if upstream, err = RequiresUpstream(RepoRoot, rpath); err != nil {
+						t.Fatalf("Could not read %v; error: %v", rpath, err)
+					}
+				}
+				if upstream && !dirExists(filepath.Join(RepoRoot, UpstreamDir)) {
+					t.Skipf("%v requires kubeflow/manifests to be cloned into %v", rpath, UpstreamDir)
+				}
+				built = append(built, buildPackage(t, filepath.Join(RepoRoot, rpath), KrustyEngine)...)
+			}
+
+			rendered, err := renderChart(filepath.Join(RepoRoot, chart.Chart), "", true)
+			if err != nil {
+				t.Fatalf("Could not render %v; error: %v", chart.Chart, err)
+			}
+			tested[chart.Chart] = true
+
+			differences, err := compareParity(chart.Chart, built, rendered, exceptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, d := range differences {
+				t.Errorf("Chart %v and its kustomizations diverge for resource %v: %v", chart.Chart, d.Resource, d.Message)
+			}
+		})
+	}
+
+	for _, e := range exceptions {
+		if tested[e.Chart] && !e.used {
+			t.Errorf("Allowlist entry for %v in %v matches no difference; remove it", e.Resource, e.Chart)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// ImagePolicyFile lists the registries images may be pulled from and the images that may float
+	ImagePolicyFile = "image_policy.yaml"
+	// ImagesFile is the file, relative to the test directory of a deployment option, listing the images it pulls
+	ImagesFile = "test_data/images.txt"
+	// defaultRegistry is the registry of images without one
+	defaultRegistry = "docker.io"
+)
+
+// ImagePolicy is the policy container images of built resources must follow
+type ImagePolicy struct {
+	// Registries are the registries images may be pulled from, which air-gapped installations need to mirror
+	Registries []*AllowedRegistry `json:"registries"`
+	// Floating are the images that may use the latest tag or no tag
+	Floating []*FloatingImage `json:"floating,omitempty"`
+}
+
+// AllowedRegistry is a registry images may be pulled from
+type AllowedRegistry struct {
+	// Registry is the host of the registry, e.g. public.ecr.aws
+	Registry string `json:"registry"`
+	// Reason explains what the registry hosts
+	Reason string `json:"reason"`
+}
+
+// FloatingImage allows images to use the latest tag or no tag
+type FloatingImage struct {
+	// Image matches the full form of an image, e.g. docker.io/prom/prometheus
+	Image string `json:"image"`
+	// Reason explains why the image can't be pinned
+	Reason string `json:"reason"`
+}
+
+func (r *AllowedRegistry) validate() error {
+	if r.Registry == "" || r.Reason == "" {
+		return errors.New("needs a registry and a reason")
+	}
+	return nil
+}
+
+func (f *FloatingImage) validate() error {
+	if f.Image == "" || f.Reason == "" {
+		return errors.New("needs an image and a reason")
+	}
+	return nil
+}
+
+// loadImagePolicy reads the policy in path
+func loadImagePolicy(path string) (*ImagePolicy, error) {
+	policy := &ImagePolicy{}
+	if err := loadAllowlist(path, policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// imageReference is a parsed container image, e.g. docker.io/library/python:3.7
+type imageReference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// parseImage parses an image like the container runtime does. An image without a registry is pulled from
+// docker.io, and from its library if it has no repository path either.
+func parseImage(image string) imageReference {
+	ref := imageReference{Registry: defaultRegistry}
+	rest := image
+	if i := strings.Index(rest, "@"); i >= 0 {
+		ref.Digest = rest[i+1:]
+		rest = rest[:i]
+	}
+	// A tag follows the last colon, unless the colon is the port of the registry
+	if i := strings.LastIndex(rest, ":"); i > strings.LastIndex(rest, "/") {
+		ref.Tag = rest[i+1:]
+		rest = rest[:i]
+	}
+	if i := strings.Index(rest, "/"); i >= 0 && (strings.ContainsAny(rest[:i], ".:") || rest[:i] == "localhost") {
+		ref.Registry = rest[:i]
+		rest = rest[i+1:]
+	} else if i < 0 {
+		rest = "library/" + rest
+	}
+	ref.Repository = rest
+	return ref
+}
+
+func (r imageReference) String() string {
+	s := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// ContainerImage is the image of a container of a built resource
+type ContainerImage struct {
+	Resource string
+	// Path is the path of the image field, e.g. spec.template.spec.containers[0].image
+	Path  string
+	Image imageReference
+}
+
+// collectImages returns the images of every container, init container and ephemeral container in the
+// resources. Besides the pod templates of workloads this includes the containers of custom resources, like
+// the runtimes of KServe.
+func collectImages(resources []*builtResource) ([]*ContainerImage, error) {
+	var images []*ContainerImage
+	for _, r := range resources {
+		object := map[string]interface{}{}
+		if err := yaml.Unmarshal(r.yaml, &object); err != nil {
+			return nil, fmt.Errorf("could not parse resource %v; error: %v", r.Key(), err)
+		}
+		var walk func(path string, value interface{})
+		walk = func(path string, value interface{}) {
+			switch v := value.(type) {
+			case map[string]interface{}:
+				keys := make([]string, 0, len(v))
+				for k := range v {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+				for _, k := range keys {
+					walk(fieldPath(path, k), v[k])
+					if !isContainerField(k) {
+						continue
+					}
+					containers, _ := v[k].([]interface{})
+					for i, c := range containers {
+						container, _ := c.(map[string]interface{})
+						if image, ok := container["image"].(string); ok && image != "" {
+							images = append(images, &ContainerImage{
+								Resource: r.Key(),
+								Path:     fmt.Sprintf("%s[%d].image", fieldPath(path, k), i),
+								Image:    parseImage(image),
+							})
+						}
+					}
+				}
+			case []interface{}:
+				for i, e := range v {
+					walk(fmt.Sprintf("%s[%d]", path, i), e)
+				}
+			}
+		}
+		walk("", object)
+	}
+	return images, nil
+}
+
+func isContainerField(field string) bool {
+	for _, f := range containerFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// checkImagePolicy returns a message for every image that is pulled from a registry that isn't allowed, and
+// for every image that uses the latest tag or no tag and no digest and isn't allowed to float
+func checkImagePolicy(images []*ContainerImage, policy *ImagePolicy) []string {
+	registries := map[string]bool{}
+	for _, r := range policy.Registries {
+		registries[r.Registry] = true
+	}
+
+	var messages []string
+	for _, i := range images {
+		if !registries[i.Image.Registry] {
+			messages = append(messages, fmt.Sprintf("Resource %v pulls %v at %v from %v, which isn't an allowed registry in %v",
+				i.Resource, i.Image, i.Path, i.Image.Registry, ImagePolicyFile))
+		}
+		if i.Image.Digest != "" || (i.Image.Tag != "" && i.Image.Tag != "latest") {
+			continue
+		}
+		floating := false
+		for _, f := range policy.Floating {
+			floating = floating || matchPattern(f.Image, i.Image.String())
+		}
+		if !floating {
+			messages = append(messages, fmt.Sprintf("Resource %v pulls %v at %v, which isn't pinned to a tag or a digest; pin it or add it to the floating images in %v",
+				i.Resource, i.Image, i.Path, ImagePolicyFile))
+		}
+	}
+	return messages
+}
+
+// imageList returns the unique images, one per line and sorted, e.g. to mirror them with skopeo
+func imageList(images []*ContainerImage) []byte {
+	unique := map[string]bool{}
+	for _, i := range images {
+		unique[i.Image.String()] = true
+	}
+	list := make([]string, 0, len(unique))
+	for image := range unique {
+		list = append(list, image)
+	}
+	sort.Strings(list)
+
+	var b bytes.Buffer
+	for _, image := range list {
+		fmt.Fprintln(&b, image)
+	}
+	return b.Bytes()
+}
+
+// diffImageList returns the images added to and removed from the expected image list, sorted
+func diffImageList(actual []byte, expected []byte) []string {
+	lines := func(data []byte) map[string]bool {
+		set := map[string]bool{}
+		for _, l := range strings.Split(string(data), "\n") {
+			if l = strings.TrimSpace(l); l != "" {
+				set[l] = true
+			}
+		}
+		return set
+	}
+	actualSet, expectedSet := lines(actual), lines(expected)
+
+	var changes []string
+	for image := range actualSet {
+		if !expectedSet[image] {
+			changes = append(changes, "added: "+image)
+		}
+	}
+	for image := range expectedSet {
+		if !actualSet[image] {
+			changes = append(changes, "removed: "+image)
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+var (
+	defaultImagePolicyOnce sync.Once
+	defaultImagePolicy     *ImagePolicy
+	defaultImagePolicyErr  error
+)
+
+// checkImages fails the test for every image of the resources that violates ImagePolicyFile, see checkImagePolicy
+func checkImages(t *testing.T, resources []*builtResource) {
+	t.Helper()
+	defaultImagePolicyOnce.Do(func() {
+		defaultImagePolicy, defaultImagePolicyErr = loadImagePolicy(filepath.Join(unitTestsDir(), ImagePolicyFile))
+	})
+	if defaultImagePolicyErr != nil {
+		t.Fatalf("Could not load %v; error: %v", ImagePolicyFile, defaultImagePolicyErr)
+	}
+
+	images, err := collectImages(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range checkImagePolicy(images, defaultImagePolicy) {
+		t.Error(m)
+	}
+}
@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseImage(t *testing.T) {
+	testCases := map[string]imageReference{
+		"python:3.7":      {Registry: "docker.io", Repository: "library/python", Tag: "3.7"},
+		"prom/prometheus": {Registry: "docker.io", Repository: "prom/prometheus"},
+		"public.ecr.aws/xray/aws-xray-daemon:latest": {Registry: "public.ecr.aws", Repository: "xray/aws-xray-daemon", Tag: "latest"},
+		"localhost:5000/app:v1":                      {Registry: "localhost:5000", Repository: "app", Tag: "v1"},
+		"localhost/app":                              {Registry: "localhost", Repository: "app"},
+		"gcr.io/knative-releases/knative.dev/serving/cmd/activator@sha256:c3bb": {
+			Registry: "gcr.io", Repository: "knative-releases/knative.dev/serving/cmd/activator", Digest: "sha256:c3bb",
+		},
+		"ghcr.io/dexidp/dex:v2.31.2@sha256:abcd": {Registry: "ghcr.io", Repository: "dexidp/dex", Tag: "v2.31.2", Digest: "sha256:abcd"},
+	}
+	for image, expected := range testCases {
+		if actual := parseImage(image); actual != expected {
+			t.Errorf("%v: got %+v; want %+v", image, actual, expected)
+		}
+	}
+	if actual := parseImage("python:3.7").String(); actual != "docker.io/library/python:3.7" {
+		t.Errorf("got %v; want docker.io/library/python:3.7", actual)
+	}
+}
+
+func TestCheckImagePolicy(t *testing.T) {
+	resources := []*builtResource{
+		newBuiltResource("apps", "v1", "Deployment", "kubeflow", "app", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: busybox
+      containers:
+      - name: app
+        image: public.ecr.aws/app/app:v1.0.0
+      - name: sidecar
+        image: quay.io/sidecar:latest
+`)),
+		newBuiltResource("serving.kserve.io", "v1alpha1", "ClusterServingRuntime", "", "runtime", []byte(`apiVersion: serving.kserve.io/v1alpha1
+kind: ClusterServingRuntime
+metadata:
+  name: runtime
+spec:
+  containers:
+  - name: kserve-container
+    image: kserve/sklearnserver@sha256:abcd
+`)),
+	}
+	images, err := collectImages(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedList := `docker.io/kserve/sklearnserver@sha256:abcd
+docker.io/library/busybox
+public.ecr.aws/app/app:v1.0.0
+quay.io/sidecar:latest
+`
+	if actual := string(imageList(images)); actual != expectedList {
+		t.Errorf("got image list\n%v\nwant\n%v", actual, expectedList)
+	}
+
+	policy := &ImagePolicy{
+		Registries: []*AllowedRegistry{
+			{Registry: "public.ecr.aws", Reason: "AWS"},
+			{Registry: "docker.io", Reason: "Docker Hub"},
+		},
+		Floating: []*FloatingImage{{Image: "docker.io/library/busybox*", Reason: "debugging"}},
+	}
+	expected := []string{
+		"Resource apps/v1 Deployment kubeflow/app pulls quay.io/sidecar:latest at spec.template.spec.containers[1].image from quay.io, which isn't an allowed registry in " + ImagePolicyFile,
+		"Resource apps/v1 Deployment kubeflow/app pulls quay.io/sidecar:latest at spec.template.spec.containers[1].image, which isn't pinned to a tag or a digest; pin it or add it to the floating images in " + ImagePolicyFile,
+	}
+	if actual := checkImagePolicy(images, policy); strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got\n%v\nwant\n%v", strings.Join(actual, "\n"), strings.Join(expected, "\n"))
+	}
+
+	expectedChanges := []string{"added: quay.io/sidecar:latest", "removed: quay.io/sidecar:v1"}
+	changes := diffImageList(imageList(images), []byte(strings.Replace(expectedList, "sidecar:latest", "sidecar:v1", 1)))
+	if strings.Join(changes, "\n") != strings.Join(expectedChanges, "\n") {
+		t.Errorf("got changes %v; want %v", changes, expectedChanges)
+	}
+}
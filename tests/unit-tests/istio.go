@@ -0,0 +1,396 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// istioGroup is the API group of VirtualServices and Gateways
+	istioGroup = "networking.istio.io"
+	// istioRootNamespace is the root namespace of the mesh, whose EnvoyFilters and AuthorizationPolicies apply to
+	// the workloads of every namespace
+	istioRootNamespace = "istio-system"
+	// clusterDomain is the suffix of the fully qualified host names of Services
+	clusterDomain = ".svc.cluster.local"
+	// IstioAllowlistFile lists the references of the Istio resources of packages and charts that another
+	// component resolves
+	IstioAllowlistFile = "istio_allowlist.yaml"
+)
+
+// IstioException allows the Istio resources of a package or chart to reference gateways, hosts or workloads that
+// aren't in its build
+type IstioException struct {
+	// Resource matches the key of the resource, e.g. "networking.istio.io/v1alpha3 VirtualService kubeflow/*"
+	Resource string `json:"resource"`
+	// References match the references of the resource, see IstioIssue
+	References []string `json:"references"`
+	// Reason names the component that deploys the referenced resource
+	Reason string `json:"reason"`
+}
+
+func (e *IstioException) validate() error {
+	if e.Resource == "" || len(e.References) == 0 || e.Reason == "" {
+		return errors.New("needs a resource, references and a reason")
+	}
+	return nil
+}
+
+// loadIstioAllowlist reads the exceptions in path
+func loadIstioAllowlist(path string) ([]*IstioException, error) {
+	var exceptions []*IstioException
+	if err := loadAllowlist(path, &exceptions); err != nil {
+		return nil, err
+	}
+	return exceptions, nil
+}
+
+// IstioIssue is a reference of an Istio resource that doesn't resolve in a build
+type IstioIssue struct {
+	// Resource is the key of the Istio resource
+	Resource string
+	// Reference is the namespace/name of a gateway, the namespace/name of a destination Service followed by
+	// :<port> for a port, or the key=value pairs of a workload selector, e.g. istio=ingressgateway
+	Reference string
+	Message   string
+}
+
+// service is a Service of a build
+type service struct {
+	resource *builtResource
+	selector map[string]string
+	ports    []servicePort
+}
+
+// servicePort is a port of a Service; targetPort is a number or the name of a container port
+type servicePort struct {
+	name       string
+	port       int
+	targetPort string
+}
+
+// parseService returns the selector and ports of a Service
+func parseService(r *builtResource) (*service, error) {
+	object := struct {
+		Spec struct {
+			Selector map[string]string `json:"selector,omitempty"`
+			Ports    []struct {
+				Name       string      `json:"name,omitempty"`
+				Port       int         `json:"port"`
+				TargetPort interface{} `json:"targetPort,omitempty"`
+			} `json:"ports,omitempty"`
+		} `json:"spec"`
+	}{}
+	if err := yaml.Unmarshal(r.yaml, &object); err != nil {
+		return nil, fmt.Errorf("could not parse resource %v; error: %v", r.Key(), err)
+	}
+	s := &service{resource: r, selector: object.Spec.Selector}
+	for _, p := range object.Spec.Ports {
+		targetPort := fmt.Sprint(p.Port)
+		if p.TargetPort != nil {
+			targetPort = fmt.Sprint(p.TargetPort)
+		}
+		s.ports = append(s.ports, servicePort{name: p.Name, port: p.Port, targetPort: targetPort})
+	}
+	return s, nil
+}
+
+// workload is a resource with a pod template, or a pod
+type workload struct {
+	resource *builtResource
+	template *podTemplate
+}
+
+// matches reports whether the labels of the pod template match every label of the selector
+func (w *workload) matches(selector map[string]string) bool {
+	return matchLabels(selector, w.template.labels())
+}
+
+// buildIndex holds the resources of a build that other resources reference
+type buildIndex struct {
+	// keys are the keys of the resources by kind, namespace/name
+	keys           map[string]bool
+	services       map[string]*service
+	workloads      []*workload
+	serviceEntries map[string]bool
+}
+
+// newBuildIndex indexes the resources of a build
+func newBuildIndex(resources []*builtResource) (*buildIndex, error) {
+	index := &buildIndex{keys: map[string]bool{}, services: map[string]*service{}, serviceEntries: map[string]bool{}}
+	for _, r := range resources {
+		index.keys[r.kind+" "+r.namespace+"/"+r.name] = true
+		switch {
+		case r.group == "" && r.kind == "Service":
+			s, err := parseService(r)
+			if err != nil {
+				return nil, err
+			}
+			index.services[r.namespace+"/"+r.name] = s
+		case r.group == istioGroup && r.kind == "ServiceEntry":
+			object := struct {
+				Spec struct {
+					Hosts []string `json:"hosts,omitempty"`
+				} `json:"spec"`
+			}{}
+			if err := yaml.Unmarshal(r.yaml, &object); err != nil {
+				return nil, fmt.Errorf("could not parse resource %v; error: %v", r.Key(), err)
+			}
+			for _, h := range object.Spec.Hosts {
+				index.serviceEntries[h] = true
+			}
+		default:
+			p, err := parsePodTemplate(r)
+			if err != nil {
+				return nil, err
+			}
+			if p != nil {
+				index.workloads = append(index.workloads, &workload{resource: r, template: p})
+			}
+		}
+	}
+	return index, nil
+}
+
+// has reports whether the build has a resource of the kind
+func (i *buildIndex) has(kind string, namespace string, name string) bool {
+	return i.keys[kind+" "+namespace+"/"+name]
+}
+
+// selects reports whether a workload in the namespace, or in any namespace if it is "", matches the selector
+func (i *buildIndex) selects(namespace string, selector map[string]string) bool {
+	for _, w := range i.workloads {
+		if (namespace == "" || w.resource.namespace == namespace) && w.matches(selector) {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceHost returns the namespace/name of the Service a host of a route refers to, resolving short names
+// relative to namespace like Istio, or "" for hosts outside of the cluster
+func serviceHost(host string, namespace string) string {
+	if strings.HasSuffix(host, clusterDomain) {
+		parts := strings.Split(strings.TrimSuffix(host, clusterDomain), ".")
+		if len(parts) == 2 {
+			return parts[1] + "/" + parts[0]
+		}
+		return ""
+	}
+	if !strings.Contains(host, ".") {
+		return namespace + "/" + host
+	}
+	return ""
+}
+
+// checkIstioReferences returns an issue for every reference of an Istio resource that doesn't resolve in a build:
+//   - gateways of VirtualServices that aren't Gateways of the build; mesh is the sidecars of the mesh
+//   - destination hosts of VirtualServices that aren't Services of the build, unless a ServiceEntry declares them,
+//     and destination ports that the Service doesn't expose. Hosts outside of the cluster aren't checked.
+//   - workload selectors of Gateways, EnvoyFilters and AuthorizationPolicies that match no pod template of the
+//     build. Gateways select pods in every namespace, and so do policies in the root namespace of the mesh.
+//
+// Since the references cross components, a package or chart only resolves those of IstioAllowlistFile against the
+// build of a deployment option.
+func checkIstioReferences(resources []*builtResource) ([]*IstioIssue, error) {
+	index, err := newBuildIndex(resources)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []*IstioIssue
+	for _, r := range resources {
+		var selectorPath []string
+		selectorNamespace := r.namespace
+		switch {
+		case r.group == istioGroup && r.kind == "VirtualService":
+		case r.group == istioGroup && r.kind == "Gateway":
+			selectorPath, selectorNamespace = []string{"spec", "selector"}, ""
+		case r.group == istioGroup && r.kind == "EnvoyFilter":
+			selectorPath = []string{"spec", "workloadSelector", "labels"}
+		case r.group == "security.istio.io" && r.kind == "AuthorizationPolicy":
+			selectorPath = []string{"spec", "selector", "matchLabels"}
+		default:
+			continue
+		}
+		object := map[string]interface{}{}
+		if err := yaml.Unmarshal(r.yaml, &object); err != nil {
+			return nil, fmt.Errorf("could not parse resource %v; error: %v", r.Key(), err)
+		}
+		if r.kind == "VirtualService" {
+			issues = append(issues, checkVirtualService(r, object, index)...)
+			continue
+		}
+		if selectorNamespace == istioRootNamespace {
+			selectorNamespace = ""
+		}
+		labels, _ := nested(object, selectorPath...).(map[string]interface{})
+		if len(labels) == 0 {
+			continue
+		}
+		selector := map[string]string{}
+		for k, v := range labels {
+			selector[k] = fmt.Sprint(v)
+		}
+		if !index.selects(selectorNamespace, selector) {
+			issues = append(issues, &IstioIssue{
+				Resource:  r.Key(),
+				Reference: formatLabels(selector),
+				Message: fmt.Sprintf("Resource %v selects workloads with %v at %v, which match no pod template in the build",
+					r.Key(), formatLabels(selector), strings.Join(selectorPath, ".")),
+			})
+		}
+	}
+	return issues, nil
+}
+
+// checkVirtualService returns an issue for every gateway, destination host and destination port of a
+// VirtualService that doesn't resolve, see checkIstioReferences
+func checkVirtualService(r *builtResource, object map[string]interface{}, index *buildIndex) []*IstioIssue {
+	var issues []*IstioIssue
+	checkGateways := func(path string, gateways interface{}) {
+		list, _ := gateways.([]interface{})
+		for i, g := range list {
+			gateway, _ := g.(string)
+			if gateway == "" || gateway == "mesh" {
+				continue
+			}
+			namespace, name := r.namespace, gateway
+			if i := strings.Index(gateway, "/"); i >= 0 {
+				namespace, name = gateway[:i], gateway[i+1:]
+			}
+			if !index.has("Gateway", namespace, name) {
+				issues = append(issues, &IstioIssue{
+					Resource:  r.Key(),
+					Reference: namespace + "/" + name,
+					Message: fmt.Sprintf("Resource %v references gateway %v at %v[%d], which isn't in the build",
+						r.Key(), gateway, path, i),
+				})
+			}
+		}
+	}
+	checkDestination := func(path string, destination interface{}) {
+		d, ok := destination.(map[string]interface{})
+		if !ok {
+			return
+		}
+		host, _ := d["host"].(string)
+		if host == "" || index.serviceEntries[host] {
+			return
+		}
+		key := serviceHost(host, r.namespace)
+		if key == "" {
+			return
+		}
+		s, found := index.services[key]
+		if !found {
+			issues = append(issues, &IstioIssue{
+				Resource:  r.Key(),
+				Reference: key,
+				Message: fmt.Sprintf("Resource %v routes to %v at %v.host, which isn't a Service in the build",
+					r.Key(), host, path),
+			})
+			return
+		}
+		number, isNumber := nested(d, "port", "number").(float64)
+		if !isNumber {
+			return
+		}
+		for _, p := range s.ports {
+			if p.port == int(number) {
+				return
+			}
+		}
+		issues = append(issues, &IstioIssue{
+			Resource:  r.Key(),
+			Reference: fmt.Sprintf("%v:%d", key, int(number)),
+			Message: fmt.Sprintf("Resource %v routes to port %v of %v at %v.port.number, which the Service doesn't expose",
+				r.Key(), int(number), host, path),
+		})
+	}
+
+	checkGateways("spec.gateways", nested(object, "spec", "gateways"))
+	for _, protocol := range []string{"http", "tcp", "tls"} {
+		routes, _ := nested(object, "spec", protocol).([]interface{})
+		for i, e := range routes {
+			route, _ := e.(map[string]interface{})
+			path := fmt.Sprintf("spec.%s[%d]", protocol, i)
+			matches, _ := nested(route, "match").([]interface{})
+			for j, m := range matches {
+				match, _ := m.(map[string]interface{})
+				checkGateways(fmt.Sprintf("%s.match[%d].gateways", path, j), match["gateways"])
+			}
+			destinations, _ := nested(route, "route").([]interface{})
+			for j, d := range destinations {
+				destination, _ := d.(map[string]interface{})
+				checkDestination(fmt.Sprintf("%s.route[%d].destination", path, j), destination["destination"])
+			}
+			if mirror, ok := route["mirror"]; ok {
+				checkDestination(path+".mirror", mirror)
+			}
+		}
+	}
+	return issues
+}
+
+// formatLabels returns the labels as sorted key=value pairs
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+var (
+	defaultIstioAllowlistOnce sync.Once
+	defaultIstioAllowlist     []*IstioException
+	defaultIstioAllowlistErr  error
+)
+
+// checkIstio fails the test for every reference of an Istio resource that doesn't resolve, see
+// checkIstioReferences. The resources of a package or chart may reference the gateways, Services and workloads of
+// other components that are listed in IstioAllowlistFile, while a deployment option has to resolve every reference.
+func checkIstio(t *testing.T, resources []*builtResource, deployment bool) {
+	t.Helper()
+	defaultIstioAllowlistOnce.Do(func() {
+		defaultIstioAllowlist, defaultIstioAllowlistErr = loadIstioAllowlist(filepath.Join(unitTestsDir(), IstioAllowlistFile))
+	})
+	if defaultIstioAllowlistErr != nil {
+		t.Fatalf("Could not load %v; error: %v", IstioAllowlistFile, defaultIstioAllowlistErr)
+	}
+
+	issues, err := checkIstioReferences(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !deployment {
+		issues = filterIstioIssues(issues, defaultIstioAllowlist)
+	}
+	for _, i := range issues {
+		t.Error(i.Message)
+	}
+}
+
+// filterIstioIssues returns the issues that none of the exceptions allows
+func filterIstioIssues(issues []*IstioIssue, exceptions []*IstioException) []*IstioIssue {
+	var remaining []*IstioIssue
+	for _, i := range issues {
+		allowed := false
+		for _, e := range exceptions {
+			allowed = allowed || (matchPattern(e.Resource, i.Resource) && matchAny(e.References, i.Reference))
+		}
+		if !allowed {
+			remaining = append(remaining, i)
+		}
+	}
+	return remaining
+}
@@ -0,0 +1,180 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckIstioReferences(t *testing.T) {
+	resources := []*builtResource{
+		newBuiltResource("networking.istio.io", "v1alpha3", "Gateway", "kubeflow", "kubeflow-gateway", []byte(`apiVersion: networking.istio.io/v1alpha3
+kind: Gateway
+metadata:
+  name: kubeflow-gateway
+  namespace: kubeflow
+spec:
+  selector:
+    istio: ingressgateway
+`)),
+		newBuiltResource("apps", "v1", "Deployment", "istio-system", "istio-ingressgateway", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: istio-ingressgateway
+  namespace: istio-system
+spec:
+  template:
+    metadata:
+      labels:
+        app: istio-ingressgateway
+        istio: ingressgateway
+`)),
+		newBuiltResource("", "v1", "Service", "istio-system", "aws-authservice", []byte(`apiVersion: v1
+kind: Service
+metadata:
+  name: aws-authservice
+  namespace: istio-system
+spec:
+  selector:
+    app: aws-authservice
+  ports:
+  - name: http-api
+    port: 8082
+    targetPort: http-api
+`)),
+		newBuiltResource("networking.istio.io", "v1alpha3", "ServiceEntry", "istio-system", "cognito", []byte(`apiVersion: networking.istio.io/v1alpha3
+kind: ServiceEntry
+metadata:
+  name: cognito
+  namespace: istio-system
+spec:
+  hosts:
+  - cognito
+`)),
+		newBuiltResource("networking.istio.io", "v1alpha3", "VirtualService", "istio-system", "authservice", []byte(`apiVersion: networking.istio.io/v1alpha3
+kind: VirtualService
+metadata:
+  name: authservice
+  namespace: istio-system
+spec:
+  gateways:
+  - kubeflow/kubeflow-gateway
+  - mesh
+  - missing-gateway
+  hosts:
+  - '*'
+  http:
+  - match:
+    - uri:
+        prefix: /authservice
+      gateways:
+      - kubeflow/other-gateway
+    route:
+    - destination:
+        host: aws-authservice.istio-system.svc.cluster.local
+        port:
+          number: 8082
+    - destination:
+        host: aws-authservice
+        port:
+          number: 8080
+    mirror:
+      host: renamed.istio-system.svc.cluster.local
+  - route:
+    - destination:
+        host: cognito
+    - destination:
+        host: cognito-idp.us-west-2.amazonaws.com
+`)),
+		newBuiltResource("networking.istio.io", "v1alpha3", "EnvoyFilter", "istio-system", "authn-filter", []byte(`apiVersion: networking.istio.io/v1alpha3
+kind: EnvoyFilter
+metadata:
+  name: authn-filter
+  namespace: istio-system
+spec:
+  workloadSelector:
+    labels:
+      istio: ingressgateway
+`)),
+		newBuiltResource("security.istio.io", "v1beta1", "AuthorizationPolicy", "kubeflow", "ml-pipeline", []byte(`apiVersion: security.istio.io/v1beta1
+kind: AuthorizationPolicy
+metadata:
+  name: ml-pipeline
+  namespace: kubeflow
+spec:
+  selector:
+    matchLabels:
+      app: ml-pipeline
+`)),
+	}
+
+	expected := []string{
+		"Resource networking.istio.io/v1alpha3 VirtualService istio-system/authservice references gateway missing-gateway at spec.gateways[2], which isn't in the build",
+		"Resource networking.istio.io/v1alpha3 VirtualService istio-system/authservice references gateway kubeflow/other-gateway at spec.http[0].match[0].gateways[0], which isn't in the build",
+		"Resource networking.istio.io/v1alpha3 VirtualService istio-system/authservice routes to port 8080 of aws-authservice at spec.http[0].route[1].destination.port.number, which the Service doesn't expose",
+		"Resource networking.istio.io/v1alpha3 VirtualService istio-system/authservice routes to renamed.istio-system.svc.cluster.local at spec.http[0].mirror.host, which isn't a Service in the build",
+		"Resource security.istio.io/v1beta1 AuthorizationPolicy kubeflow/ml-pipeline selects workloads with app=ml-pipeline at spec.selector.matchLabels, which match no pod template in the build",
+	}
+	issues, err := checkIstioReferences(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual []string
+	for _, i := range issues {
+		actual = append(actual, i.Message)
+	}
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got\n%v\nwant\n%v", strings.Join(actual, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestFilterIstioIssues(t *testing.T) {
+	exceptions, err := loadIstioAllowlist(IstioAllowlistFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources := []*builtResource{
+		newBuiltResource(istioGroup, "v1alpha3", "VirtualService", "kubeflow", "app", []byte(`apiVersion: networking.istio.io/v1alpha3
+kind: VirtualService
+metadata:
+  name: app
+  namespace: kubeflow
+spec:
+  gateways:
+  - kubeflow-gateway
+  - kubeflow-gatway
+  hosts:
+  - '*'
+`)),
+		newBuiltResource(istioGroup, "v1alpha3", "Gateway", "kubeflow", "kubeflow-gateway", []byte(`apiVersion: networking.istio.io/v1alpha3
+kind: Gateway
+metadata:
+  name: kubeflow-gateway
+  namespace: kubeflow
+spec:
+  selector:
+    istio: ingress-gateway
+`)),
+	}
+
+	// The VirtualService and the Gateway are built as separate packages. The allowlist resolves the gateway and
+	// the pods that other components deploy, but not the misspelled references.
+	expected := []string{
+		"Resource networking.istio.io/v1alpha3 VirtualService kubeflow/app references gateway kubeflow-gatway at spec.gateways[1], which isn't in the build",
+		"Resource networking.istio.io/v1alpha3 Gateway kubeflow/kubeflow-gateway selects workloads with istio=ingress-gateway at spec.selector, which match no pod template in the build",
+	}
+	issues, err := checkIstioReferences(resources[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	gatewayIssues, err := checkIstioReferences(resources[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual []string
+	for _, i := range filterIstioIssues(append(issues, gatewayIssues...), exceptions) {
+		actual = append(actual, i.Message)
+	}
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got\n%v\nwant\n%v", strings.Join(actual, "\n"), strings.Join(expected, "\n"))
+	}
+}
@@ -0,0 +1,40 @@
+package tests
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestKustomizePackages builds every kustomization package below KustomizeRoots and compares the
+// output to the expected resources in tests/unit-tests/<package>/test_data/expected.
+// Packages with their own kustomize_test.go are left to that test and DeploymentOptions to TestDeployments.
+func TestKustomizePackages(t *testing.T) {
+	packages, err := DiscoverKustomizePackages(RepoRoot, KustomizeRoots)
+	if err != nil {
+		t.Fatalf("Could not discover kustomization packages; error: %v", err)
+	}
+
+	for _, rpath := range packages {
+		rpath := rpath
+		t.Run(rpath, func(t *testing.T) {
+			if HasPackageTest(rpath) {
+				t.Skipf("%v is tested by its own %v", rpath, PackageTestFile)
+			}
+			if IsDeploymentOption(rpath) {
+				t.Skipf("%v is tested by TestDeployments", rpath)
+			}
+			upstream, err := RequiresUpstream(RepoRoot, rpath)
+			if err != nil {
+				t.Fatalf("Could not read %v; error: %v", rpath, err)
+			}
+			if upstream && !dirExists(filepath.Join(RepoRoot, UpstreamDir)) {
+				t.Skipf("%v requires kubeflow/manifests to be cloned into %v", rpath, UpstreamDir)
+			}
+
+			RunTestCase(t, &KustomizeTestCase{
+				Package:  filepath.Join(RepoRoot, rpath),
+				Expected: filepath.Join(rpath, ExpectedDir),
+			})
+		})
+	}
+}
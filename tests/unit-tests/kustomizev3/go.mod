@@ -0,0 +1,5 @@
+module github.com/kubeflow/manifests/tests/kustomizev3
+
+go 1.13
+
+require sigs.k8s.io/kustomize/v3 v3.2.0
@@ -0,0 +1,64 @@
+// Command kustomizev3 builds a kustomization with sigs.k8s.io/kustomize/v3 v3.2.0 and writes the resources
+// to stdout, separated by ---. It is a module of its own because kustomize v3 doesn't compile against the
+// k8s.io/kube-openapi of the current kustomize engine, see V3Engine of the tests.
+//
+//	go run . <kustomization directory>
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/kustomize/v3/k8sdeps/kunstruct"
+	"sigs.k8s.io/kustomize/v3/k8sdeps/transformer"
+	"sigs.k8s.io/kustomize/v3/pkg/fs"
+	"sigs.k8s.io/kustomize/v3/pkg/loader"
+	"sigs.k8s.io/kustomize/v3/pkg/plugins"
+	"sigs.k8s.io/kustomize/v3/pkg/resmap"
+	"sigs.k8s.io/kustomize/v3/pkg/resource"
+	"sigs.k8s.io/kustomize/v3/pkg/target"
+	"sigs.k8s.io/kustomize/v3/pkg/validators"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: kustomizev3 <kustomization directory>")
+		os.Exit(2)
+	}
+	if err := build(os.Args[1]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func build(pkg string) error {
+	fsys := fs.MakeRealFS()
+	// We don't want to enforce the security check.
+	// This is equivalent to running:
+	// kustomize build --load_restrictor none
+	lrc := loader.RestrictionNone
+
+	_loader, err := loader.NewLoader(lrc, validators.MakeFakeValidator(), pkg, fsys)
+	if err != nil {
+		return fmt.Errorf("could not load kustomize loader: %v", err)
+	}
+	rf := resmap.NewFactory(resource.NewFactory(kunstruct.NewKunstructuredFactoryImpl()), transformer.NewFactoryImpl())
+	pc := plugins.DefaultPluginConfig()
+	kt, err := target.NewKustTarget(_loader, rf, transformer.NewFactoryImpl(), plugins.NewLoader(pc, rf))
+	if err != nil {
+		return fmt.Errorf("unexpected construction error %v", err)
+	}
+	m, err := kt.MakeCustomizedResMap()
+	if err != nil {
+		return err
+	}
+
+	for _, r := range m.Resources() {
+		data, err := r.AsYAML()
+		if err != nil {
+			return fmt.Errorf("could not generate YAML for resource %v; error: %v", r.CurId(), err)
+		}
+		fmt.Printf("---\n%s", data)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+// Package manifests loads every YAML document of the repository once, with the file and line it comes from,
+// so that conventions can be checked against the documents without walking the tree in every test.
+package manifests
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// Document is a YAML document in a file of the repository
+type Document struct {
+	// Path is the slash separated path of the file relative to the repository root
+	Path string
+	// Line is the line of the file on which the document starts
+	Line int
+	// Node is the content of the document
+	Node *yaml.RNode
+
+	suppressions []suppression
+}
+
+// String returns the location of the document as <path>:<line>
+func (d *Document) String() string {
+	return fmt.Sprintf("%s:%d", d.Path, d.Line)
+}
+
+// IsKustomization reports whether the document is a kustomization file
+func (d *Document) IsKustomization() bool {
+	switch path.Base(d.Path) {
+	case "kustomization.yaml", "kustomization.yml":
+		return true
+	}
+	return false
+}
+
+// FileError is a file that could not be read or parsed
+type FileError struct {
+	// Path is the slash separated path of the file relative to the repository root
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Path, e.Err)
+}
+
+// Inventory holds the YAML documents of every file below a repository root that isn't ignored
+type Inventory struct {
+	// Root is the repository root
+	Root string
+	// Documents are sorted by path and line
+	Documents []*Document
+	// Errors are the files that could not be parsed
+	Errors []*FileError
+	// Ignore are the patterns of IgnoreFile
+	Ignore *IgnoreList
+}
+
+// Load reads every .yaml and .yml file below root that isn't ignored by the IgnoreFile in root for all rules
+func Load(root string) (*Inventory, error) {
+	ignore := &IgnoreList{}
+	data, err := ioutil.ReadFile(filepath.Join(root, IgnoreFile))
+	if err == nil {
+		if ignore, err = ParseIgnoreList(data); err != nil {
+			return nil, fmt.Errorf("could not parse %v; error: %v", IgnoreFile, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	inv := &Inventory{Root: root, Ignore: ignore}
+	err = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+		if ignore.Ignored(rel, info.IsDir(), "") {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := filepath.Ext(p)
+		if info.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		docs, err := parseDocuments(rel, data)
+		if err != nil {
+			inv.Errors = append(inv.Errors, &FileError{Path: rel, Err: err})
+		}
+		inv.Documents = append(inv.Documents, docs...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// parseDocuments parses every document of the file at path. Empty documents are skipped. Line numbers
+// are those of the file since the documents are decoded from a single stream.
+func parseDocuments(path string, data []byte) ([]*Document, error) {
+	var docs []*Document
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		node := &yaml.Node{}
+		err := decoder.Decode(node)
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return docs, err
+		}
+		if node.Kind != yaml.DocumentNode || len(node.Content) == 0 {
+			continue
+		}
+		content := node.Content[0]
+		if content.Kind == yaml.ScalarNode && content.Tag == "!!null" {
+			continue
+		}
+		docs = append(docs, &Document{
+			Path:         path,
+			Line:         content.Line,
+			Node:         yaml.NewRNode(content),
+			suppressions: findSuppressions(node),
+		})
+	}
+}
+
+// IgnoreFile lists the paths, relative to the repository root, that aren't checked. See ParseIgnoreList.
+const IgnoreFile = ".manifestignore"
+
+// ignorePattern is a line of the IgnoreFile
+type ignorePattern struct {
+	pattern  string
+	dirOnly  bool
+	anchored bool
+	rules    map[string]bool
+}
+
+// IgnoreList are the patterns of an IgnoreFile
+type IgnoreList struct {
+	patterns []ignorePattern
+}
+
+// ParseIgnoreList parses the lines of an IgnoreFile. Like .gitignore, a line is a pattern of path.Match,
+// a pattern ending in / only matches directories and a pattern without a / in its middle matches a file
+// or directory of that name at any depth. Blank lines and lines starting with # are skipped. A pattern
+// applies to every rule unless it is followed by the ids of the rules it applies to, e.g.
+//
+//	charts/*/*/templates/
+//	awsconfigs/apps/pipeline/s3/kustomization.yaml obsolete-kustomization
+func ParseIgnoreList(data []byte) (*IgnoreList, error) {
+	l := &IgnoreList{}
+	for i, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		p := ignorePattern{pattern: fields[0]}
+		if strings.HasSuffix(p.pattern, "/") {
+			p.dirOnly = true
+			p.pattern = strings.TrimSuffix(p.pattern, "/")
+		}
+		if strings.HasPrefix(p.pattern, "/") || strings.Contains(p.pattern, "/") {
+			p.anchored = true
+			p.pattern = strings.TrimPrefix(p.pattern, "/")
+		}
+		if _, err := path.Match(p.pattern, ""); err != nil || p.pattern == "" {
+			return nil, fmt.Errorf("line %d: invalid pattern %q", i+1, fields[0])
+		}
+		for _, rule := range fields[1:] {
+			if strings.HasPrefix(rule, "#") {
+				break
+			}
+			if p.rules == nil {
+				p.rules = map[string]bool{}
+			}
+			p.rules[rule] = true
+		}
+		l.patterns = append(l.patterns, p)
+	}
+	return l, nil
+}
+
+// Ignored reports whether the slash separated path relative to the repository root is ignored for the
+// rule with id rule. An empty rule only matches patterns that apply to every rule.
+func (l *IgnoreList) Ignored(p string, isDir bool, rule string) bool {
+	components := strings.Split(p, "/")
+	for _, pattern := range l.patterns {
+		if pattern.rules != nil && !pattern.rules[rule] {
+			continue
+		}
+		if pattern.matches(components, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether the pattern matches the path or one of the directories it is in
+func (p ignorePattern) matches(components []string, isDir bool) bool {
+	for i := range components {
+		// Every component but the last is a directory
+		dir := i < len(components)-1 || isDir
+		if p.dirOnly && !dir {
+			continue
+		}
+		subject := components[i]
+		if p.anchored {
+			subject = strings.Join(components[:i+1], "/")
+		}
+		if matched, _ := path.Match(p.pattern, subject); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package manifests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreList(t *testing.T) {
+	l, err := ParseIgnoreList([]byte(`# comment
+.git/
+templates/
+charts/*/*/crds/ valid-resources
+/awsconfigs/apps/pipeline/s3/kustomization.yaml obsolete-kustomization webhook-audit # comment
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type testCase struct {
+		path     string
+		isDir    bool
+		rule     string
+		expected bool
+	}
+	testCases := []testCase{
+		{path: ".git", isDir: true, expected: true},
+		{path: ".git/config", expected: true},
+		{path: "charts/common/knative-eventing/templates", isDir: true, expected: true},
+		{path: "charts/common/knative-eventing/templates", isDir: false, expected: false},
+		{path: "tools/helmify/template", isDir: true, expected: false},
+		{path: "charts/apps/admission-webhook/crds/poddefaults.yaml", rule: "valid-resources", expected: true},
+		{path: "charts/apps/admission-webhook/crds/poddefaults.yaml", rule: "webhook-audit", expected: false},
+		{path: "charts/apps/admission-webhook/crds", isDir: true, expected: false},
+		{path: "charts/apps/kubeflow-pipelines/vanilla/crds/crd.yaml", rule: "valid-resources", expected: false},
+		{path: "awsconfigs/apps/pipeline/s3/kustomization.yaml", rule: "obsolete-kustomization", expected: true},
+		{path: "awsconfigs/apps/pipeline/s3/kustomization.yaml", rule: "webhook-audit", expected: true},
+		{path: "awsconfigs/apps/pipeline/s3/kustomization.yaml", rule: "valid-resources", expected: false},
+		{path: "awsconfigs/apps/pipeline/kustomization.yaml", rule: "obsolete-kustomization", expected: false},
+	}
+	for _, c := range testCases {
+		if actual := l.Ignored(c.path, c.isDir, c.rule); actual != c.expected {
+			t.Errorf("Ignored(%v, %v, %q): got %v; want %v", c.path, c.isDir, c.rule, actual, c.expected)
+		}
+	}
+
+	if _, err := ParseIgnoreList([]byte("charts/[/\n")); err == nil {
+		t.Errorf("Invalid pattern was accepted")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	root, err := ioutil.TempDir("", "manifests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	files := map[string]string{
+		IgnoreFile: "ignored/\n",
+		"app/deployment.yaml": `# comment
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: a
+---
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: b
+`,
+		"app/kustomization.yaml": "resources:\n- deployment.yaml\n",
+		"app/README.md":          "# app\n",
+		"broken/bad.yml":         "a: [\n",
+		"ignored/bad.yaml":       "a: [\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inv, err := Load(root)
+	if err != nil {
+		t.Fatalf("Could not load %v; error: %v", root, err)
+	}
+	var actual []string
+	for _, d := range inv.Documents {
+		actual = append(actual, d.String())
+	}
+	expected := []string{"app/deployment.yaml:2", "app/deployment.yaml:8", "app/kustomization.yaml:1"}
+	if len(actual) != len(expected) {
+		t.Fatalf("got documents %v; want %v", actual, expected)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("got documents %v; want %v", actual, expected)
+			break
+		}
+	}
+	if !inv.Documents[2].IsKustomization() || inv.Documents[0].IsKustomization() {
+		t.Errorf("Only app/kustomization.yaml should be a kustomization")
+	}
+	if len(inv.Errors) != 1 || inv.Errors[0].Path != "broken/bad.yml" {
+		t.Errorf("got errors %v; want an error for broken/bad.yml", inv.Errors)
+	}
+}
+
+func TestSuppressions(t *testing.T) {
+	docs, err := parseDocuments("webhook.yaml", []byte(`apiVersion: admissionregistration.k8s.io/v1
+kind: MutatingWebhookConfiguration
+metadata:
+  name: a
+  annotations:
+    manifests.kubeflow.org/ignore: valid-resources, common-labels-immutable
+webhooks:
+# manifests.kubeflow.org/ignore: webhook-audit
+- name: first
+  rules:
+  - resources: [pods]
+- name: second # manifests.kubeflow.org/ignore: obsolete-kustomization
+  rules:
+  - resources: [pods]
+---
+# manifests.kubeflow.org/ignore: webhook-audit
+kind: Kustomization
+resources:
+- webhook.yaml
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type testCase struct {
+		doc      int
+		rule     string
+		line     int
+		expected bool
+	}
+	testCases := []testCase{
+		{doc: 0, rule: "valid-resources", line: 1, expected: true},
+		{doc: 0, rule: "common-labels-immutable", line: 14, expected: true},
+		{doc: 0, rule: "webhook-audit", line: 9, expected: true},
+		{doc: 0, rule: "webhook-audit", line: 11, expected: true},
+		{doc: 0, rule: "webhook-audit", line: 14, expected: false},
+		{doc: 0, rule: "obsolete-kustomization", line: 12, expected: true},
+		{doc: 0, rule: "obsolete-kustomization", line: 14, expected: false},
+		{doc: 1, rule: "webhook-audit", line: 19, expected: true},
+		{doc: 1, rule: "valid-resources", line: 17, expected: false},
+	}
+	for _, c := range testCases {
+		if actual := docs[c.doc].Suppressed(c.rule, c.line); actual != c.expected {
+			t.Errorf("document %d: Suppressed(%v, %d): got %v; want %v", c.doc, c.rule, c.line, actual, c.expected)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package manifests
+
+import (
+	"math"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// IgnoreAnnotation suppresses the comma separated rules it lists for a resource, e.g.
+//
+//	metadata:
+//	  annotations:
+//	    manifests.kubeflow.org/ignore: webhook-audit
+//
+// The same text in a comment suppresses the rules for the node the comment belongs to.
+const IgnoreAnnotation = "manifests.kubeflow.org/ignore"
+
+// ignoreDirective matches IgnoreAnnotation in a comment
+var ignoreDirective = regexp.MustCompile(regexp.QuoteMeta(IgnoreAnnotation) + `:\s*([\w.-]+(?:\s*,\s*[\w.-]+)*)`)
+
+// suppression is a rule that is ignored from line first through line last of a document
+type suppression struct {
+	rule  string
+	first int
+	last  int
+}
+
+// Suppressed reports whether the findings of rule on line are suppressed by IgnoreAnnotation or a comment
+func (d *Document) Suppressed(rule string, line int) bool {
+	for _, s := range d.suppressions {
+		if s.rule == rule && s.first <= line && line <= s.last {
+			return true
+		}
+	}
+	return false
+}
+
+// findSuppressions returns the suppressions of a document node. IgnoreAnnotation and a comment at the top
+// of the document apply to the whole document. A comment above or next to any other field or a list item
+// applies to the lines of the field or the item.
+func findSuppressions(document *yaml.Node) []suppression {
+	var suppressions []suppression
+	add := func(comment string, first int, last int) {
+		for _, m := range ignoreDirective.FindAllStringSubmatch(comment, -1) {
+			for _, rule := range strings.Split(m[1], ",") {
+				suppressions = append(suppressions, suppression{rule: strings.TrimSpace(rule), first: first, last: last})
+			}
+		}
+	}
+	add(document.HeadComment, 0, math.MaxInt32)
+	if len(document.Content) == 0 {
+		return suppressions
+	}
+
+	root := yaml.NewRNode(document.Content[0])
+	if annotations, err := root.Pipe(yaml.Lookup("metadata", "annotations", IgnoreAnnotation)); err == nil && annotations != nil {
+		add(IgnoreAnnotation+": "+annotations.YNode().Value, 0, math.MaxInt32)
+	}
+
+	// A comment above the first field is at the top of the document
+	if first := document.Content[0]; first.Kind == yaml.MappingNode && len(first.Content) > 0 {
+		add(first.Content[0].HeadComment, 0, math.MaxInt32)
+	}
+
+	var walk func(n *yaml.Node)
+	walk = func(n *yaml.Node) {
+		switch n.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				key, value := n.Content[i], n.Content[i+1]
+				add(key.HeadComment+"\n"+key.LineComment+"\n"+value.LineComment, key.Line, lastLine(value))
+				walk(value)
+			}
+		case yaml.SequenceNode:
+			for _, item := range n.Content {
+				add(item.HeadComment+"\n"+item.LineComment, item.Line, lastLine(item))
+				walk(item)
+			}
+		}
+	}
+	walk(document.Content[0])
+	return suppressions
+}
+
+// lastLine returns the last line of the node and its children
+func lastLine(n *yaml.Node) int {
+	last := n.Line
+	for _, c := range n.Content {
+		if l := lastLine(c); l > last {
+			last = l
+		}
+	}
+	return last
+}
@@ -0,0 +1,425 @@
+package tests
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// fixKustomizations rewrites the obsolete fields of the kustomizations checked by the obsolete-kustomization rule
+var fixKustomizations = flag.Bool("fix", false, "rewrite the obsolete fields of kustomizations, see TestFixObsoleteKustomizations")
+
+// obsoleteField is a field of a kustomization that kustomize deprecates, with the field that replaces it
+type obsoleteField struct {
+	// name is the field, e.g. bases
+	name string
+	// replacement describes the field to use instead
+	replacement string
+	severity    Severity
+	// fix rewrites one occurrence of the field and reports whether it found one. It is nil if the field
+	// can't be rewritten automatically.
+	fix func(f *kustomizationFile) (bool, error)
+}
+
+// obsoleteFields are the obsolete fields of a kustomization in the order they are fixed. All of them still
+// work but are deprecated. env of a generator is an error since every engine reads its replacement envs, while
+// the replacements of the other fields need kustomize v4.1 or newer.
+var obsoleteFields = []*obsoleteField{
+	{name: "env", replacement: "envs", severity: SeverityError, fix: fixEnv},
+	{name: "bases", replacement: "resources", severity: SeverityWarning, fix: fixBases},
+	{name: "patchesStrategicMerge", replacement: "patches with a path or a patch", severity: SeverityWarning, fix: fixPatchesStrategicMerge},
+	{name: "patchesJson6902", replacement: "patches with a target", severity: SeverityWarning, fix: fixPatchesJson6902},
+	{name: "commonLabels", replacement: "labels with includeSelectors: true", severity: SeverityWarning, fix: fixCommonLabels},
+	{name: "vars", replacement: "replacements", severity: SeverityWarning},
+}
+
+// generatorFields are the generators of a kustomization whose items read env files
+var generatorFields = []string{"configMapGenerator", "secretGenerator"}
+
+// findObsoleteFields returns a finding for every obsolete field of the kustomization n
+func findObsoleteFields(n *kyaml.Node) []Finding {
+	var findings []Finding
+	for _, o := range obsoleteFields {
+		if o.name == "env" {
+			for _, g := range generatorFields {
+				_, items := mapField(n, g)
+				if items == nil || items.Kind != kyaml.SequenceNode {
+					continue
+				}
+				for _, item := range items.Content {
+					if key, _ := mapField(item, "env"); key != nil {
+						findings = append(findings, Finding{
+							Line:     key.Line,
+							Message:  fmt.Sprintf("env of %v is deprecated; use envs; run with -fix to rewrite it", g),
+							Severity: o.severity,
+						})
+					}
+				}
+			}
+			continue
+		}
+		if key, _ := mapField(n, o.name); key != nil {
+			fixable := ""
+			if o.fix != nil {
+				fixable = "; run with -fix to rewrite it"
+			}
+			findings = append(findings, Finding{
+				Line:     key.Line,
+				Message:  fmt.Sprintf("%v is deprecated; use %v%v", o.name, o.replacement, fixable),
+				Severity: o.severity,
+			})
+		}
+	}
+	return findings
+}
+
+// fixObsoleteFields rewrites the obsolete fields of a kustomization that can be fixed and returns the new
+// content. Only the lines of the fields change, so comments, blank lines and the indentation of the rest of
+// the file are kept.
+func fixObsoleteFields(data []byte) ([]byte, error) {
+	for _, o := range obsoleteFields {
+		if o.fix == nil {
+			continue
+		}
+		for {
+			f, err := parseKustomizationFile(data)
+			if err != nil {
+				return nil, err
+			}
+			fixed, err := o.fix(f)
+			if err != nil {
+				return nil, fmt.Errorf("could not fix %v; error: %v", o.name, err)
+			}
+			if !fixed {
+				break
+			}
+			data = f.bytes()
+		}
+	}
+	return data, nil
+}
+
+// fixEnv replaces env of a generator with envs, or adds the file to envs if the generator has both
+func fixEnv(f *kustomizationFile) (bool, error) {
+	for _, g := range generatorFields {
+		_, items := mapField(f.root, g)
+		if items == nil || items.Kind != kyaml.SequenceNode {
+			continue
+		}
+		for _, item := range items.Content {
+			key, value := mapField(item, "env")
+			if key == nil {
+				continue
+			}
+			if envsKey, envs := mapField(item, "envs"); envsKey != nil {
+				return true, f.moveItems(key, value, envsKey, envs, []*kyaml.Node{value}, false)
+			}
+			return true, f.replaceField(key, value, "envs", sequence(value))
+		}
+	}
+	return false, nil
+}
+
+// fixBases renames bases to resources or moves the bases to the end of the resources like kustomize does
+func fixBases(f *kustomizationFile) (bool, error) {
+	key, value := mapField(f.root, "bases")
+	if key == nil {
+		return false, nil
+	}
+	resourcesKey, resources := mapField(f.root, "resources")
+	if resourcesKey == nil {
+		f.renameKey(key, "resources")
+		return true, nil
+	}
+	return true, f.moveItems(key, value, resourcesKey, resources, value.Content, false)
+}
+
+// fixPatchesStrategicMerge turns every patch file into a patch with a path and every inline patch into a
+// patch with a patch. They are added before the patches, since kustomize applies them first.
+func fixPatchesStrategicMerge(f *kustomizationFile) (bool, error) {
+	key, value := mapField(f.root, "patchesStrategicMerge")
+	if key == nil {
+		return false, nil
+	}
+	var items []*kyaml.Node
+	for _, item := range value.Content {
+		field := "path"
+		if strings.Contains(item.Value, "\n") {
+			field = "patch"
+		}
+		patch := mapping(field, item)
+		patch.HeadComment, item.HeadComment = item.HeadComment, ""
+		items = append(items, patch)
+	}
+	patchesKey, patches := mapField(f.root, "patches")
+	if patchesKey == nil {
+		return true, f.replaceField(key, value, "patches", sequence(items...))
+	}
+	return true, f.moveItems(key, value, patchesKey, patches, items, true)
+}
+
+// fixPatchesJson6902 moves the patches to patches, whose target selects resources like the target of
+// patchesJson6902 does
+func fixPatchesJson6902(f *kustomizationFile) (bool, error) {
+	key, value := mapField(f.root, "patchesJson6902")
+	if key == nil {
+		return false, nil
+	}
+	patchesKey, patches := mapField(f.root, "patches")
+	if patchesKey == nil {
+		f.renameKey(key, "patches")
+		return true, nil
+	}
+	return true, f.moveItems(key, value, patchesKey, patches, value.Content, false)
+}
+
+// fixCommonLabels replaces commonLabels with labels that also apply to selectors, like commonLabels do
+func fixCommonLabels(f *kustomizationFile) (bool, error) {
+	key, value := mapField(f.root, "commonLabels")
+	if key == nil {
+		return false, nil
+	}
+	labels := mapping("pairs", value)
+	labels.Content = append(labels.Content, mapping("includeSelectors", &kyaml.Node{
+		Kind:  kyaml.ScalarNode,
+		Tag:   "!!bool",
+		Value: "true",
+	}).Content...)
+	labelsKey, existing := mapField(f.root, "labels")
+	if labelsKey == nil {
+		return true, f.replaceField(key, value, "labels", sequence(labels))
+	}
+	return true, f.moveItems(key, value, labelsKey, existing, []*kyaml.Node{labels}, false)
+}
+
+// kustomizationFile is the text of a kustomization with the nodes it parses to. Fixes edit the lines of the
+// nodes they change and the file is parsed again after every fix, so the positions of the nodes stay valid.
+type kustomizationFile struct {
+	lines []string
+	root  *kyaml.Node
+	// compact is whether the sequences of the file start at the column of their key, e.g.
+	//	resources:
+	//	- base
+	compact bool
+	edits   []lineEdit
+}
+
+// lineEdit replaces the lines first through last, counted from 1, with lines. last is first-1 to insert lines.
+type lineEdit struct {
+	first int
+	last  int
+	lines []string
+}
+
+func parseKustomizationFile(data []byte) (*kustomizationFile, error) {
+	n, err := kyaml.Parse(string(data))
+	if err != nil {
+		return nil, err
+	}
+	f := &kustomizationFile{lines: strings.Split(string(data), "\n"), root: n.YNode(), compact: true}
+	if f.root.Kind != kyaml.MappingNode {
+		return nil, fmt.Errorf("kustomization is not a mapping")
+	}
+	for i := 0; i+1 < len(f.root.Content); i += 2 {
+		key, value := f.root.Content[i], f.root.Content[i+1]
+		if value.Kind == kyaml.SequenceNode && value.Style&kyaml.FlowStyle == 0 && len(value.Content) > 0 {
+			f.compact = value.Column == key.Column
+			break
+		}
+	}
+	return f, nil
+}
+
+// bytes applies the edits and returns the content of the file
+func (f *kustomizationFile) bytes() []byte {
+	sort.SliceStable(f.edits, func(i, j int) bool { return f.edits[i].first > f.edits[j].first })
+	lines := f.lines
+	for _, e := range f.edits {
+		edited := append([]string{}, lines[:e.first-1]...)
+		edited = append(edited, e.lines...)
+		lines = append(edited, lines[e.last:]...)
+	}
+	f.lines, f.edits = lines, nil
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// renameKey renames the key of a field on its line
+func (f *kustomizationFile) renameKey(key *kyaml.Node, name string) {
+	line := f.lines[key.Line-1]
+	start := key.Column - 1
+	f.edits = append(f.edits, lineEdit{
+		first: key.Line,
+		last:  key.Line,
+		lines: []string{line[:start] + name + line[start+len(key.Value):]},
+	})
+}
+
+// replaceField replaces the lines of a field with the field name and value, indented like the field
+func (f *kustomizationFile) replaceField(key *kyaml.Node, value *kyaml.Node, name string, newValue *kyaml.Node) error {
+	lines, err := render(mapping(name, newValue), f.compact)
+	if err != nil {
+		return err
+	}
+	// Keep the "- " of a field that starts an item of a sequence
+	prefix := f.lines[key.Line-1][:key.Column-1]
+	indent := strings.Repeat(" ", len(prefix))
+	for i := range lines {
+		if i == 0 {
+			lines[i] = prefix + lines[i]
+		} else if lines[i] != "" {
+			lines[i] = indent + lines[i]
+		}
+	}
+	f.edits = append(f.edits, lineEdit{first: key.Line, last: endLine(value), lines: lines})
+	return nil
+}
+
+// moveItems removes the field key and adds items to the sequence of the field toKey, at its start if prepend
+// is set or else at its end
+func (f *kustomizationFile) moveItems(key *kyaml.Node, value *kyaml.Node, toKey *kyaml.Node, to *kyaml.Node, items []*kyaml.Node, prepend bool) error {
+	if strings.TrimSpace(f.lines[key.Line-1][:key.Column-1]) != "" {
+		return fmt.Errorf("line %d: %v starts an item; move it manually", key.Line, key.Value)
+	}
+	f.edits = append(f.edits, lineEdit{first: key.Line, last: endLine(value)})
+
+	if to.Kind != kyaml.SequenceNode {
+		return fmt.Errorf("line %d: %v is not a sequence", toKey.Line, toKey.Value)
+	}
+	if to.Style&kyaml.FlowStyle != 0 || len(to.Content) == 0 {
+		// The items of a flow sequence become block items like the ones that are added
+		for _, item := range to.Content {
+			blockStyle(item)
+		}
+		merged := append(append([]*kyaml.Node{}, to.Content...), items...)
+		if prepend {
+			merged = append(append([]*kyaml.Node{}, items...), to.Content...)
+		}
+		return f.replaceField(toKey, to, toKey.Value, sequence(merged...))
+	}
+
+	lines, err := render(mapping("items", sequence(items...)), true)
+	if err != nil {
+		return err
+	}
+	// Drop "items:" and indent the items like those of the sequence
+	lines = lines[1:]
+	indent := strings.Repeat(" ", to.Column-1)
+	for i := range lines {
+		if lines[i] != "" {
+			lines[i] = indent + lines[i]
+		}
+	}
+	at := endLine(to) + 1
+	if prepend {
+		at = toKey.Line + 1
+	}
+	f.edits = append(f.edits, lineEdit{first: at, last: at - 1, lines: lines})
+	return nil
+}
+
+// render encodes n with kyaml and returns its lines. The sequences of a mapping start at the column of
+// their key if compact is set.
+func render(n *kyaml.Node, compact bool) ([]string, error) {
+	var b bytes.Buffer
+	e := kyaml.NewEncoder(&b)
+	if err := e.Encode(n); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if compact {
+		return compactSequences(lines)
+	}
+	return lines, nil
+}
+
+// compactSequences moves the block sequences of a mapping in the lines kyaml encodes to the column of their key
+func compactSequences(lines []string) ([]string, error) {
+	n, err := kyaml.Parse(strings.Join(lines, "\n"))
+	if err != nil {
+		return nil, err
+	}
+	dedent := make([]int, len(lines))
+	var walk func(n *kyaml.Node)
+	walk = func(n *kyaml.Node) {
+		if n.Kind == kyaml.MappingNode {
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				key, value := n.Content[i], n.Content[i+1]
+				if value.Kind == kyaml.SequenceNode && value.Style&kyaml.FlowStyle == 0 && value.Column > key.Column {
+					// The lines after the key include the comment above the first item
+					for l := key.Line + 1; l <= endLine(value) && l <= len(lines); l++ {
+						dedent[l-1] += value.Column - key.Column
+					}
+				}
+			}
+		}
+		for _, c := range n.Content {
+			walk(c)
+		}
+	}
+	walk(n.YNode())
+
+	compacted := make([]string, len(lines))
+	for i, line := range lines {
+		spaces := len(line) - len(strings.TrimLeft(line, " "))
+		if dedent[i] > spaces {
+			dedent[i] = spaces
+		}
+		compacted[i] = line[dedent[i]:]
+	}
+	return compacted, nil
+}
+
+// mapField returns the key and value of a field of a mapping or nil
+func mapField(m *kyaml.Node, name string) (*kyaml.Node, *kyaml.Node) {
+	if m == nil || m.Kind != kyaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == name {
+			return m.Content[i], m.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// endLine returns the last line of a node, including the lines of a block scalar
+func endLine(n *kyaml.Node) int {
+	last := n.Line
+	if n.Kind == kyaml.ScalarNode && n.Style&(kyaml.LiteralStyle|kyaml.FoldedStyle) != 0 {
+		last += strings.Count(strings.TrimSuffix(n.Value, "\n"), "\n") + 1
+	}
+	for _, c := range n.Content {
+		if l := endLine(c); l > last {
+			last = l
+		}
+	}
+	return last
+}
+
+// mapping returns a mapping with the field name
+func mapping(name string, value *kyaml.Node) *kyaml.Node {
+	return &kyaml.Node{
+		Kind:    kyaml.MappingNode,
+		Content: []*kyaml.Node{{Kind: kyaml.ScalarNode, Value: name}, value},
+	}
+}
+
+// blockStyle removes the flow style of a node and its children
+func blockStyle(n *kyaml.Node) {
+	n.Style &^= kyaml.FlowStyle
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+// sequence returns a block sequence of items
+func sequence(items ...*kyaml.Node) *kyaml.Node {
+	return &kyaml.Node{Kind: kyaml.SequenceNode, Content: items}
+}
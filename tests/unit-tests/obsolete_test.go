@@ -0,0 +1,263 @@
+package tests
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// TestFixObsoleteKustomizations rewrites the obsolete fields of every kustomization of the repository that isn't
+// ignored for the obsolete-kustomization rule. It only runs with -fix, e.g.
+// go test -run TestFixObsoleteKustomizations . -args -fix
+// The golden tests verify that the kustomizations still build the same resources afterwards.
+func TestFixObsoleteKustomizations(t *testing.T) {
+	if !*fixKustomizations {
+		t.Skip("run with -fix to rewrite the kustomizations")
+	}
+	inv, err := loadInventory()
+	if err != nil {
+		t.Fatalf("Could not load the manifests of the repository; error: %v", err)
+	}
+	for _, doc := range inv.Documents {
+		if !doc.IsKustomization() || inv.Ignore.Ignored(doc.Path, false, "obsolete-kustomization") {
+			continue
+		}
+		if len(findObsoleteFields(doc.Node.YNode())) == 0 {
+			continue
+		}
+		path := filepath.Join(inv.Root, doc.Path)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fixed, err := fixObsoleteFields(data)
+		if err != nil {
+			t.Errorf("Could not fix %v; error: %v", doc.Path, err)
+			continue
+		}
+		if string(fixed) == string(data) {
+			continue
+		}
+		if err := ioutil.WriteFile(path, fixed, 0644); err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("Fixed %v", doc.Path)
+	}
+}
+
+func TestFindObsoleteFields(t *testing.T) {
+	n, err := kyaml.Parse(`apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+bases:
+- ../base
+commonLabels:
+  app: foo
+configMapGenerator:
+- name: config
+  env: params.env
+vars:
+- name: foo
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type finding struct {
+		line     int
+		severity Severity
+	}
+	want := []finding{{9, SeverityError}, {3, SeverityWarning}, {5, SeverityWarning}, {10, SeverityWarning}}
+	findings := findObsoleteFields(n.YNode())
+	if len(findings) != len(want) {
+		t.Fatalf("got findings %v; want %v", findings, want)
+	}
+	for i, f := range findings {
+		if (finding{f.Line, f.Severity}) != want[i] {
+			t.Errorf("got finding %v; want %v", f, want[i])
+		}
+	}
+}
+
+func TestFixObsoleteFields(t *testing.T) {
+	type testCase struct {
+		Name     string
+		Raw      string
+		Expected string
+	}
+
+	testCases := []testCase{
+		{
+			Name: "env",
+			Raw: `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+# The parameters of the app
+configMapGenerator:
+- name: config # generated
+  env: params.env
+
+  behavior: merge
+- env: other.env
+  name: other
+secretGenerator:
+- name: secret
+  env: secret.env
+  envs:
+  - more.env
+`,
+			Expected: `apiVersion: kustomize.config.k8s.io/v1beta1
+kind: Kustomization
+# The parameters of the app
+configMapGenerator:
+- name: config # generated
+  envs:
+  - params.env
+
+  behavior: merge
+- envs:
+  - other.env
+  name: other
+secretGenerator:
+- name: secret
+  envs:
+  - more.env
+  - secret.env
+`,
+		},
+		{
+			Name: "env with flow envs",
+			Raw: `kind: Kustomization
+configMapGenerator:
+- name: config
+  envs: [params.env, extra.env]
+  env: local.env
+- name: other
+  env: other.env
+  envs: [more.env]
+`,
+			Expected: `kind: Kustomization
+configMapGenerator:
+- name: config
+  envs:
+  - params.env
+  - extra.env
+  - local.env
+- name: other
+  envs:
+  - more.env
+  - other.env
+`,
+		},
+		{
+			Name: "bases",
+			Raw: `kind: Kustomization
+bases:
+  # The base
+  - ../base
+resources:
+  - service.yaml
+namespace: kubeflow
+`,
+			Expected: `kind: Kustomization
+resources:
+  - service.yaml
+  # The base
+  - ../base
+namespace: kubeflow
+`,
+		},
+		{
+			Name: "bases only",
+			Raw: `kind: Kustomization
+bases:
+- ../base # upstream
+`,
+			Expected: `kind: Kustomization
+resources:
+- ../base # upstream
+`,
+		},
+		{
+			Name: "patches",
+			Raw: `kind: Kustomization
+resources:
+- ../base
+
+patchesStrategicMerge:
+# Sets the image
+- deployment.yaml
+- |-
+  apiVersion: v1
+  kind: Service
+  metadata:
+    name: svc
+patchesJson6902:
+- target:
+    kind: Service
+    name: svc
+  path: service.yaml
+patches: [{path: other.yaml}]
+`,
+			Expected: `kind: Kustomization
+resources:
+- ../base
+
+patches:
+# Sets the image
+- path: deployment.yaml
+- patch: |-
+    apiVersion: v1
+    kind: Service
+    metadata:
+      name: svc
+- path: other.yaml
+- target:
+    kind: Service
+    name: svc
+  path: service.yaml
+`,
+		},
+		{
+			Name: "commonLabels",
+			Raw: `kind: Kustomization
+resources:
+- ../base
+commonLabels:
+  app: foo # the app
+  component: bar
+images:
+- name: foo
+`,
+			Expected: `kind: Kustomization
+resources:
+- ../base
+labels:
+- pairs:
+    app: foo # the app
+    component: bar
+  includeSelectors: true
+images:
+- name: foo
+`,
+		},
+	}
+
+	for _, c := range testCases {
+		actual, err := fixObsoleteFields([]byte(c.Raw))
+		if err != nil {
+			t.Errorf("%v: could not fix yaml:\n%v\nerror: %v", c.Name, c.Raw, err)
+			continue
+		}
+		if string(actual) != c.Expected {
+			t.Errorf("%v: got\n%v\nwant\n%v", c.Name, string(actual), c.Expected)
+		}
+		n, err := kyaml.Parse(string(actual))
+		if err != nil {
+			t.Errorf("%v: could not parse the fixed yaml; error: %v", c.Name, err)
+			continue
+		}
+		for _, f := range findObsoleteFields(n.YNode()) {
+			t.Errorf("%v: the fixed yaml still has %v", c.Name, f)
+		}
+	}
+}
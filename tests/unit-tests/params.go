@@ -0,0 +1,464 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
+)
+
+// generatorArgs are the fields of a configMapGenerator or secretGenerator that define keys
+type generatorArgs struct {
+	Name     string   `json:"name"`
+	Behavior string   `json:"behavior,omitempty"`
+	Env      string   `json:"env,omitempty"`
+	Envs     []string `json:"envs,omitempty"`
+	Literals []string `json:"literals,omitempty"`
+	Files    []string `json:"files,omitempty"`
+}
+
+// kustomizeVar is a var of a kustomization, whose value is a field of the object it references
+type kustomizeVar struct {
+	Name   string `json:"name"`
+	ObjRef struct {
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+	} `json:"objref"`
+	FieldRef struct {
+		FieldPath string `json:"fieldpath"`
+	} `json:"fieldref"`
+}
+
+// paramsKustomization are the fields of a kustomization that define and consume the keys of generators
+type paramsKustomization struct {
+	kustomizationRefs
+	ConfigMapGenerator []generatorArgs `json:"configMapGenerator,omitempty"`
+	SecretGenerator    []generatorArgs `json:"secretGenerator,omitempty"`
+	Vars               []kustomizeVar  `json:"vars,omitempty"`
+}
+
+// envKey is a key of an env file of a generator, e.g. a params.env
+type envKey struct {
+	// file is relative to the repository root
+	file string
+	line int
+	key  string
+}
+
+// paramsGenerator is a configMapGenerator or secretGenerator
+type paramsGenerator struct {
+	// kind is ConfigMap or Secret
+	kind string
+	name string
+	// envKeys are the keys of the env files of the generator
+	envKeys []envKey
+	// keys are all keys of the generator, including its literals and files
+	keys []string
+}
+
+// paramsVar is a var with the kustomization and the line it is declared on
+type paramsVar struct {
+	kustomizeVar
+	// kustomization is relative to the repository root
+	kustomization string
+	line          int
+}
+
+// paramsPackage is a kustomization package with the generators and vars of the kustomizations it includes
+type paramsPackage struct {
+	// generators are the generators of the package itself
+	generators []*paramsGenerator
+	// all are the generators of the package and the kustomizations it includes
+	all  []*paramsGenerator
+	vars []*paramsVar
+}
+
+// loadParamsPackage reads the generators and vars of the package at rpath, relative to repoRoot, and of the
+// kustomizations it includes through resources, bases and components
+func loadParamsPackage(repoRoot string, rpath string) (*paramsPackage, error) {
+	p := &paramsPackage{}
+	if err := p.load(repoRoot, filepath.Clean(rpath), true, map[string]bool{}); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *paramsPackage) load(repoRoot string, rpath string, top bool, visited map[string]bool) error {
+	if visited[rpath] {
+		return nil
+	}
+	visited[rpath] = true
+
+	kpath := filepath.Join(rpath, KustomizationFile)
+	data, err := ioutil.ReadFile(filepath.Join(repoRoot, kpath))
+	if err != nil {
+		return err
+	}
+	k := &paramsKustomization{}
+	if err := yaml.Unmarshal(data, k); err != nil {
+		return fmt.Errorf("could not parse %v; error: %v", kpath, err)
+	}
+	n, err := kyaml.Parse(string(data))
+	if err != nil {
+		return fmt.Errorf("could not parse %v; error: %v", kpath, err)
+	}
+
+	for _, g := range []struct {
+		kind string
+		args []generatorArgs
+	}{{"ConfigMap", k.ConfigMapGenerator}, {"Secret", k.SecretGenerator}} {
+		for _, args := range g.args {
+			generator := &paramsGenerator{kind: g.kind, name: args.Name}
+			envs := args.Envs
+			if args.Env != "" {
+				envs = append(envs, args.Env)
+			}
+			for _, env := range envs {
+				keys, err := readEnvFile(repoRoot, filepath.Join(rpath, env))
+				if err != nil {
+					return err
+				}
+				generator.envKeys = append(generator.envKeys, keys...)
+				for _, k := range keys {
+					generator.keys = append(generator.keys, k.key)
+				}
+			}
+			for _, literal := range args.Literals {
+				generator.keys = append(generator.keys, strings.SplitN(literal, "=", 2)[0])
+			}
+			for _, file := range args.Files {
+				if i := strings.Index(file, "="); i >= 0 {
+					generator.keys = append(generator.keys, file[:i])
+				} else {
+					generator.keys = append(generator.keys, filepath.Base(file))
+				}
+			}
+			p.all = append(p.all, generator)
+			if top {
+				p.generators = append(p.generators, generator)
+			}
+		}
+	}
+
+	_, vars := mapField(n.YNode(), "vars")
+	for i, v := range k.Vars {
+		line := 0
+		if vars != nil && i < len(vars.Content) {
+			line = vars.Content[i].Line
+		}
+		p.vars = append(p.vars, &paramsVar{kustomizeVar: v, kustomization: kpath, line: line})
+	}
+
+	for _, ref := range append(append(k.Resources, k.Bases...), k.Components...) {
+		path := filepath.Join(rpath, ref)
+		if fileExists(filepath.Join(repoRoot, path, KustomizationFile)) {
+			if err := p.load(repoRoot, path, false, visited); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// defines reports whether a generator of the package or a kustomization it includes defines key in the
+// ConfigMap or Secret kind/name
+func (p *paramsPackage) defines(kind string, name string, key string) bool {
+	for _, g := range p.all {
+		if g.kind != kind || g.name != name {
+			continue
+		}
+		for _, k := range g.keys {
+			if k == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// generates reports whether a generator of the package or a kustomization it includes generates the
+// ConfigMap or Secret kind/name
+func (p *paramsPackage) generates(kind string, name string) bool {
+	for _, g := range p.all {
+		if g.kind == kind && g.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// readEnvFile returns the keys of an env file, relative to repoRoot, like kustomize reads them: every line
+// that isn't empty or a # comment defines the key before its first =
+func readEnvFile(repoRoot string, file string) ([]envKey, error) {
+	data, err := ioutil.ReadFile(filepath.Join(repoRoot, file))
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	var keys []envKey
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimLeft(scanner.Text(), " \t")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		keys = append(keys, envKey{file: file, line: line, key: strings.SplitN(text, "=", 2)[0]})
+	}
+	return keys, scanner.Err()
+}
+
+// paramsRef is a reference of a built resource to a ConfigMap or Secret
+type paramsRef struct {
+	resource string
+	kind     string
+	name     string
+	// key is the referenced key or "" if the reference consumes every key, like envFrom does
+	key      string
+	optional bool
+}
+
+// findParamsRefs returns the references to ConfigMaps and Secrets in an object: configMapKeyRef and
+// secretKeyRef of env variables, configMapRef and secretRef of envFrom, and configMap and secret volumes
+func findParamsRefs(resource string, value interface{}) []*paramsRef {
+	var refs []*paramsRef
+	var walk func(value interface{})
+	walk = func(value interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for field, kind := range map[string]string{"configMapKeyRef": "ConfigMap", "secretKeyRef": "Secret"} {
+				if ref, ok := v[field].(map[string]interface{}); ok {
+					optional, _ := ref["optional"].(bool)
+					refs = append(refs, &paramsRef{resource: resource, kind: kind, name: fmt.Sprint(ref["name"]), key: fmt.Sprint(ref["key"]), optional: optional})
+				}
+			}
+			for field, kind := range map[string]string{"configMapRef": "ConfigMap", "secretRef": "Secret"} {
+				if ref, ok := v[field].(map[string]interface{}); ok {
+					refs = append(refs, &paramsRef{resource: resource, kind: kind, name: fmt.Sprint(ref["name"])})
+				}
+			}
+			// Volumes mount the keys of their items or else every key
+			for field, kind := range map[string]string{"configMap": "ConfigMap", "secret": "Secret"} {
+				volume, ok := v[field].(map[string]interface{})
+				if !ok {
+					continue
+				}
+				name := volume["name"]
+				if kind == "Secret" {
+					name = volume["secretName"]
+				}
+				optional, _ := volume["optional"].(bool)
+				items, _ := volume["items"].([]interface{})
+				if len(items) == 0 {
+					refs = append(refs, &paramsRef{resource: resource, kind: kind, name: fmt.Sprint(name)})
+				}
+				for _, item := range items {
+					if item, ok := item.(map[string]interface{}); ok {
+						refs = append(refs, &paramsRef{resource: resource, kind: kind, name: fmt.Sprint(name), key: fmt.Sprint(item["key"]), optional: optional})
+					}
+				}
+			}
+			for _, field := range v {
+				walk(field)
+			}
+		case []interface{}:
+			for _, e := range v {
+				walk(e)
+			}
+		}
+	}
+	walk(value)
+	return refs
+}
+
+// ParamsIssue is a key of a params.env file that is unused, a reference to a key that isn't defined or a key
+// that drifted between a params.env and its helmify template
+type ParamsIssue struct {
+	// Path is the file of the issue relative to the repository root
+	Path string
+	// Line is 0 if the issue isn't on a line of Path
+	Line    int
+	Message string
+}
+
+func (i *ParamsIssue) String() string {
+	if i.Line == 0 {
+		return fmt.Sprintf("%v: %v", i.Path, i.Message)
+	}
+	return fmt.Sprintf("%v:%d: %v", i.Path, i.Line, i.Message)
+}
+
+// checkParams checks the contract between the env files of the generators of the package at rpath and the
+// resources built from it. Every key of an env file must be consumed by a var, a configMapKeyRef or
+// secretKeyRef, an envFrom or a volume, and every var and key reference to a generated ConfigMap or Secret
+// must refer to a key one of the generators defines. Keys consumed only by kustomizations that include the
+// package aren't seen, since they aren't part of its build.
+func checkParams(repoRoot string, rpath string, resources []*builtResource) ([]*ParamsIssue, error) {
+	p, err := loadParamsPackage(repoRoot, rpath)
+	if err != nil {
+		return nil, err
+	}
+
+	// builtNames are the names of the generated resources by the name of their generator, since the name of a
+	// generated resource ends in the hash of its content
+	builtNames := map[string]string{}
+	var refs []*paramsRef
+	for _, r := range resources {
+		if (r.kind == "ConfigMap" || r.kind == "Secret") && p.generates(r.kind, generatorHash.ReplaceAllString(r.name, "")) {
+			builtNames[r.kind+"/"+r.name] = generatorHash.ReplaceAllString(r.name, "")
+		}
+		object := map[string]interface{}{}
+		if err := yaml.Unmarshal(r.yaml, &object); err != nil {
+			return nil, fmt.Errorf("could not parse resource %v; error: %v", r.Key(), err)
+		}
+		refs = append(refs, findParamsRefs(r.Key(), object)...)
+	}
+	generatorOf := func(ref *paramsRef) (string, bool) {
+		name, ok := builtNames[ref.kind+"/"+ref.name]
+		return name, ok
+	}
+
+	var issues []*ParamsIssue
+	for _, g := range p.generators {
+		if len(g.envKeys) == 0 {
+			continue
+		}
+		consumed := map[string]bool{}
+		all := false
+		for _, ref := range refs {
+			if name, ok := generatorOf(ref); ok && ref.kind == g.kind && name == g.name {
+				all = all || ref.key == ""
+				consumed[ref.key] = true
+			}
+		}
+		for _, v := range p.vars {
+			if v.ObjRef.Kind == g.kind && v.ObjRef.Name == g.name && strings.HasPrefix(v.FieldRef.FieldPath, "data.") {
+				consumed[strings.TrimPrefix(v.FieldRef.FieldPath, "data.")] = true
+			}
+		}
+		if all {
+			continue
+		}
+		for _, k := range g.envKeys {
+			if !consumed[k.key] {
+				issues = append(issues, &ParamsIssue{
+					Path:    k.file,
+					Line:    k.line,
+					Message: fmt.Sprintf("%v of %v %v isn't used by a var, a key reference, an envFrom or a volume of %v", k.key, g.kind, g.name, rpath),
+				})
+			}
+		}
+	}
+
+	for _, v := range p.vars {
+		if !p.generates(v.ObjRef.Kind, v.ObjRef.Name) || !strings.HasPrefix(v.FieldRef.FieldPath, "data.") {
+			continue
+		}
+		if key := strings.TrimPrefix(v.FieldRef.FieldPath, "data."); !p.defines(v.ObjRef.Kind, v.ObjRef.Name, key) {
+			issues = append(issues, &ParamsIssue{
+				Path:    v.kustomization,
+				Line:    v.line,
+				Message: fmt.Sprintf("var %v references %v of %v %v, which no generator defines", v.Name, key, v.ObjRef.Kind, v.ObjRef.Name),
+			})
+		}
+	}
+	for _, ref := range refs {
+		name, ok := generatorOf(ref)
+		if !ok || ref.key == "" || ref.optional || p.defines(ref.kind, name, ref.key) {
+			continue
+		}
+		issues = append(issues, &ParamsIssue{
+			Path:    filepath.Join(rpath, KustomizationFile),
+			Message: fmt.Sprintf("resource %v references %v of %v %v, which no generator defines", ref.resource, ref.key, ref.kind, name),
+		})
+	}
+	return issues, nil
+}
+
+// HelmifyParams is a params.env that helmify replaces with a template before it builds the charts of a component
+type HelmifyParams struct {
+	Component string
+	// Template and Target are relative to the repository root
+	Template string
+	Target   string
+}
+
+// LoadHelmifyParams returns the env files in the params of the components of the helmify configuration
+// sorted by target
+func LoadHelmifyParams(repoRoot string) ([]HelmifyParams, error) {
+	components, err := loadHelmifyConfig(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+	var params []HelmifyParams
+	for name, c := range components {
+		if c.Params == nil {
+			continue
+		}
+		if len(c.Params.TemplatePaths) != len(c.Params.TargetPaths) {
+			return nil, fmt.Errorf("%v: params of %v need a target for every template", HelmifyConfig, name)
+		}
+		for i, target := range c.Params.TargetPaths {
+			if filepath.Ext(target) != ".env" {
+				continue
+			}
+			params = append(params, HelmifyParams{
+				Component: name,
+				Template:  filepath.Clean(c.Params.TemplatePaths[i]),
+				Target:    filepath.Clean(target),
+			})
+		}
+	}
+	sort.Slice(params, func(i, j int) bool {
+		return params[i].Target < params[j].Target
+	})
+	return params, nil
+}
+
+// compareHelmifyParams returns the keys of a params.env that are missing from its helmify template, which
+// the charts would silently lack, and the keys of the template that the params.env doesn't define
+func compareHelmifyParams(repoRoot string, p HelmifyParams) ([]*ParamsIssue, error) {
+	targetKeys, err := readEnvFile(repoRoot, p.Target)
+	if err != nil {
+		return nil, err
+	}
+	templateKeys, err := readEnvFile(repoRoot, p.Template)
+	if err != nil {
+		return nil, err
+	}
+	contains := func(keys []envKey, key string) bool {
+		for _, k := range keys {
+			if k.key == key {
+				return true
+			}
+		}
+		return false
+	}
+
+	var issues []*ParamsIssue
+	for _, k := range targetKeys {
+		if !contains(templateKeys, k.key) {
+			issues = append(issues, &ParamsIssue{
+				Path:    k.file,
+				Line:    k.line,
+				Message: fmt.Sprintf("%v is missing from the helmify template %v of %v", k.key, p.Template, p.Component),
+			})
+		}
+	}
+	for _, k := range templateKeys {
+		if !contains(targetKeys, k.key) {
+			issues = append(issues, &ParamsIssue{
+				Path:    k.file,
+				Line:    k.line,
+				Message: fmt.Sprintf("%v isn't defined in %v, which helmify replaces with this template", k.key, p.Target),
+			})
+		}
+	}
+	return issues, nil
+}
@@ -0,0 +1,239 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestParamsContract builds every kustomization package below KustomizeRoots whose generators read env
+// files and checks that their keys are consumed and that every reference to a generated key is defined,
+// see checkParams
+func TestParamsContract(t *testing.T) {
+	packages, err := DiscoverKustomizePackages(RepoRoot, KustomizeRoots)
+	if err != nil {
+		t.Fatalf("Could not discover kustomization packages; error: %v", err)
+	}
+
+	reported := map[string]bool{}
+	for _, rpath := range packages {
+		rpath := rpath
+		p, err := loadParamsPackage(RepoRoot, rpath)
+		if err != nil {
+			t.Errorf("Could not read %v; error: %v", rpath, err)
+			continue
+		}
+		hasEnv := false
+		for _, g := range p.generators {
+			hasEnv = hasEnv || len(g.envKeys) > 0
+		}
+		if !hasEnv {
+			continue
+		}
+
+		t.Run(rpath, func(t *testing.T) {
+			upstream, err := RequiresUpstream(RepoRoot, rpath)
+			if err != nil {
+				t.Fatalf("Could not read %v; error: %v", rpath, err)
+			}
+			if upstream && !dirExists(filepath.Join(RepoRoot, UpstreamDir)) {
+				t.Skipf("%v requires kubeflow/manifests to be cloned into %v", rpath, UpstreamDir)
+			}
+
+			resources := buildPackage(t, filepath.Join(RepoRoot, rpath), KrustyEngine)
+			issues, err := checkParams(RepoRoot, rpath, resources)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, i := range issues {
+				// The vars of a base are checked again by the packages that include it
+				if !reported[i.String()] {
+					reported[i.String()] = true
+					t.Error(i)
+				}
+			}
+		})
+	}
+}
+
+// TestHelmifyParams verifies that the params.env files in the params of the helmify configuration have the
+// same keys as the templates helmify replaces them with
+func TestHelmifyParams(t *testing.T) {
+	params, err := LoadHelmifyParams(RepoRoot)
+	if err != nil {
+		t.Fatalf("Could not load the helmify params; error: %v", err)
+	}
+	for _, p := range params {
+		issues, err := compareHelmifyParams(RepoRoot, p)
+		if err != nil {
+			t.Errorf("Could not compare %v to %v; error: %v", p.Target, p.Template, err)
+			continue
+		}
+		for _, i := range issues {
+			t.Error(i)
+		}
+	}
+}
+
+func TestCheckParams(t *testing.T) {
+	root, err := ioutil.TempDir("", "params")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	files := map[string]string{
+		"base/kustomization.yaml": `resources:
+- deployment.yaml
+configMapGenerator:
+- name: app-config
+  envs:
+  - params.env
+`,
+		"base/params.env": `# Read by the deployment
+PORT=8080
+UNUSED=
+`,
+		"base/deployment.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        args: [--region=$(region)]
+        env:
+        - name: PORT
+          valueFrom:
+            configMapKeyRef:
+              name: app-config
+              key: PORT
+        - name: HOST
+          valueFrom:
+            configMapKeyRef:
+              name: app-config
+              key: HOST
+        envFrom:
+        - configMapRef:
+            name: all-config
+`,
+		"overlay/kustomization.yaml": `resources:
+- ../base
+configMapGenerator:
+- name: app-config
+  behavior: merge
+  envs:
+  - params.env
+- name: all-config
+  envs:
+  - all.env
+vars:
+- name: region
+  objref:
+    kind: ConfigMap
+    name: app-config
+    apiVersion: v1
+  fieldref:
+    fieldpath: data.region
+`,
+		// kustomize fails to build a var whose field is missing, so the package is checked without building it
+		"vars/kustomization.yaml": `configMapGenerator:
+- name: vars-config
+  literals:
+  - region=us-west-2
+vars:
+- name: zone
+  objref:
+    kind: ConfigMap
+    name: vars-config
+    apiVersion: v1
+  fieldref:
+    fieldpath: data.zone
+`,
+		"overlay/params.env": "region=us-west-2\nPORT=80\nSTALE=x\n",
+		"overlay/all.env":    "A=1\nB=2\n",
+		"template.env":       "region={{ .Values.region }}\nPORT={{ .Values.port }}\nextra={{ .Values.extra }}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type testCase struct {
+		Package  string
+		Build    bool
+		Expected []string
+	}
+
+	testCases := []testCase{
+		{
+			Package: "base",
+			Build:   true,
+			Expected: []string{
+				"base/params.env:3: UNUSED of ConfigMap app-config isn't used by a var, a key reference, an envFrom or a volume of base",
+				"base/kustomization.yaml: resource apps/v1 Deployment app references HOST of ConfigMap app-config, which no generator defines",
+			},
+		},
+		{
+			Package: "overlay",
+			Build:   true,
+			Expected: []string{
+				"overlay/params.env:3: STALE of ConfigMap app-config isn't used by a var, a key reference, an envFrom or a volume of overlay",
+				"overlay/kustomization.yaml: resource apps/v1 Deployment app references HOST of ConfigMap app-config, which no generator defines",
+			},
+		},
+		{
+			Package: "vars",
+			Expected: []string{
+				"vars/kustomization.yaml:6: var zone references zone of ConfigMap vars-config, which no generator defines",
+			},
+		},
+	}
+
+	for _, c := range testCases {
+		var resources []*builtResource
+		if c.Build {
+			var err error
+			if resources, err = buildKrusty(filepath.Join(root, c.Package)); err != nil {
+				t.Errorf("Could not build %v; error: %v", c.Package, err)
+				continue
+			}
+		}
+		issues, err := checkParams(root, c.Package, resources)
+		if err != nil {
+			t.Errorf("Could not check %v; error: %v", c.Package, err)
+			continue
+		}
+		var actual []string
+		for _, i := range issues {
+			actual = append(actual, i.String())
+		}
+		if strings.Join(actual, "\n") != strings.Join(c.Expected, "\n") {
+			t.Errorf("%v: got issues\n%v\nwant\n%v", c.Package, strings.Join(actual, "\n"), strings.Join(c.Expected, "\n"))
+		}
+	}
+
+	issues, err := compareHelmifyParams(root, HelmifyParams{Component: "app", Template: "template.env", Target: "overlay/params.env"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual []string
+	for _, i := range issues {
+		actual = append(actual, i.String())
+	}
+	expected := []string{
+		"overlay/params.env:3: STALE is missing from the helmify template template.env of app",
+		"template.env:3: extra isn't defined in overlay/params.env, which helmify replaces with this template",
+	}
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got issues\n%v\nwant\n%v", strings.Join(actual, "\n"), strings.Join(expected, "\n"))
+	}
+}
@@ -0,0 +1,258 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// HelmifyConfig is the helmify configuration, relative to the repository root, that declares the
+	// kustomization paths each chart is generated from
+	HelmifyConfig = "tools/helmify/src/config.yaml"
+	// ParityAllowlistFile lists the intended differences between charts and their kustomizations
+	ParityAllowlistFile = "helm_parity_allowlist.yaml"
+)
+
+// helmifyComponent is a component of the helmify configuration. Components with several deployment
+// options declare a chart per option instead of a single chart.
+type helmifyComponent struct {
+	KustomizationPaths  []string                    `json:"kustomization_paths,omitempty"`
+	OutputHelmChartPath string                      `json:"output_helm_chart_path,omitempty"`
+	DeploymentOptions   map[string]helmifyComponent `json:"deployment_options,omitempty"`
+	Params              *helmifyFiles               `json:"params,omitempty"`
+}
+
+// helmifyFiles are the templates helmify copies over the files at the same index of TargetPaths before it
+// builds the charts of a component
+type helmifyFiles struct {
+	TemplatePaths []string `json:"template_paths,omitempty"`
+	TargetPaths   []string `json:"target_paths,omitempty"`
+}
+
+// HelmifyChart is a chart generated by helmify and the kustomizations it is generated from
+type HelmifyChart struct {
+	// Name is the component, followed by the deployment option if there is one, e.g. kubeflow-pipelines/rds-s3
+	Name string
+	// KustomizationPaths are relative to the repository root
+	KustomizationPaths []string
+	// Chart is the chart directory relative to the repository root
+	Chart string
+}
+
+// LoadHelmifyCharts returns the charts declared in the helmify configuration sorted by name
+func LoadHelmifyCharts(repoRoot string) ([]HelmifyChart, error) {
+	components, err := loadHelmifyConfig(repoRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var charts []HelmifyChart
+	for name, c := range components {
+		if c.OutputHelmChartPath != "" {
+			charts = append(charts, newHelmifyChart(name, c))
+		}
+		for option, o := range c.DeploymentOptions {
+			charts = append(charts, newHelmifyChart(name+"/"+option, o))
+		}
+	}
+	sort.Slice(charts, func(i, j int) bool {
+		return charts[i].Name < charts[j].Name
+	})
+	return charts, nil
+}
+
+// loadHelmifyConfig returns the components of the helmify configuration by name
+func loadHelmifyConfig(repoRoot string) (map[string]helmifyComponent, error) {
+	data, err := ioutil.ReadFile(filepath.Join(repoRoot, HelmifyConfig))
+	if err != nil {
+		return nil, err
+	}
+	components := map[string]helmifyComponent{}
+	if err := yaml.Unmarshal(data, &components); err != nil {
+		return nil, fmt.Errorf("could not parse %v; error: %v", HelmifyConfig, err)
+	}
+	return components, nil
+}
+
+func newHelmifyChart(name string, c helmifyComponent) HelmifyChart {
+	paths := make([]string, 0, len(c.KustomizationPaths))
+	for _, p := range c.KustomizationPaths {
+		paths = append(paths, filepath.Clean(p))
+	}
+	return HelmifyChart{
+		Name:               name,
+		KustomizationPaths: paths,
+		Chart:              filepath.Clean(c.OutputHelmChartPath),
+	}
+}
+
+// generatorHash matches the content hash kustomize appends to the names of generated ConfigMaps and Secrets
+var generatorHash = regexp.MustCompile(`-[2456789bcdfghkmt]{10}$`)
+
+// normalizeGeneratedNames replaces the content hash in the names of generated ConfigMaps and Secrets, and
+// in every reference to them, with a placeholder. helmify builds charts with the templated params from
+// tools/helmify/template, so the hashes in a chart never match those of its kustomizations.
+func normalizeGeneratedNames(resources []*builtResource) []*builtResource {
+	names := map[string]string{}
+	for _, r := range resources {
+		if (r.kind == "ConfigMap" || r.kind == "Secret") && generatorHash.MatchString(r.name) {
+			names[r.name] = generatorHash.ReplaceAllString(r.name, "-<hash>")
+		}
+	}
+	if len(names) == 0 {
+		return resources
+	}
+
+	normalized := make([]*builtResource, 0, len(resources))
+	for _, r := range resources {
+		data := r.yaml
+		for name, replacement := range names {
+			data = bytes.Replace(data, []byte(name), []byte(replacement), -1)
+		}
+		name := r.name
+		if replacement, ok := names[name]; ok {
+			name = replacement
+		}
+		normalized = append(normalized, newBuiltResource(r.group, r.version, r.kind, r.namespace, name, data))
+	}
+	return normalized
+}
+
+// ParityException allows a chart to differ from its kustomizations, e.g. where helmify injects a
+// value from tools/helmify/template
+type ParityException struct {
+	// Chart is the chart directory relative to the repository root
+	Chart string `json:"chart"`
+	// Resource matches the key of a resource, e.g. "v1 ConfigMap istio-system/authservice-config-*"
+	Resource string `json:"resource"`
+	// Fields match the paths of the fields that may differ, e.g. "data.LOGOUT_URL".
+	// If empty the resource may differ entirely or only exist on one side.
+	Fields []string `json:"fields,omitempty"`
+	// Reason explains why the difference is intended
+	Reason string `json:"reason"`
+
+	used bool
+}
+
+func (e *ParityException) validate() error {
+	if e.Chart == "" || e.Resource == "" || e.Reason == "" {
+		return errors.New("needs a chart, a resource and a reason")
+	}
+	return nil
+}
+
+// loadParityAllowlist reads the allowlist in path
+func loadParityAllowlist(path string) ([]*ParityException, error) {
+	var exceptions []*ParityException
+	if err := loadAllowlist(path, &exceptions); err != nil {
+		return nil, err
+	}
+	for _, e := range exceptions {
+		e.Chart = filepath.Clean(e.Chart)
+	}
+	return exceptions, nil
+}
+
+// allows reports whether the exception allows the field at fieldPath of resource rKey in chart to
+// differ. An empty fieldPath stands for the whole resource.
+func (e *ParityException) allows(chart string, rKey string, fieldPath string) bool {
+	if e.Chart != chart || !matchPattern(e.Resource, rKey) {
+		return false
+	}
+	if len(e.Fields) == 0 {
+		e.used = true
+		return true
+	}
+	if fieldPath == "" {
+		return false
+	}
+	for _, f := range e.Fields {
+		if matchPattern(f, fieldPath) {
+			e.used = true
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern matches s against the pattern of an allowlist entry, in which * matches any text, including / and .
+func matchPattern(pattern string, s string) bool {
+	expr := "^" + strings.Replace(regexp.QuoteMeta(pattern), `\*`, ".*", -1) + "$"
+	matched, err := regexp.MatchString(expr, s)
+	return err == nil && matched
+}
+
+// ParityDifference is a difference between a chart and its kustomizations that is not on the allowlist
+type ParityDifference struct {
+	// Resource is the key of the resource
+	Resource string
+	// Message describes the difference
+	Message string
+}
+
+// compareParity compares the resources built from the kustomizations of chart to the rendered resources
+// and returns the differences that aren't allowed by exceptions. Generated names are compared without
+// their content hash, see normalizeGeneratedNames.
+func compareParity(chart string, built []*builtResource, rendered []*builtResource, exceptions []*ParityException) ([]ParityDifference, error) {
+	built = normalizeGeneratedNames(built)
+	rendered = normalizeGeneratedNames(rendered)
+	allowed := func(rKey string, fieldPath string) bool {
+		for _, e := range exceptions {
+			if e.allows(chart, rKey, fieldPath) {
+				return true
+			}
+		}
+		return false
+	}
+
+	renderedByKey := map[string]*builtResource{}
+	for _, r := range rendered {
+		renderedByKey[r.Key()] = r
+	}
+
+	var differences []ParityDifference
+	for _, b := range built {
+		rKey := b.Key()
+		r, ok := renderedByKey[rKey]
+		if !ok {
+			if !allowed(rKey, "") {
+				differences = append(differences, ParityDifference{rKey, "built by kustomize but not rendered by the chart"})
+			}
+			continue
+		}
+		delete(renderedByKey, rKey)
+
+		paths, err := semanticDiff(r.yaml, b.yaml)
+		if err != nil {
+			return nil, fmt.Errorf("could not compare resource %v; error: %v", rKey, err)
+		}
+		var unexpected []string
+		for _, p := range paths {
+			if !allowed(rKey, p) {
+				unexpected = append(unexpected, p)
+			}
+		}
+		if len(unexpected) > 0 {
+			differences = append(differences, ParityDifference{rKey, fmt.Sprintf("differs in\n  %v\n%v",
+				strings.Join(unexpected, "\n  "), labeledDiff("kustomize", b.yaml, "helm", r.yaml))})
+		}
+	}
+	for rKey := range renderedByKey {
+		if !allowed(rKey, "") {
+			differences = append(differences, ParityDifference{rKey, "rendered by the chart but not built by kustomize"})
+		}
+	}
+
+	sort.Slice(differences, func(i, j int) bool {
+		return differences[i].Resource < differences[j].Resource
+	})
+	return differences, nil
+}
@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompareParity(t *testing.T) {
+	built := []*builtResource{
+		newBuiltResource("", "v1", "ConfigMap", "kubeflow", "config-fb8f25k8g2", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config-fb8f25k8g2
+  namespace: kubeflow
+data:
+  url: ""
+`)),
+		newBuiltResource("apps", "v1", "Deployment", "kubeflow", "app", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: kubeflow
+spec:
+  replicas: 1
+  template:
+    spec:
+      volumes:
+      - configMap:
+          name: config-fb8f25k8g2
+`)),
+	}
+	rendered := []*builtResource{
+		newBuiltResource("", "v1", "ConfigMap", "kubeflow", "config-c9f7d7t7db", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config-c9f7d7t7db
+  namespace: kubeflow
+data:
+  url: null
+`)),
+		newBuiltResource("apps", "v1", "Deployment", "kubeflow", "app", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: kubeflow
+spec:
+  replicas: 2
+  template:
+    spec:
+      volumes:
+      - configMap:
+          name: config-c9f7d7t7db
+`)),
+	}
+	exceptions := []*ParityException{
+		{Chart: "charts/app", Resource: "v1 ConfigMap kubeflow/config-*", Fields: []string{"data.*"}, Reason: "templated"},
+		{Chart: "charts/other", Resource: "*", Reason: "other chart"},
+	}
+
+	differences, err := compareParity("charts/app", built, rendered, exceptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(differences) != 1 {
+		t.Fatalf("got %v differences; want 1: %v", len(differences), differences)
+	}
+	if differences[0].Resource != "apps/v1 Deployment kubeflow/app" || !strings.Contains(differences[0].Message, "spec.replicas") {
+		t.Errorf("got %v; want a difference in spec.replicas of the Deployment", differences[0])
+	}
+	if !exceptions[0].used || exceptions[1].used {
+		t.Errorf("got used %v and %v; want only the first exception to be used", exceptions[0].used, exceptions[1].used)
+	}
+}
@@ -0,0 +1,283 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+// PlaceholderAllowlistFile lists the $(...) tokens that are intended in built resources
+const PlaceholderAllowlistFile = "placeholder_allowlist.yaml"
+
+// PlaceholderException allows $(...) tokens in fields of a resource, e.g. the command substitutions of a shell
+// script
+type PlaceholderException struct {
+	// Resource matches the key of a resource, e.g. "batch/v1 Job kubeflow/aws-kubeflow-telemetry"
+	Resource string `json:"resource"`
+	// Fields match the paths of the fields, e.g. "spec.template.spec.containers[0].command[2]".
+	// If empty the tokens are allowed in every field.
+	Fields []string `json:"fields,omitempty"`
+	// Tokens match the tokens, e.g. "$(curl *)"
+	Tokens []string `json:"tokens"`
+	// Reason explains why the tokens are intended
+	Reason string `json:"reason"`
+}
+
+func (e *PlaceholderException) validate() error {
+	if e.Resource == "" || len(e.Tokens) == 0 || e.Reason == "" {
+		return errors.New("needs a resource, tokens and a reason")
+	}
+	return nil
+}
+
+// loadPlaceholderAllowlist reads the allowlist in path
+func loadPlaceholderAllowlist(path string) ([]*PlaceholderException, error) {
+	var exceptions []*PlaceholderException
+	if err := loadAllowlist(path, &exceptions); err != nil {
+		return nil, err
+	}
+	return exceptions, nil
+}
+
+// allows reports whether the exception allows token in the field at fieldPath of resource rKey
+func (e *PlaceholderException) allows(rKey string, fieldPath string, token string) bool {
+	if !matchPattern(e.Resource, rKey) {
+		return false
+	}
+	if len(e.Fields) > 0 && !matchAny(e.Fields, fieldPath) {
+		return false
+	}
+	return matchAny(e.Tokens, token)
+}
+
+// matchAny reports whether s matches one of the patterns, see matchPattern
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if matchPattern(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Placeholder is a $(...) token in a field of a built resource
+type Placeholder struct {
+	Resource string
+	// Path is the path of the field, e.g. metadata.annotations["alb.ingress.kubernetes.io/certificate-arn"]
+	Path  string
+	Token string
+}
+
+// envVarReference matches a reference to an environment variable that Kubernetes expands in the command,
+// args and env of a container
+var envVarReference = regexp.MustCompile(`^\$\(([-._a-zA-Z][-._a-zA-Z0-9]*)\)$`)
+
+// containerFields are the fields of a pod spec that hold containers
+var containerFields = []string{"containers", "initContainers", "ephemeralContainers"}
+
+// findPlaceholders returns the $(...) tokens in the string fields of the resources that are neither references
+// to an environment variable of their container nor allowed by an exception. A kustomize var whose
+// varReference doesn't cover a field is left in the built resource as $(name).
+func findPlaceholders(resources []*builtResource, exceptions []*PlaceholderException) ([]*Placeholder, error) {
+	objects := map[string]map[string]interface{}{}
+	for _, r := range resources {
+		object := map[string]interface{}{}
+		if err := yaml.Unmarshal(r.yaml, &object); err != nil {
+			return nil, fmt.Errorf("could not parse resource %v; error: %v", r.Key(), err)
+		}
+		objects[r.Key()] = object
+	}
+
+	var placeholders []*Placeholder
+	for _, r := range resources {
+		object := objects[r.Key()]
+		envVars := containerEnvVars(r, object, objects)
+		walkStrings("", object, func(path string, s string) {
+			for _, token := range findTokens(s) {
+				if m := envVarReference.FindStringSubmatch(token); m != nil {
+					if vars, ok := envVars[containerOf(path)]; ok && (vars == nil || vars[m[1]]) {
+						continue
+					}
+				}
+				allowed := false
+				for _, e := range exceptions {
+					allowed = allowed || e.allows(r.Key(), path, token)
+				}
+				if !allowed {
+					placeholders = append(placeholders, &Placeholder{Resource: r.Key(), Path: path, Token: token})
+				}
+			}
+		})
+	}
+	return placeholders, nil
+}
+
+// findTokens returns the $(...) tokens in s with balanced parentheses. $$( escapes a token like in Kubernetes.
+func findTokens(s string) []string {
+	var tokens []string
+	for i := 0; i+1 < len(s); i++ {
+		if s[i] != '$' {
+			continue
+		}
+		if s[i+1] == '$' {
+			i++
+			continue
+		}
+		if s[i+1] != '(' {
+			continue
+		}
+		depth := 0
+		end := len(s)
+		for j := i + 1; j < len(s); j++ {
+			if s[j] == '(' {
+				depth++
+			} else if s[j] == ')' {
+				depth--
+				if depth == 0 {
+					end = j + 1
+					break
+				}
+			}
+		}
+		tokens = append(tokens, s[i:end])
+		i = end - 1
+	}
+	return tokens
+}
+
+// walkStrings calls visit with the path of every string in value
+func walkStrings(path string, value interface{}, visit func(path string, s string)) {
+	switch v := value.(type) {
+	case string:
+		visit(path, v)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			walkStrings(fieldPath(path, k), v[k], visit)
+		}
+	case []interface{}:
+		for i, e := range v {
+			walkStrings(fmt.Sprintf("%s[%d]", path, i), e, visit)
+		}
+	}
+}
+
+// containerExpansion matches the fields of a container in which Kubernetes expands environment variables and
+// captures the path of the container
+var containerExpansion = regexp.MustCompile(`^(.*(?:` + strings.Join(containerFields, "|") + `)\[\d+\])\.(?:command\[\d+\]|args\[\d+\]|env\[\d+\]\.value)$`)
+
+// containerOf returns the path of the container whose command, args or env holds the field at path, or ""
+func containerOf(path string) string {
+	if m := containerExpansion.FindStringSubmatch(path); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// containerEnvVars returns the environment variables of every container of a workload by the path of the
+// container. The variables of a container are nil if it imports a ConfigMap or Secret that isn't in the build
+// with envFrom, since any name may be defined then.
+func containerEnvVars(r *builtResource, object map[string]interface{}, objects map[string]map[string]interface{}) map[string]map[string]bool {
+	specPath := []string{"spec"}
+	if r.kind != "Pod" {
+		path, ok := podTemplatePaths[r.kind]
+		if !ok {
+			return nil
+		}
+		specPath = append(append([]string{}, path...), "spec")
+	}
+	spec, ok := nested(object, specPath...).(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	envVars := map[string]map[string]bool{}
+	for _, field := range containerFields {
+		containers, _ := spec[field].([]interface{})
+		for i, c := range containers {
+			container, _ := c.(map[string]interface{})
+			vars := map[string]bool{}
+			env, _ := container["env"].([]interface{})
+			for _, e := range env {
+				if e, ok := e.(map[string]interface{}); ok {
+					vars[fmt.Sprint(e["name"])] = true
+				}
+			}
+			envFrom, _ := container["envFrom"].([]interface{})
+			for _, e := range envFrom {
+				keys, ok := envFromKeys(r.namespace, e, objects)
+				if !ok {
+					vars = nil
+					break
+				}
+				for _, k := range keys {
+					vars[k] = true
+				}
+			}
+			envVars[fmt.Sprintf("%s.%s[%d]", strings.Join(specPath, "."), field, i)] = vars
+		}
+	}
+	return envVars
+}
+
+// envFromKeys returns the names of the variables an envFrom source of a container defines, or false if
+// its ConfigMap or Secret isn't in the build
+func envFromKeys(namespace string, source interface{}, objects map[string]map[string]interface{}) ([]string, bool) {
+	s, _ := source.(map[string]interface{})
+	prefix, _ := s["prefix"].(string)
+	var object map[string]interface{}
+	if ref, ok := s["configMapRef"].(map[string]interface{}); ok {
+		object = objects[key("v1", "ConfigMap", namespace, fmt.Sprint(ref["name"]))]
+	} else if ref, ok := s["secretRef"].(map[string]interface{}); ok {
+		object = objects[key("v1", "Secret", namespace, fmt.Sprint(ref["name"]))]
+	}
+	if object == nil {
+		return nil, false
+	}
+	var keys []string
+	for _, field := range []string{"data", "stringData", "binaryData"} {
+		data, _ := object[field].(map[string]interface{})
+		for k := range data {
+			keys = append(keys, prefix+k)
+		}
+	}
+	return keys, true
+}
+
+var (
+	defaultPlaceholderAllowlistOnce sync.Once
+	defaultPlaceholderAllowlist     []*PlaceholderException
+	defaultPlaceholderAllowlistErr  error
+)
+
+// checkPlaceholders fails the test for every $(...) token in the resources that isn't in PlaceholderAllowlistFile,
+// see findPlaceholders
+func checkPlaceholders(t *testing.T, resources []*builtResource) {
+	t.Helper()
+	defaultPlaceholderAllowlistOnce.Do(func() {
+		defaultPlaceholderAllowlist, defaultPlaceholderAllowlistErr = loadPlaceholderAllowlist(filepath.Join(unitTestsDir(), PlaceholderAllowlistFile))
+	})
+	if defaultPlaceholderAllowlistErr != nil {
+		t.Fatalf("Could not load %v; error: %v", PlaceholderAllowlistFile, defaultPlaceholderAllowlistErr)
+	}
+
+	placeholders, err := findPlaceholders(resources, defaultPlaceholderAllowlist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range placeholders {
+		t.Errorf("Resource %v has an unresolved placeholder %v at %v; check the vars and varReference of the kustomization or add it to %v",
+			p.Resource, p.Token, p.Path, PlaceholderAllowlistFile)
+	}
+}
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"testing"
+)
+
+func TestFindTokens(t *testing.T) {
+	type testCase struct {
+		s        string
+		expected []string
+	}
+	testCases := []testCase{
+		{s: "arn:$(certArn)", expected: []string{"$(certArn)"}},
+		{s: `{"UserPoolArn":"$(CognitoUserPoolArn)","UserPoolClientId":"$(CognitoAppClientId)"}`, expected: []string{"$(CognitoUserPoolArn)", "$(CognitoAppClientId)"}},
+		{s: "REGION=$(curl -s | awk '{print substr($1, 1, length($1)-1)}')", expected: []string{"$(curl -s | awk '{print substr($1, 1, length($1)-1)}')"}},
+		{s: "sleep $((1 + $RANDOM % 300))", expected: []string{"$((1 + $RANDOM % 300))"}},
+		{s: "escaped $$(VAR) and ${VAR}"},
+		{s: "unterminated $(VAR", expected: []string{"$(VAR"}},
+	}
+	for _, c := range testCases {
+		actual := findTokens(c.s)
+		if len(actual) != len(c.expected) {
+			t.Errorf("findTokens(%q): got %q; want %q", c.s, actual, c.expected)
+			continue
+		}
+		for i := range actual {
+			if actual[i] != c.expected[i] {
+				t.Errorf("findTokens(%q): got %q; want %q", c.s, actual, c.expected)
+				break
+			}
+		}
+	}
+}
+
+func TestFindPlaceholders(t *testing.T) {
+	resources := []*builtResource{
+		newBuiltResource("networking.k8s.io", "v1", "Ingress", "istio-system", "istio-ingress", []byte(`apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: istio-ingress
+  namespace: istio-system
+  annotations:
+    alb.ingress.kubernetes.io/certificate-arn: $(certArn)
+    alb.ingress.kubernetes.io/scheme: internet-facing
+`)),
+		newBuiltResource("", "v1", "ConfigMap", "kubeflow", "config", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: kubeflow
+data:
+  DB_HOST: mysql
+`)),
+		newBuiltResource("apps", "v1", "Deployment", "kubeflow", "app", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: kubeflow
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        args:
+        - --db_user=$(DB_USER)
+        - --db_host=$(DB_HOST)
+        - --region=$(AWS_REGION)
+        command:
+        - sh
+        - -c
+        - REGION=$(curl -s http://169.254.169.254/latest/meta-data/placement/region)
+        env:
+        - name: DB_USER
+          value: root
+        - name: DB_URL
+          value: $(DB_HOST):3306
+        envFrom:
+        - configMapRef:
+            name: config
+      - name: sidecar
+        args:
+        - --user=$(DB_USER)
+        envFrom:
+        - secretRef:
+            name: external
+`)),
+	}
+	exceptions := []*PlaceholderException{
+		{
+			Resource: "apps/v1 Deployment kubeflow/app",
+			Fields:   []string{"spec.template.spec.containers[*].command[*]"},
+			Tokens:   []string{"$(curl *)"},
+			Reason:   "shell",
+		},
+	}
+
+	placeholders, err := findPlaceholders(resources, exceptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Placeholder{
+		{
+			Resource: "networking.k8s.io/v1 Ingress istio-system/istio-ingress",
+			Path:     `metadata.annotations["alb.ingress.kubernetes.io/certificate-arn"]`,
+			Token:    "$(certArn)",
+		},
+		{
+			Resource: "apps/v1 Deployment kubeflow/app",
+			Path:     "spec.template.spec.containers[0].args[2]",
+			Token:    "$(AWS_REGION)",
+		},
+	}
+	if len(placeholders) != len(expected) {
+		for _, p := range placeholders {
+			t.Logf("got placeholder %+v", *p)
+		}
+		t.Fatalf("got %d placeholders; want %d", len(placeholders), len(expected))
+	}
+	for i, p := range placeholders {
+		if *p != expected[i] {
+			t.Errorf("got placeholder %+v; want %+v", *p, expected[i])
+		}
+	}
+}
@@ -0,0 +1,512 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// PodSecurityBaselineFile lists the controls of the Pod Security Standards that workloads are known to violate
+const PodSecurityBaselineFile = "pod_security_baseline.yaml"
+
+// PodSecurityLevel is a level of the Pod Security Standards, see
+// https://kubernetes.io/docs/concepts/security/pod-security-standards/
+type PodSecurityLevel string
+
+const (
+	// PodSecurityPrivileged is unrestricted
+	PodSecurityPrivileged PodSecurityLevel = "privileged"
+	// PodSecurityBaseline prevents known privilege escalations
+	PodSecurityBaseline PodSecurityLevel = "baseline"
+	// PodSecurityRestricted follows the pod hardening best practices
+	PodSecurityRestricted PodSecurityLevel = "restricted"
+)
+
+// podTemplate is the pod template of a workload, or a pod
+type podTemplate struct {
+	// path is the path of the template in the resource, e.g. spec.template, or "" for a pod
+	path     string
+	metadata map[string]interface{}
+	spec     map[string]interface{}
+}
+
+// field returns the path of a field of the pod template
+func (p *podTemplate) field(path string) string {
+	if p.path == "" {
+		return path
+	}
+	return p.path + "." + path
+}
+
+// labels returns the labels of the pod template
+func (p *podTemplate) labels() map[string]string {
+	labels := map[string]string{}
+	l, _ := p.metadata["labels"].(map[string]interface{})
+	for k, v := range l {
+		labels[k] = fmt.Sprint(v)
+	}
+	return labels
+}
+
+// parsePodTemplate returns the pod template of a workload in podTemplatePaths or a pod, or nil for other resources
+func parsePodTemplate(r *builtResource) (*podTemplate, error) {
+	path, ok := podTemplatePaths[r.kind]
+	if !ok && r.kind != "Pod" {
+		return nil, nil
+	}
+	object := map[string]interface{}{}
+	if err := yaml.Unmarshal(r.yaml, &object); err != nil {
+		return nil, fmt.Errorf("could not parse resource %v; error: %v", r.Key(), err)
+	}
+	template := object
+	if r.kind != "Pod" {
+		if template, ok = nested(object, path...).(map[string]interface{}); !ok {
+			return nil, nil
+		}
+	}
+	p := &podTemplate{path: strings.Join(path, ".")}
+	p.metadata, _ = template["metadata"].(map[string]interface{})
+	p.spec, _ = template["spec"].(map[string]interface{})
+	return p, nil
+}
+
+// podContainer is a container of a pod template
+type podContainer struct {
+	// path is the path of the container in the resource, e.g. spec.template.spec.containers[0]
+	path      string
+	container map[string]interface{}
+}
+
+// containers returns the containers, init containers and ephemeral containers of the pod template
+func (p *podTemplate) containers() []podContainer {
+	var containers []podContainer
+	for _, field := range containerFields {
+		list, _ := p.spec[field].([]interface{})
+		for i, c := range list {
+			if container, ok := c.(map[string]interface{}); ok {
+				containers = append(containers, podContainer{path: p.field(fmt.Sprintf("spec.%s[%d]", field, i)), container: container})
+			}
+		}
+	}
+	return containers
+}
+
+// podSecurityControl is a control of the Pod Security Standards
+type podSecurityControl struct {
+	// id is the level that requires the control followed by its name, e.g. baseline/host-namespaces
+	id string
+	// level is the lowest level that requires the control
+	level PodSecurityLevel
+	// check returns the fields of the pod template that violate the control
+	check func(p *podTemplate) []string
+}
+
+// baselineCapabilities are the capabilities the baseline level allows containers to add
+var baselineCapabilities = map[string]bool{
+	"AUDIT_WRITE": true, "CHOWN": true, "DAC_OVERRIDE": true, "FOWNER": true, "FSETID": true, "KILL": true, "MKNOD": true,
+	"NET_BIND_SERVICE": true, "SETFCAP": true, "SETGID": true, "SETPCAP": true, "SETUID": true, "SYS_CHROOT": true,
+}
+
+// safeSysctls are the sysctls the baseline level allows
+var safeSysctls = map[string]bool{
+	"kernel.shm_rmid_forced": true, "net.ipv4.ip_local_port_range": true, "net.ipv4.ip_unprivileged_port_start": true,
+	"net.ipv4.tcp_syncookies": true, "net.ipv4.ping_group_range": true,
+}
+
+// seLinuxTypes are the SELinux types the baseline level allows
+var seLinuxTypes = map[string]bool{
+	"": true, "container_t": true, "container_init_t": true, "container_kvm_t": true, "container_engine_t": true,
+}
+
+// restrictedVolumes are the volume types the restricted level allows
+var restrictedVolumes = map[string]bool{
+	"configMap": true, "csi": true, "downwardAPI": true, "emptyDir": true, "ephemeral": true,
+	"persistentVolumeClaim": true, "projected": true, "secret": true,
+}
+
+// podSecurityControls are the controls of the baseline and the restricted level
+var podSecurityControls = []*podSecurityControl{
+	{id: "baseline/host-namespaces", level: PodSecurityBaseline, check: func(p *podTemplate) []string {
+		var fields []string
+		for _, f := range []string{"hostNetwork", "hostPID", "hostIPC"} {
+			if p.spec[f] == true {
+				fields = append(fields, p.field("spec."+f))
+			}
+		}
+		return fields
+	}},
+	{id: "baseline/privileged", level: PodSecurityBaseline, check: func(p *podTemplate) []string {
+		var fields []string
+		for _, c := range p.containers() {
+			if nested(c.container, "securityContext", "privileged") == true {
+				fields = append(fields, c.path+".securityContext.privileged")
+			}
+		}
+		return fields
+	}},
+	{id: "baseline/capabilities", level: PodSecurityBaseline, check: func(p *podTemplate) []string {
+		var fields []string
+		for _, c := range p.containers() {
+			add, _ := nested(c.container, "securityContext", "capabilities", "add").([]interface{})
+			for i, capability := range add {
+				if !baselineCapabilities[fmt.Sprint(capability)] {
+					fields = append(fields, fmt.Sprintf("%s.securityContext.capabilities.add[%d]", c.path, i))
+				}
+			}
+		}
+		return fields
+	}},
+	{id: "baseline/host-path-volumes", level: PodSecurityBaseline, check: func(p *podTemplate) []string {
+		var fields []string
+		volumes, _ := p.spec["volumes"].([]interface{})
+		for i, v := range volumes {
+			if volume, ok := v.(map[string]interface{}); ok && volume["hostPath"] != nil {
+				fields = append(fields, p.field(fmt.Sprintf("spec.volumes[%d].hostPath", i)))
+			}
+		}
+		return fields
+	}},
+	{id: "baseline/host-ports", level: PodSecurityBaseline, check: func(p *podTemplate) []string {
+		var fields []string
+		for _, c := range p.containers() {
+			ports, _ := c.container["ports"].([]interface{})
+			for i, port := range ports {
+				if port, ok := port.(map[string]interface{}); ok && port["hostPort"] != nil && port["hostPort"] != float64(0) {
+					fields = append(fields, fmt.Sprintf("%s.ports[%d].hostPort", c.path, i))
+				}
+			}
+		}
+		return fields
+	}},
+	{id: "baseline/apparmor", level: PodSecurityBaseline, check: func(p *podTemplate) []string {
+		var fields []string
+		annotations, _ := p.metadata["annotations"].(map[string]interface{})
+		for name, profile := range annotations {
+			value := fmt.Sprint(profile)
+			if strings.HasPrefix(name, "container.apparmor.security.beta.kubernetes.io/") && value != "runtime/default" && !strings.HasPrefix(value, "localhost/") {
+				fields = append(fields, fieldPath(p.field("metadata.annotations"), name))
+			}
+		}
+		sort.Strings(fields)
+		return fields
+	}},
+	{id: "baseline/selinux", level: PodSecurityBaseline, check: func(p *podTemplate) []string {
+		var fields []string
+		check := func(path string, options interface{}) {
+			o, ok := options.(map[string]interface{})
+			if !ok {
+				return
+			}
+			seLinuxType, _ := o["type"].(string)
+			if !seLinuxTypes[seLinuxType] || o["user"] != nil || o["role"] != nil {
+				fields = append(fields, path)
+			}
+		}
+		check(p.field("spec.securityContext.seLinuxOptions"), nested(p.spec, "securityContext", "seLinuxOptions"))
+		for _, c := range p.containers() {
+			check(c.path+".securityContext.seLinuxOptions", nested(c.container, "securityContext", "seLinuxOptions"))
+		}
+		return fields
+	}},
+	{id: "baseline/proc-mount", level: PodSecurityBaseline, check: func(p *podTemplate) []string {
+		var fields []string
+		for _, c := range p.containers() {
+			if mount := nested(c.container, "securityContext", "procMount"); mount != nil && mount != "Default" {
+				fields = append(fields, c.path+".securityContext.procMount")
+			}
+		}
+		return fields
+	}},
+	{id: "baseline/seccomp", level: PodSecurityBaseline, check: func(p *podTemplate) []string {
+		var fields []string
+		if nested(p.spec, "securityContext", "seccompProfile", "type") == "Unconfined" {
+			fields = append(fields, p.field("spec.securityContext.seccompProfile.type"))
+		}
+		for _, c := range p.containers() {
+			if nested(c.container, "securityContext", "seccompProfile", "type") == "Unconfined" {
+				fields = append(fields, c.path+".securityContext.seccompProfile.type")
+			}
+		}
+		return fields
+	}},
+	{id: "baseline/sysctls", level: PodSecurityBaseline, check: func(p *podTemplate) []string {
+		var fields []string
+		sysctls, _ := nested(p.spec, "securityContext", "sysctls").([]interface{})
+		for i, s := range sysctls {
+			if s, ok := s.(map[string]interface{}); ok && !safeSysctls[fmt.Sprint(s["name"])] {
+				fields = append(fields, p.field(fmt.Sprintf("spec.securityContext.sysctls[%d]", i)))
+			}
+		}
+		return fields
+	}},
+	{id: "restricted/volume-types", level: PodSecurityRestricted, check: func(p *podTemplate) []string {
+		var fields []string
+		volumes, _ := p.spec["volumes"].([]interface{})
+		for i, v := range volumes {
+			volume, _ := v.(map[string]interface{})
+			for source := range volume {
+				if source != "name" && !restrictedVolumes[source] {
+					fields = append(fields, p.field(fmt.Sprintf("spec.volumes[%d].%s", i, source)))
+				}
+			}
+		}
+		return fields
+	}},
+	{id: "restricted/privilege-escalation", level: PodSecurityRestricted, check: func(p *podTemplate) []string {
+		var fields []string
+		for _, c := range p.containers() {
+			if nested(c.container, "securityContext", "allowPrivilegeEscalation") != false {
+				fields = append(fields, c.path+".securityContext.allowPrivilegeEscalation")
+			}
+		}
+		return fields
+	}},
+	{id: "restricted/run-as-non-root", level: PodSecurityRestricted, check: func(p *podTemplate) []string {
+		var fields []string
+		pod := nested(p.spec, "securityContext", "runAsNonRoot")
+		for _, c := range p.containers() {
+			container := nested(c.container, "securityContext", "runAsNonRoot")
+			if container == false || (container == nil && pod != true) {
+				fields = append(fields, c.path+".securityContext.runAsNonRoot")
+			}
+		}
+		return fields
+	}},
+	{id: "restricted/run-as-user", level: PodSecurityRestricted, check: func(p *podTemplate) []string {
+		var fields []string
+		if nested(p.spec, "securityContext", "runAsUser") == float64(0) {
+			fields = append(fields, p.field("spec.securityContext.runAsUser"))
+		}
+		for _, c := range p.containers() {
+			if nested(c.container, "securityContext", "runAsUser") == float64(0) {
+				fields = append(fields, c.path+".securityContext.runAsUser")
+			}
+		}
+		return fields
+	}},
+	{id: "restricted/seccomp", level: PodSecurityRestricted, check: func(p *podTemplate) []string {
+		var fields []string
+		allowed := func(profile interface{}) bool {
+			return profile == "RuntimeDefault" || profile == "Localhost"
+		}
+		pod := nested(p.spec, "securityContext", "seccompProfile", "type")
+		for _, c := range p.containers() {
+			container := nested(c.container, "securityContext", "seccompProfile", "type")
+			if (container == nil && !allowed(pod)) || (container != nil && !allowed(container)) {
+				fields = append(fields, c.path+".securityContext.seccompProfile")
+			}
+		}
+		return fields
+	}},
+	{id: "restricted/capabilities", level: PodSecurityRestricted, check: func(p *podTemplate) []string {
+		var fields []string
+		for _, c := range p.containers() {
+			drop, _ := nested(c.container, "securityContext", "capabilities", "drop").([]interface{})
+			dropsAll := false
+			for _, capability := range drop {
+				dropsAll = dropsAll || capability == "ALL"
+			}
+			if !dropsAll {
+				fields = append(fields, c.path+".securityContext.capabilities.drop")
+			}
+			add, _ := nested(c.container, "securityContext", "capabilities", "add").([]interface{})
+			for i, capability := range add {
+				if capability != "NET_BIND_SERVICE" {
+					fields = append(fields, fmt.Sprintf("%s.securityContext.capabilities.add[%d]", c.path, i))
+				}
+			}
+		}
+		return fields
+	}},
+}
+
+// PodSecurityResult is the level of the Pod Security Standards that a workload achieves
+type PodSecurityResult struct {
+	// Resource is the key of the workload
+	Resource string
+	Level    PodSecurityLevel
+	// Violations are the fields that violate each control by the id of the control
+	Violations map[string][]string
+}
+
+// Controls returns the ids of the controls the workload violates, sorted
+func (r *PodSecurityResult) Controls() []string {
+	controls := make([]string, 0, len(r.Violations))
+	for id := range r.Violations {
+		controls = append(controls, id)
+	}
+	sort.Strings(controls)
+	return controls
+}
+
+// evaluatePodSecurity returns the level every pod and workload with a pod template in the resources achieves
+func evaluatePodSecurity(resources []*builtResource) ([]*PodSecurityResult, error) {
+	var results []*PodSecurityResult
+	for _, r := range resources {
+		p, err := parsePodTemplate(r)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			continue
+		}
+		result := &PodSecurityResult{Resource: r.Key(), Level: PodSecurityRestricted, Violations: map[string][]string{}}
+		for _, c := range podSecurityControls {
+			fields := c.check(p)
+			if len(fields) == 0 {
+				continue
+			}
+			result.Violations[c.id] = fields
+			result.Level = lowerLevel(result.Level, c.level)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// lowerLevel returns the level of a workload at level that violates a control of the level violated
+func lowerLevel(level PodSecurityLevel, violated PodSecurityLevel) PodSecurityLevel {
+	if violated == PodSecurityBaseline {
+		return PodSecurityPrivileged
+	}
+	if violated == PodSecurityRestricted && level == PodSecurityRestricted {
+		return PodSecurityBaseline
+	}
+	return level
+}
+
+// PodSecurityException is a workload of PodSecurityBaselineFile that is known to violate controls
+type PodSecurityException struct {
+	// Resource is the key of the workload, e.g. "apps/v1 Deployment istio-system/authservice"
+	Resource string `json:"resource"`
+	// Level is the level the workload achieves
+	Level PodSecurityLevel `json:"level"`
+	// Controls are the ids of the controls the workload violates, e.g. restricted/run-as-non-root
+	Controls []string `json:"controls"`
+}
+
+func (e *PodSecurityException) validate() error {
+	if e.Resource == "" || len(e.Controls) == 0 {
+		return errors.New("needs a resource and controls")
+	}
+	level := PodSecurityRestricted
+	for _, id := range e.Controls {
+		c := findPodSecurityControl(id)
+		if c == nil {
+			return fmt.Errorf("has an unknown control %v", id)
+		}
+		level = lowerLevel(level, c.level)
+	}
+	if e.Level != level {
+		return fmt.Errorf("has level %v, but %v violates %v, so its level is %v", e.Level, e.Resource, strings.Join(e.Controls, ", "), level)
+	}
+	return nil
+}
+
+// loadPodSecurityBaseline reads the known violations in path by resource
+func loadPodSecurityBaseline(path string) (map[string]*PodSecurityException, error) {
+	var list []*PodSecurityException
+	if err := loadAllowlist(path, &list); err != nil {
+		return nil, err
+	}
+	exceptions := map[string]*PodSecurityException{}
+	for _, e := range list {
+		exceptions[e.Resource] = e
+	}
+	return exceptions, nil
+}
+
+func findPodSecurityControl(id string) *podSecurityControl {
+	for _, c := range podSecurityControls {
+		if c.id == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// comparePodSecurity returns a message for every control a workload violates that the baseline doesn't list,
+// and for every listed control a workload no longer violates so that the baseline is tightened
+func comparePodSecurity(results []*PodSecurityResult, exceptions map[string]*PodSecurityException) []string {
+	var messages []string
+	for _, r := range results {
+		listed := map[string]bool{}
+		if e, ok := exceptions[r.Resource]; ok {
+			for _, id := range e.Controls {
+				listed[id] = true
+			}
+		}
+		for _, id := range r.Controls() {
+			if !listed[id] {
+				messages = append(messages, fmt.Sprintf("%v violates %v at %v, so its level is %v; fix it or add it to %v",
+					r.Resource, id, strings.Join(r.Violations[id], ", "), r.Level, PodSecurityBaselineFile))
+			}
+			delete(listed, id)
+		}
+		for id := range listed {
+			messages = append(messages, fmt.Sprintf("%v no longer violates %v; remove it from %v", r.Resource, id, PodSecurityBaselineFile))
+		}
+	}
+	sort.Strings(messages)
+	return messages
+}
+
+// writePodSecurityBaseline writes the violations of the results to path. Entries of workloads that weren't
+// evaluated are kept.
+func writePodSecurityBaseline(path string, results []*PodSecurityResult, exceptions map[string]*PodSecurityException) error {
+	evaluated := map[string]bool{}
+	for _, r := range results {
+		evaluated[r.Resource] = true
+		if len(r.Violations) == 0 {
+			delete(exceptions, r.Resource)
+			continue
+		}
+		exceptions[r.Resource] = &PodSecurityException{Resource: r.Resource, Level: r.Level, Controls: r.Controls()}
+	}
+	list := make([]*PodSecurityException, 0, len(exceptions))
+	for _, e := range exceptions {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Resource < list[j].Resource })
+
+	// Written by hand to keep the resource first, since yaml.Marshal sorts the fields
+	var b strings.Builder
+	b.WriteString("# The controls of the Pod Security Standards that workloads are known to violate, checked by\n" +
+		"# TestPodSecurityStandards. Only packages that don't reference upstream are evaluated. Regenerate with\n" +
+		"# UPDATE_GOLDEN=1 after fixing or accepting a violation.\n")
+	for _, e := range list {
+		fmt.Fprintf(&b, "- resource: %v\n  level: %v\n  controls:\n", e.Resource, e.Level)
+		for _, id := range e.Controls {
+			fmt.Fprintf(&b, "  - %v\n", id)
+		}
+	}
+	return ioutil.WriteFile(path, []byte(b.String()), os.FileMode(0644))
+}
+
+// mergePodSecurityResults merges the results of a workload that is built by several packages, which
+// achieves the lowest level of its builds
+func mergePodSecurityResults(results []*PodSecurityResult) []*PodSecurityResult {
+	byResource := map[string]*PodSecurityResult{}
+	var merged []*PodSecurityResult
+	for _, r := range results {
+		m, ok := byResource[r.Resource]
+		if !ok {
+			m = &PodSecurityResult{Resource: r.Resource, Level: PodSecurityRestricted, Violations: map[string][]string{}}
+			byResource[r.Resource] = m
+			merged = append(merged, m)
+		}
+		for id, fields := range r.Violations {
+			if _, ok := m.Violations[id]; !ok {
+				m.Violations[id] = fields
+				m.Level = lowerLevel(m.Level, findPodSecurityControl(id).level)
+			}
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Resource < merged[j].Resource })
+	return merged
+}
@@ -0,0 +1,244 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestPodSecurityStandards evaluates the pod template of every workload built by the kustomization packages
+// below KustomizeRoots against the baseline and the restricted Pod Security Standards and logs the level each
+// workload achieves. Violations that aren't in PodSecurityBaselineFile fail the test, e.g.
+// go test -run TestPodSecurityStandards -v .
+// Packages that reference upstream aren't evaluated, so the workloads of kubeflow/manifests are left to it and the
+// result doesn't depend on whether it is cloned.
+func TestPodSecurityStandards(t *testing.T) {
+	packages, err := DiscoverKustomizePackages(RepoRoot, KustomizeRoots)
+	if err != nil {
+		t.Fatalf("Could not discover kustomization packages; error: %v", err)
+	}
+
+	var results []*PodSecurityResult
+	for _, rpath := range packages {
+		upstream, err := RequiresUpstream(RepoRoot, rpath)
+		if err != nil {
+			t.Fatalf("Could not read %v; error: %v", rpath, err)
+		}
+		if upstream {
+			t.Logf("Skipping %v; it references %v", rpath, UpstreamDir)
+			continue
+		}
+		resources, err := buildKrusty(filepath.Join(RepoRoot, rpath))
+		if err != nil {
+			t.Errorf("Could not build %v; error: %v", rpath, err)
+			continue
+		}
+		evaluated, err := evaluatePodSecurity(resources)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results = append(results, evaluated...)
+	}
+	results = mergePodSecurityResults(results)
+	for _, r := range results {
+		t.Logf("%v: %v", r.Resource, r.Level)
+	}
+
+	exceptions, err := loadPodSecurityBaseline(PodSecurityBaselineFile)
+	if err != nil {
+		t.Fatalf("Could not load %v; error: %v", PodSecurityBaselineFile, err)
+	}
+	if updateGolden() {
+		if err := writePodSecurityBaseline(PodSecurityBaselineFile, results, exceptions); err != nil {
+			t.Fatalf("Could not write %v; error: %v", PodSecurityBaselineFile, err)
+		}
+		return
+	}
+	for _, m := range comparePodSecurity(results, exceptions) {
+		t.Error(m)
+	}
+}
+
+func TestEvaluatePodSecurity(t *testing.T) {
+	type testCase struct {
+		Name     string
+		Resource *builtResource
+		Level    PodSecurityLevel
+		Expected map[string][]string
+	}
+
+	testCases := []testCase{
+		{
+			Name: "restricted",
+			Resource: newBuiltResource("apps", "v1", "Deployment", "kubeflow", "app", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      securityContext:
+        runAsNonRoot: true
+        seccompProfile:
+          type: RuntimeDefault
+      containers:
+      - name: app
+        securityContext:
+          allowPrivilegeEscalation: false
+          capabilities:
+            drop: [ALL]
+      volumes:
+      - name: config
+        configMap:
+          name: app
+`)),
+			Level:    PodSecurityRestricted,
+			Expected: map[string][]string{},
+		},
+		{
+			Name: "baseline",
+			Resource: newBuiltResource("batch", "v1", "CronJob", "kubeflow", "job", []byte(`apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: job
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: job
+            securityContext:
+              runAsUser: 0
+`)),
+			Level: PodSecurityBaseline,
+			Expected: map[string][]string{
+				"restricted/privilege-escalation": {"spec.jobTemplate.spec.template.spec.containers[0].securityContext.allowPrivilegeEscalation"},
+				"restricted/run-as-non-root":      {"spec.jobTemplate.spec.template.spec.containers[0].securityContext.runAsNonRoot"},
+				"restricted/run-as-user":          {"spec.jobTemplate.spec.template.spec.containers[0].securityContext.runAsUser"},
+				"restricted/seccomp":              {"spec.jobTemplate.spec.template.spec.containers[0].securityContext.seccompProfile"},
+				"restricted/capabilities":         {"spec.jobTemplate.spec.template.spec.containers[0].securityContext.capabilities.drop"},
+			},
+		},
+		{
+			Name: "privileged",
+			Resource: newBuiltResource("", "v1", "Pod", "kubeflow", "pod", []byte(`apiVersion: v1
+kind: Pod
+metadata:
+  name: pod
+  annotations:
+    container.apparmor.security.beta.kubernetes.io/pod: unconfined
+spec:
+  hostNetwork: true
+  securityContext:
+    runAsNonRoot: true
+    seccompProfile:
+      type: RuntimeDefault
+  initContainers:
+  - name: init
+    securityContext:
+      privileged: true
+      allowPrivilegeEscalation: false
+      capabilities:
+        add: [NET_ADMIN]
+        drop: [ALL]
+  containers:
+  - name: pod
+    ports:
+    - containerPort: 80
+      hostPort: 80
+    securityContext:
+      allowPrivilegeEscalation: false
+      capabilities:
+        drop: [ALL]
+  volumes:
+  - name: host
+    hostPath:
+      path: /var/run
+`)),
+			Level: PodSecurityPrivileged,
+			Expected: map[string][]string{
+				"baseline/host-namespaces":   {"spec.hostNetwork"},
+				"baseline/privileged":        {"spec.initContainers[0].securityContext.privileged"},
+				"baseline/capabilities":      {"spec.initContainers[0].securityContext.capabilities.add[0]"},
+				"baseline/host-path-volumes": {"spec.volumes[0].hostPath"},
+				"baseline/host-ports":        {"spec.containers[0].ports[0].hostPort"},
+				"baseline/apparmor":          {`metadata.annotations["container.apparmor.security.beta.kubernetes.io/pod"]`},
+				"restricted/volume-types":    {"spec.volumes[0].hostPath"},
+				"restricted/capabilities":    {"spec.initContainers[0].securityContext.capabilities.add[0]"},
+			},
+		},
+	}
+
+	for _, c := range testCases {
+		results, err := evaluatePodSecurity([]*builtResource{c.Resource})
+		if err != nil {
+			t.Errorf("%v: could not evaluate; error: %v", c.Name, err)
+			continue
+		}
+		if len(results) != 1 {
+			t.Errorf("%v: got %d results; want 1", c.Name, len(results))
+			continue
+		}
+		if results[0].Level != c.Level {
+			t.Errorf("%v: got level %v; want %v", c.Name, results[0].Level, c.Level)
+		}
+		if !reflect.DeepEqual(results[0].Violations, c.Expected) {
+			t.Errorf("%v: got violations %v; want %v", c.Name, results[0].Violations, c.Expected)
+		}
+	}
+}
+
+func TestComparePodSecurity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "podsecurity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, PodSecurityBaselineFile)
+	if err := ioutil.WriteFile(path, []byte(`- resource: apps/v1 Deployment kubeflow/app
+  level: baseline
+  controls:
+  - restricted/run-as-non-root
+  - restricted/seccomp
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exceptions, err := loadPodSecurityBaseline(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := []*PodSecurityResult{
+		{
+			Resource: "apps/v1 Deployment kubeflow/app",
+			Level:    PodSecurityPrivileged,
+			Violations: map[string][]string{
+				"baseline/host-namespaces":   {"spec.template.spec.hostPID"},
+				"restricted/run-as-non-root": {"spec.template.spec.containers[0].securityContext.runAsNonRoot"},
+			},
+		},
+		{Resource: "batch/v1 Job kubeflow/job", Level: PodSecurityRestricted, Violations: map[string][]string{}},
+	}
+	expected := []string{
+		"apps/v1 Deployment kubeflow/app no longer violates restricted/seccomp; remove it from " + PodSecurityBaselineFile,
+		"apps/v1 Deployment kubeflow/app violates baseline/host-namespaces at spec.template.spec.hostPID, so its level is privileged; fix it or add it to " + PodSecurityBaselineFile,
+	}
+	if actual := comparePodSecurity(results, exceptions); strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got\n%v\nwant\n%v", strings.Join(actual, "\n"), strings.Join(expected, "\n"))
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`- resource: apps/v1 Deployment kubeflow/app
+  level: restricted
+  controls:
+  - baseline/privileged
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadPodSecurityBaseline(path); err == nil {
+		t.Errorf("got no error for an entry whose level doesn't match its controls")
+	}
+}
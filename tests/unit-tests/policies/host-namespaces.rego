@@ -0,0 +1,13 @@
+# Pods must not share the PID, IPC or network namespace of the host.
+# Based on k8spsphostnamespace and k8spsphostnetworkingports of the Gatekeeper library,
+# https://github.com/open-policy-agent/gatekeeper-library
+package k8spsphostnamespace
+
+host_namespace_fields := ["hostPID", "hostIPC", "hostNetwork"]
+
+violation[{"msg": msg, "details": {"path": path}}] {
+    field := host_namespace_fields[_]
+    input.review.object.spec[field]
+    msg := sprintf("Sharing the host namespace is not allowed: %v sets %v", [input.review.object.metadata.name, field])
+    path := sprintf("spec.%v", [field])
+}
@@ -0,0 +1,12 @@
+package k8spsphostnamespace
+
+test_host_pid {
+    v := violation with input as {"review": {"object": {"metadata": {"name": "a"}, "spec": {"hostPID": true}}}}
+    count(v) == 1
+    v[_].details.path == "spec.hostPID"
+}
+
+test_no_host_namespace {
+    v := violation with input as {"review": {"object": {"metadata": {"name": "a"}, "spec": {"hostNetwork": false}}}}
+    count(v) == 0
+}
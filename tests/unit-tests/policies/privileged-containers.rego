@@ -0,0 +1,13 @@
+# Containers must not run privileged.
+# Based on k8spspprivilegedcontainer of the Gatekeeper library, https://github.com/open-policy-agent/gatekeeper-library
+package k8spspprivileged
+
+container_fields := ["containers", "initContainers", "ephemeralContainers"]
+
+violation[{"msg": msg, "details": {"path": path}}] {
+    field := container_fields[_]
+    c := input.review.object.spec[field][i]
+    c.securityContext.privileged
+    msg := sprintf("Privileged container is not allowed: %v, securityContext: %v", [c.name, c.securityContext])
+    path := sprintf("spec.%v[%v].securityContext.privileged", [field, i])
+}
@@ -0,0 +1,24 @@
+package k8spspprivileged
+
+test_privileged_container {
+    v := violation with input as {"review": {"object": {"spec": {"containers": [
+        {"name": "a"},
+        {"name": "b", "securityContext": {"privileged": true}},
+    ]}}}}
+    count(v) == 1
+    v[_].details.path == "spec.containers[1].securityContext.privileged"
+}
+
+test_privileged_init_container {
+    v := violation with input as {"review": {"object": {"spec": {"initContainers": [
+        {"name": "a", "securityContext": {"privileged": true}},
+    ]}}}}
+    count(v) == 1
+}
+
+test_unprivileged_container {
+    v := violation with input as {"review": {"object": {"spec": {"containers": [
+        {"name": "a", "securityContext": {"privileged": false}},
+    ]}}}}
+    count(v) == 0
+}
@@ -0,0 +1,315 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/rego"
+	"github.com/open-policy-agent/opa/storage/inmem"
+)
+
+const (
+	// PolicyDir is the directory of the Rego policies resources are checked against
+	PolicyDir = "policies"
+	// policyRule is the rule of a policy that returns its violations, like in a Gatekeeper ConstraintTemplate
+	policyRule = "violation"
+)
+
+// podTemplatePaths are the paths of the pod template of the workloads that create pods. The policies are also
+// evaluated against the pods a workload creates, since the pods are what Gatekeeper reviews in the cluster.
+var podTemplatePaths = map[string][]string{
+	"Deployment":  {"spec", "template"},
+	"StatefulSet": {"spec", "template"},
+	"DaemonSet":   {"spec", "template"},
+	"ReplicaSet":  {"spec", "template"},
+	"Job":         {"spec", "template"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template"},
+}
+
+// policy is a package of a .rego file in PolicyDir with a violation rule
+type policy struct {
+	// file is the path of the .rego file
+	file string
+	// pkg is the package of the policy, e.g. k8spspprivileged
+	pkg string
+}
+
+// PolicyViolation is a violation of a policy by a resource
+type PolicyViolation struct {
+	// Policy is the .rego file and the package of the policy
+	Policy string
+	// Resource is the key of the resource, see key
+	Resource string
+	// Path is the path of the field of the resource the violation refers to, if known
+	Path    string
+	Message string
+}
+
+func (v *PolicyViolation) String() string {
+	resource := v.Resource
+	if v.Path != "" {
+		resource += " at " + v.Path
+	}
+	return fmt.Sprintf("resource %v violates %v: %v", resource, v.Policy, v.Message)
+}
+
+// policyEngine evaluates the policies in a directory
+type policyEngine struct {
+	compiler *ast.Compiler
+	policies []*policy
+}
+
+// loadPolicies compiles the .rego files in dir. The tests of the policies, in files ending in _test.rego,
+// are run by TestPolicies instead.
+func loadPolicies(dir string) (*policyEngine, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.rego"))
+	if err != nil {
+		return nil, err
+	}
+	e := &policyEngine{}
+	modules := map[string]*ast.Module{}
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.rego") {
+			continue
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		// Name the file like it is reported, e.g. policies/privileged-containers.rego
+		name := filepath.ToSlash(filepath.Join(filepath.Base(dir), filepath.Base(file)))
+		module, err := ast.ParseModule(name, string(data))
+		if err != nil {
+			return nil, err
+		}
+		modules[name] = module
+		for _, r := range module.Rules {
+			if r.Head.Name.String() == policyRule {
+				e.policies = append(e.policies, &policy{file: name, pkg: strings.TrimPrefix(module.Package.Path.String(), "data.")})
+				break
+			}
+		}
+	}
+
+	e.compiler = ast.NewCompiler()
+	if e.compiler.Compile(modules); e.compiler.Failed() {
+		return nil, e.compiler.Errors
+	}
+	sort.Slice(e.policies, func(i, j int) bool { return e.policies[i].file < e.policies[j].file })
+	return e, nil
+}
+
+// reviewObject is an object reviewed by the policies with the path of the field it was expanded from
+type reviewObject struct {
+	resource *builtResource
+	object   map[string]interface{}
+	path     string
+}
+
+// evaluate evaluates every policy against every resource and the pods of its pod template. The input of a
+// policy is the review of Gatekeeper
+//
+//	input.review.object is the resource
+//	input.review.kind, input.review.name and input.review.namespace identify it
+//	input.parameters is empty, so policies need defaults for the parameters of their constraints
+//
+// and data.inventory holds all resources like the inventory Gatekeeper syncs, e.g.
+// data.inventory.namespace["kubeflow"]["apps/v1"]["Deployment"]["ml-pipeline"].
+func (e *policyEngine) evaluate(resources []*builtResource) ([]*PolicyViolation, error) {
+	if len(e.policies) == 0 {
+		return nil, nil
+	}
+
+	var objects []*reviewObject
+	namespaced := map[string]interface{}{}
+	cluster := map[string]interface{}{}
+	for _, r := range resources {
+		object := map[string]interface{}{}
+		if err := yaml.Unmarshal(r.yaml, &object); err != nil {
+			return nil, fmt.Errorf("could not parse resource %v; error: %v", r.Key(), err)
+		}
+		objects = append(objects, &reviewObject{resource: r, object: object})
+		if pod := expandPod(r, object); pod != nil {
+			objects = append(objects, pod)
+		}
+
+		if r.namespace == "" {
+			setNested(cluster, object, r.apiVersion, r.kind, r.name)
+		} else {
+			setNested(namespaced, object, r.namespace, r.apiVersion, r.kind, r.name)
+		}
+	}
+	store := inmem.NewFromObject(map[string]interface{}{
+		"inventory": map[string]interface{}{"namespace": namespaced, "cluster": cluster},
+	})
+
+	ctx := context.Background()
+	var violations []*PolicyViolation
+	for _, p := range e.policies {
+		query, err := rego.New(
+			rego.Query(fmt.Sprintf("data.%v.%v", p.pkg, policyRule)),
+			rego.Compiler(e.compiler),
+			rego.Store(store),
+		).PrepareForEval(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("could not prepare %v; error: %v", p.file, err)
+		}
+
+		for _, o := range objects {
+			group, version := splitAPIVersion(o.object["apiVersion"])
+			metadata, _ := o.object["metadata"].(map[string]interface{})
+			input := map[string]interface{}{
+				"review": map[string]interface{}{
+					"kind":      map[string]interface{}{"group": group, "version": version, "kind": o.object["kind"]},
+					"name":      metadata["name"],
+					"namespace": metadata["namespace"],
+					"operation": "CREATE",
+					"object":    o.object,
+				},
+				"parameters": map[string]interface{}{},
+			}
+			rs, err := query.Eval(ctx, rego.EvalInput(input))
+			if err != nil {
+				return nil, fmt.Errorf("could not evaluate %v for resource %v; error: %v", p.file, o.resource.Key(), err)
+			}
+			for _, result := range rs {
+				for _, expression := range result.Expressions {
+					found, ok := expression.Value.([]interface{})
+					if !ok {
+						return nil, fmt.Errorf("%v: %v of package %v should be a set of objects with a msg", p.file, policyRule, p.pkg)
+					}
+					for _, f := range found {
+						violations = append(violations, newPolicyViolation(p, o, f))
+					}
+				}
+			}
+		}
+	}
+	return violations, nil
+}
+
+// newPolicyViolation returns the violation of a policy by an object. A string "path" in the details of the
+// violation names the field, relative to the object, that violates the policy.
+func newPolicyViolation(p *policy, o *reviewObject, found interface{}) *PolicyViolation {
+	v := &PolicyViolation{
+		Policy:   fmt.Sprintf("%v (%v)", p.file, p.pkg),
+		Resource: o.resource.Key(),
+		Path:     o.path,
+		Message:  fmt.Sprint(found),
+	}
+	f, ok := found.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	if msg, ok := f["msg"]; ok {
+		v.Message = fmt.Sprint(msg)
+	}
+	if details, ok := f["details"].(map[string]interface{}); ok {
+		if path, ok := details["path"].(string); ok && path != "" {
+			if v.Path != "" {
+				path = v.Path + "." + path
+			}
+			v.Path = path
+		}
+	}
+	return v
+}
+
+// expandPod returns the pod a workload creates from its pod template, or nil if the resource isn't a workload
+func expandPod(r *builtResource, object map[string]interface{}) *reviewObject {
+	path, ok := podTemplatePaths[r.kind]
+	if !ok {
+		return nil
+	}
+	template, ok := nested(object, path...).(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	metadata := map[string]interface{}{}
+	if m, ok := template["metadata"].(map[string]interface{}); ok {
+		for k, v := range m {
+			metadata[k] = v
+		}
+	}
+	if _, ok := metadata["name"]; !ok {
+		metadata["name"] = r.name
+	}
+	if r.namespace != "" {
+		metadata["namespace"] = r.namespace
+	}
+	pod := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   metadata,
+		"spec":       template["spec"],
+	}
+	return &reviewObject{resource: r, object: pod, path: strings.Join(path, ".")}
+}
+
+// nested returns the value at path in object or nil
+func nested(object map[string]interface{}, path ...string) interface{} {
+	var value interface{} = object
+	for _, p := range path {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = m[p]
+	}
+	return value
+}
+
+// setNested sets value at path in object, creating the maps on the way
+func setNested(object map[string]interface{}, value interface{}, path ...string) {
+	for _, p := range path[:len(path)-1] {
+		m, ok := object[p].(map[string]interface{})
+		if !ok {
+			m = map[string]interface{}{}
+			object[p] = m
+		}
+		object = m
+	}
+	object[path[len(path)-1]] = value
+}
+
+// splitAPIVersion returns the group and the version of an apiVersion
+func splitAPIVersion(apiVersion interface{}) (string, string) {
+	s := fmt.Sprint(apiVersion)
+	if i := strings.LastIndex(s, "/"); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return "", s
+}
+
+var (
+	defaultPoliciesOnce sync.Once
+	defaultPolicies     *policyEngine
+	defaultPoliciesErr  error
+)
+
+// checkPolicies fails the test for every violation of a policy in PolicyDir by the resources
+func checkPolicies(t *testing.T, resources []*builtResource) {
+	t.Helper()
+	defaultPoliciesOnce.Do(func() {
+		defaultPolicies, defaultPoliciesErr = loadPolicies(filepath.Join(unitTestsDir(), PolicyDir))
+	})
+	if defaultPoliciesErr != nil {
+		t.Fatalf("Could not load the policies in %v; error: %v", PolicyDir, defaultPoliciesErr)
+	}
+
+	violations, err := defaultPolicies.evaluate(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range violations {
+		t.Errorf("Policy violation: %v", v)
+	}
+}
@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/open-policy-agent/opa/tester"
+)
+
+// TestPolicies runs the Rego tests of the policies in PolicyDir, e.g. test_privileged_container
+func TestPolicies(t *testing.T) {
+	results, err := tester.Run(context.Background(), PolicyDir)
+	if err != nil {
+		t.Fatalf("Could not run the tests of %v; error: %v", PolicyDir, err)
+	}
+	if len(results) == 0 {
+		t.Errorf("%v has no tests", PolicyDir)
+	}
+	for _, r := range results {
+		if r.Error != nil {
+			t.Errorf("%v: %v.%v: %v", r.Location, r.Package, r.Name, r.Error)
+		} else if r.Fail {
+			t.Errorf("%v: %v.%v failed", r.Location, r.Package, r.Name)
+		}
+	}
+}
+
+func TestPolicyEngine(t *testing.T) {
+	root, err := ioutil.TempDir("", "policies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, PolicyDir)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	policies := map[string]string{
+		"latest.rego": `package latest
+
+violation[{"msg": msg, "details": {"path": path}}] {
+    c := input.review.object.spec.containers[i]
+    endswith(c.image, ":latest")
+    msg := sprintf("container %v uses the latest tag", [c.name])
+    path := sprintf("spec.containers[%v].image", [i])
+}
+`,
+		"service.rego": `package service
+
+violation[{"msg": msg}] {
+    input.review.kind.kind == "Deployment"
+    not data.inventory.namespace[input.review.namespace]["v1"]["Service"][input.review.name]
+    msg := "deployment has no service of the same name"
+}
+`,
+		"service_test.rego": `package service
+
+test_nothing {
+    true
+}
+`,
+	}
+	for name, content := range policies {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	engine, err := loadPolicies(dir)
+	if err != nil {
+		t.Fatalf("Could not load policies; error: %v", err)
+	}
+
+	resources := []*builtResource{
+		newBuiltResource("apps", "v1", "Deployment", "kubeflow", "app", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: kubeflow
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:v1
+      - name: sidecar
+        image: sidecar:latest
+`)),
+		newBuiltResource("apps", "v1", "Deployment", "kubeflow", "web", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: kubeflow
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: web:v1
+`)),
+		newBuiltResource("", "v1", "Service", "kubeflow", "web", []byte(`apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: kubeflow
+`)),
+	}
+	violations, err := engine.evaluate(resources)
+	if err != nil {
+		t.Fatalf("Could not evaluate policies; error: %v", err)
+	}
+
+	expected := []string{
+		"resource apps/v1 Deployment kubeflow/app at spec.template.spec.containers[1].image violates policies/latest.rego (latest): container sidecar uses the latest tag",
+		"resource apps/v1 Deployment kubeflow/app violates policies/service.rego (service): deployment has no service of the same name",
+	}
+	var actual []string
+	for _, v := range violations {
+		actual = append(actual, v.String())
+	}
+	if len(actual) != len(expected) {
+		t.Fatalf("got violations\n%v\nwant\n%v", actual, expected)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("got violation\n%v\nwant\n%v", actual[i], expected[i])
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// RBACReportFile is the golden report of the permissions every package and chart grants to its ServiceAccounts
+const RBACReportFile = "rbac_report.txt"
+
+// rbacRule is a rule of a Role or ClusterRole
+type rbacRule struct {
+	APIGroups       []string `json:"apiGroups,omitempty"`
+	Resources       []string `json:"resources,omitempty"`
+	ResourceNames   []string `json:"resourceNames,omitempty"`
+	NonResourceURLs []string `json:"nonResourceURLs,omitempty"`
+	Verbs           []string `json:"verbs"`
+}
+
+// rbacObject holds the fields of Roles, ClusterRoles, RoleBindings and ClusterRoleBindings
+type rbacObject struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name      string            `json:"name"`
+		Namespace string            `json:"namespace,omitempty"`
+		Labels    map[string]string `json:"labels,omitempty"`
+	} `json:"metadata"`
+	Rules           []rbacRule `json:"rules,omitempty"`
+	AggregationRule *struct {
+		ClusterRoleSelectors []struct {
+			MatchLabels map[string]string `json:"matchLabels,omitempty"`
+		} `json:"clusterRoleSelectors,omitempty"`
+	} `json:"aggregationRule,omitempty"`
+	RoleRef struct {
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+	} `json:"roleRef"`
+	Subjects []struct {
+		Kind      string `json:"kind"`
+		Name      string `json:"name"`
+		Namespace string `json:"namespace,omitempty"`
+	} `json:"subjects,omitempty"`
+}
+
+// builtinClusterRoles are the ClusterRoles of Kubernetes whose rules are known without rendering them
+var builtinClusterRoles = map[string][]rbacRule{
+	"cluster-admin": {
+		{APIGroups: []string{"*"}, Resources: []string{"*"}, Verbs: []string{"*"}},
+		{NonResourceURLs: []string{"*"}, Verbs: []string{"*"}},
+	},
+}
+
+// secretsReadVerbs are the verbs that read the content of secrets
+var secretsReadVerbs = []string{"*", "get", "list", "watch"}
+
+// analyzeRBAC returns the effective permissions of every ServiceAccount that the bindings in the resources grant
+// a Role or ClusterRole to, keyed by namespace/name. Each permission is a line of the form
+//
+//	<scope>: <verbs> <resource>.<group>[/<subresource>] [names=<names>] (<role kind> <role name>) [<findings>]
+//
+// where the scope is cluster or the namespace of a RoleBinding. The findings are
+//
+//	wildcard              a * in the verbs, resources or API groups
+//	escalate, bind        verbs that grant more permissions than the role has
+//	impersonate           acting as another user, group or ServiceAccount
+//	cluster-secrets-read  reading the secrets of every namespace
+//
+// ClusterRoles with an aggregationRule get the rules of the ClusterRoles in the resources that match their selectors.
+// Roles that are neither in the resources nor in builtinClusterRoles are reported as unresolved.
+func analyzeRBAC(resources []*builtResource) (map[string][]string, error) {
+	roles := map[string]*rbacObject{}
+	var clusterRoles []*rbacObject
+	var bindings []*rbacObject
+	for _, r := range resources {
+		if r.group != "rbac.authorization.k8s.io" {
+			continue
+		}
+		o := &rbacObject{}
+		if err := yaml.Unmarshal(r.yaml, o); err != nil {
+			return nil, fmt.Errorf("could not parse resource %v; error: %v", r.Key(), err)
+		}
+		switch r.kind {
+		case "Role":
+			roles["Role "+o.Metadata.Namespace+"/"+o.Metadata.Name] = o
+		case "ClusterRole":
+			roles["ClusterRole "+o.Metadata.Name] = o
+			clusterRoles = append(clusterRoles, o)
+		case "RoleBinding", "ClusterRoleBinding":
+			bindings = append(bindings, o)
+		}
+	}
+
+	rulesOf := func(kind string, namespace string, name string) ([]rbacRule, bool) {
+		key := "ClusterRole " + name
+		if kind == "Role" {
+			key = "Role " + namespace + "/" + name
+		}
+		role, ok := roles[key]
+		if !ok {
+			rules, builtin := builtinClusterRoles[name]
+			return rules, kind == "ClusterRole" && builtin
+		}
+		rules := append([]rbacRule{}, role.Rules...)
+		if role.AggregationRule != nil {
+			for _, s := range role.AggregationRule.ClusterRoleSelectors {
+				for _, c := range clusterRoles {
+					if c != role && len(s.MatchLabels) > 0 && matchLabels(s.MatchLabels, c.Metadata.Labels) {
+						rules = append(rules, c.Rules...)
+					}
+				}
+			}
+		}
+		return rules, true
+	}
+
+	permissions := map[string]map[string]bool{}
+	for _, b := range bindings {
+		scope := "cluster"
+		if b.Kind == "RoleBinding" {
+			scope = "namespace " + b.Metadata.Namespace
+		}
+		role := b.RoleRef.Kind + " " + b.RoleRef.Name
+		rules, ok := rulesOf(b.RoleRef.Kind, b.Metadata.Namespace, b.RoleRef.Name)
+		for _, s := range b.Subjects {
+			if s.Kind != "ServiceAccount" {
+				continue
+			}
+			namespace := s.Namespace
+			if namespace == "" && b.Kind == "RoleBinding" {
+				namespace = b.Metadata.Namespace
+			}
+			account := namespace + "/" + s.Name
+			if permissions[account] == nil {
+				permissions[account] = map[string]bool{}
+			}
+			if !ok {
+				permissions[account][fmt.Sprintf("%v: unresolved (%v)", scope, role)] = true
+				continue
+			}
+			for _, rule := range rules {
+				for _, p := range rulePermissions(scope, role, rule) {
+					permissions[account][p] = true
+				}
+			}
+		}
+	}
+
+	report := map[string][]string{}
+	for account, lines := range permissions {
+		for l := range lines {
+			report[account] = append(report[account], l)
+		}
+		sort.Strings(report[account])
+	}
+	return report, nil
+}
+
+// rulePermissions returns a permission line, see analyzeRBAC, for every resource and non-resource URL of the rule
+func rulePermissions(scope string, role string, rule rbacRule) []string {
+	verbs := append([]string{}, rule.Verbs...)
+	sort.Strings(verbs)
+
+	var lines []string
+	for _, group := range rule.APIGroups {
+		for _, resource := range rule.Resources {
+			// Like kubectl, the group goes before the subresource, e.g. ingresses.networking.k8s.io/status
+			name, subresource := resource, ""
+			if i := strings.Index(resource, "/"); i >= 0 {
+				name, subresource = resource[:i], resource[i:]
+			}
+			if group != "" {
+				name += "." + group
+			}
+			name += subresource
+			if len(rule.ResourceNames) > 0 {
+				name += " names=" + strings.Join(rule.ResourceNames, ",")
+			}
+
+			var findings []string
+			if contains(verbs, "*") || resource == "*" || group == "*" {
+				findings = append(findings, "wildcard")
+			}
+			for _, v := range []string{"escalate", "bind", "impersonate"} {
+				if contains(verbs, v) {
+					findings = append(findings, v)
+				}
+			}
+			if scope == "cluster" && (group == "" || group == "*") && (resource == "secrets" || resource == "*") &&
+				len(rule.ResourceNames) == 0 && containsAny(verbs, secretsReadVerbs) {
+				findings = append(findings, "cluster-secrets-read")
+			}
+			lines = append(lines, permissionLine(scope, verbs, name, role, findings))
+		}
+	}
+	for _, url := range rule.NonResourceURLs {
+		var findings []string
+		if contains(verbs, "*") || url == "*" {
+			findings = append(findings, "wildcard")
+		}
+		lines = append(lines, permissionLine(scope, verbs, url, role, findings))
+	}
+	return lines
+}
+
+func permissionLine(scope string, verbs []string, resource string, role string, findings []string) string {
+	line := fmt.Sprintf("%v: %v %v (%v)", scope, strings.Join(verbs, ","), resource, role)
+	if len(findings) > 0 {
+		line += " [" + strings.Join(findings, ", ") + "]"
+	}
+	return line
+}
+
+func matchLabels(selector map[string]string, labels map[string]string) bool {
+	for k, v := range selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(list []string, values []string) bool {
+	for _, v := range values {
+		if contains(list, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// RBACReport maps a kustomization package or chart to the permissions of its ServiceAccounts, see analyzeRBAC
+type RBACReport map[string]map[string][]string
+
+// Marshal returns the report with the header of RBACReportFile. Each package or chart that binds a ServiceAccount is
+// followed by its ServiceAccounts, indented by two spaces, each of which is followed by its permissions, indented by four.
+func (r RBACReport) Marshal() []byte {
+	var b bytes.Buffer
+	b.WriteString("# The permissions every package and chart grants to its ServiceAccounts, checked by TestRBACPermissions.\n" +
+		"# Regenerate with UPDATE_GOLDEN=1 and review the findings in brackets of the lines that change.\n")
+	for _, source := range sortedKeys(r) {
+		if len(r[source]) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%v\n", source)
+		accounts := make([]string, 0, len(r[source]))
+		for a := range r[source] {
+			accounts = append(accounts, a)
+		}
+		sort.Strings(accounts)
+		for _, a := range accounts {
+			fmt.Fprintf(&b, "  ServiceAccount %v\n", a)
+			for _, p := range r[source][a] {
+				fmt.Fprintf(&b, "    %v\n", p)
+			}
+		}
+	}
+	return b.Bytes()
+}
+
+func sortedKeys(r RBACReport) []string {
+	keys := make([]string, 0, len(r))
+	for k := range r {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readRBACReport parses a report written by Marshal
+func readRBACReport(path string) (RBACReport, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	report := RBACReport{}
+	var source, account string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "    ") && account != "":
+			report[source][account] = append(report[source][account], strings.TrimSpace(line))
+		case strings.HasPrefix(line, "  ServiceAccount ") && source != "":
+			account = strings.TrimPrefix(line, "  ServiceAccount ")
+			report[source][account] = []string{}
+		case !strings.HasPrefix(line, " "):
+			source, account = line, ""
+			report[source] = map[string][]string{}
+		default:
+			return nil, fmt.Errorf("%v:%d: unexpected line %q", path, n, line)
+		}
+	}
+	return report, scanner.Err()
+}
+
+// diffRBACReport returns the permissions added to and removed from the expected report by the sources in actual,
+// sorted
+func diffRBACReport(actual RBACReport, expected RBACReport) []string {
+	lines := func(r map[string][]string) map[string]bool {
+		set := map[string]bool{}
+		for account, permissions := range r {
+			for _, p := range permissions {
+				set[account+" "+p] = true
+			}
+		}
+		return set
+	}
+
+	var changes []string
+	for source, accounts := range actual {
+		actualLines, expectedLines := lines(accounts), lines(expected[source])
+		for l := range actualLines {
+			if !expectedLines[l] {
+				changes = append(changes, fmt.Sprintf("added: %v: %v", source, l))
+			}
+		}
+		for l := range expectedLines {
+			if !actualLines[l] {
+				changes = append(changes, fmt.Sprintf("removed: %v: %v", source, l))
+			}
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// writeRBACReport writes the report to path, keeping the sources of the existing report that weren't analyzed
+// unless they are stale, e.g. because the package was deleted
+func writeRBACReport(path string, report RBACReport, existing RBACReport, stale func(source string) bool) error {
+	merged := RBACReport{}
+	for source, accounts := range existing {
+		if !stale(source) {
+			merged[source] = accounts
+		}
+	}
+	for source, accounts := range report {
+		merged[source] = accounts
+	}
+	return ioutil.WriteFile(path, merged.Marshal(), os.FileMode(0644))
+}
@@ -0,0 +1,267 @@
+package tests
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestRBACPermissions renders every chart below ChartRoots and builds every kustomization package below
+// KustomizeRoots that no other package includes, and compares the permissions each of them grants to its
+// ServiceAccounts to RBACReportFile, see analyzeRBAC. Update the report with -update or UPDATE_GOLDEN=1.
+func TestRBACPermissions(t *testing.T) {
+	packages, err := DiscoverKustomizePackages(RepoRoot, KustomizeRoots)
+	if err != nil {
+		t.Fatalf("Could not discover kustomization packages; error: %v", err)
+	}
+	if packages, err = RootPackages(RepoRoot, packages); err != nil {
+		t.Fatalf("Could not read kustomization packages; error: %v", err)
+	}
+	charts, err := DiscoverCharts(RepoRoot, ChartRoots)
+	if err != nil {
+		t.Fatalf("Could not discover charts; error: %v", err)
+	}
+
+	report := RBACReport{}
+	skipped := map[string]bool{}
+	analyze := func(source string, resources []*builtResource) {
+		permissions, err := analyzeRBAC(resources)
+		if err != nil {
+			t.Fatal(err)
+		}
+		report[source] = permissions
+	}
+	for _, rpath := range packages {
+		upstream, err := RequiresUpstream(RepoRoot, rpath)
+		if err != nil {
+			t.Fatalf("Could not read %v; error: %v", rpath, err)
+		}
+		if upstream && !dirExists(filepath.Join(RepoRoot, UpstreamDir)) {
+			t.Logf("Skipping %v; it requires kubeflow/manifests to be cloned into %v", rpath, UpstreamDir)
+			skipped[rpath] = true
+			continue
+		}
+		resources, err := buildKrusty(filepath.Join(RepoRoot, rpath))
+		if err != nil {
+			t.Errorf("Could not build %v; error: %v", rpath, err)
+			skipped[rpath] = true
+			continue
+		}
+		analyze(rpath, resources)
+	}
+	for _, rpath := range charts {
+		values := filepath.Join(rpath, ValuesFixtureFile)
+		if !fileExists(values) {
+			values = ""
+		}
+		resources, err := renderChart(filepath.Join(RepoRoot, rpath), values, false)
+		if err != nil {
+			t.Errorf("Could not render %v; error: %v", rpath, err)
+			skipped[rpath] = true
+			continue
+		}
+		analyze(rpath, resources)
+	}
+
+	expected, err := readRBACReport(RBACReportFile)
+	if err != nil && !(os.IsNotExist(err) && updateGolden()) {
+		t.Fatalf("Could not read %v; error: %v", RBACReportFile, err)
+	}
+	stale := func(source string) bool {
+		_, analyzed := report[source]
+		return !analyzed && !skipped[source]
+	}
+	if updateGolden() {
+		if err := writeRBACReport(RBACReportFile, report, expected, stale); err != nil {
+			t.Fatalf("Could not write %v; error: %v", RBACReportFile, err)
+		}
+		return
+	}
+	for source := range expected {
+		if stale(source) {
+			t.Errorf("%v is in %v but is no longer a package or chart; run the test with -update or UPDATE_GOLDEN=1", source, RBACReportFile)
+		}
+	}
+	if changes := diffRBACReport(report, expected); len(changes) > 0 {
+		t.Errorf("Permissions differ from %v; review them and run the test with -update or UPDATE_GOLDEN=1:\n  %v",
+			RBACReportFile, strings.Join(changes, "\n  "))
+	}
+}
+
+func TestAnalyzeRBAC(t *testing.T) {
+	resources := []*builtResource{
+		newBuiltResource("rbac.authorization.k8s.io", "v1", "ClusterRole", "", "controller", []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: controller
+rules:
+- apiGroups: [""]
+  resources: [secrets]
+  verbs: [get, list]
+- apiGroups: [rbac.authorization.k8s.io]
+  resources: [clusterroles]
+  verbs: [bind, escalate]
+- nonResourceURLs: [/metrics]
+  verbs: [get]
+`)),
+		newBuiltResource("rbac.authorization.k8s.io", "v1", "ClusterRole", "", "aggregated", []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: aggregated
+aggregationRule:
+  clusterRoleSelectors:
+  - matchLabels:
+      aggregate-to-aggregated: "true"
+`)),
+		newBuiltResource("rbac.authorization.k8s.io", "v1", "ClusterRole", "", "part", []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: part
+  labels:
+    aggregate-to-aggregated: "true"
+rules:
+- apiGroups: [apps]
+  resources: [deployments]
+  verbs: [create]
+`)),
+		newBuiltResource("rbac.authorization.k8s.io", "v1", "Role", "kubeflow", "user", []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: user
+  namespace: kubeflow
+rules:
+- apiGroups: [""]
+  resources: [secrets]
+  resourceNames: [user-secret]
+  verbs: [get]
+- apiGroups: ["*"]
+  resources: [serviceaccounts]
+  verbs: [impersonate]
+`)),
+		newBuiltResource("rbac.authorization.k8s.io", "v1", "ClusterRoleBinding", "", "controller", []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: controller
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: controller
+subjects:
+- kind: ServiceAccount
+  name: controller
+  namespace: kube-system
+- kind: User
+  name: admin
+`)),
+		newBuiltResource("rbac.authorization.k8s.io", "v1", "RoleBinding", "kubeflow", "user", []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: user
+  namespace: kubeflow
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: user
+subjects:
+- kind: ServiceAccount
+  name: user
+`)),
+		newBuiltResource("rbac.authorization.k8s.io", "v1", "RoleBinding", "kubeflow", "aggregated", []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: aggregated
+  namespace: kubeflow
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: aggregated
+subjects:
+- kind: ServiceAccount
+  name: user
+  namespace: kubeflow
+`)),
+		newBuiltResource("rbac.authorization.k8s.io", "v1", "ClusterRoleBinding", "", "admin", []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: admin
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: cluster-admin
+subjects:
+- kind: ServiceAccount
+  name: admin
+  namespace: kubeflow
+`)),
+		newBuiltResource("rbac.authorization.k8s.io", "v1", "ClusterRoleBinding", "", "view", []byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: view
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: view
+subjects:
+- kind: ServiceAccount
+  name: admin
+  namespace: kubeflow
+`)),
+	}
+
+	expected := map[string][]string{
+		"kube-system/controller": {
+			"cluster: bind,escalate clusterroles.rbac.authorization.k8s.io (ClusterRole controller) [escalate, bind]",
+			"cluster: get /metrics (ClusterRole controller)",
+			"cluster: get,list secrets (ClusterRole controller) [cluster-secrets-read]",
+		},
+		"kubeflow/user": {
+			"namespace kubeflow: create deployments.apps (ClusterRole aggregated)",
+			"namespace kubeflow: get secrets names=user-secret (Role user)",
+			"namespace kubeflow: impersonate serviceaccounts.* (Role user) [wildcard, impersonate]",
+		},
+		"kubeflow/admin": {
+			"cluster: * * (ClusterRole cluster-admin) [wildcard]",
+			"cluster: * *.* (ClusterRole cluster-admin) [wildcard, cluster-secrets-read]",
+			"cluster: unresolved (ClusterRole view)",
+		},
+	}
+	actual, err := analyzeRBAC(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got permissions\n%v\nwant\n%v", actual, expected)
+	}
+
+	dir, err := ioutil.TempDir("", "rbac")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, RBACReportFile)
+	if err := writeRBACReport(path, RBACReport{"charts/app": actual}, RBACReport{}, func(string) bool { return false }); err != nil {
+		t.Fatal(err)
+	}
+	report, err := readRBACReport(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report, RBACReport{"charts/app": expected}) {
+		t.Errorf("got report %v after writing and reading it; want %v", report, RBACReport{"charts/app": expected})
+	}
+
+	delete(actual, "kube-system/controller")
+	actual["kubeflow/user"] = actual["kubeflow/user"][1:]
+	expectedChanges := []string{
+		"removed: charts/app: kube-system/controller cluster: bind,escalate clusterroles.rbac.authorization.k8s.io (ClusterRole controller) [escalate, bind]",
+		"removed: charts/app: kube-system/controller cluster: get /metrics (ClusterRole controller)",
+		"removed: charts/app: kube-system/controller cluster: get,list secrets (ClusterRole controller) [cluster-secrets-read]",
+		"removed: charts/app: kubeflow/user namespace kubeflow: create deployments.apps (ClusterRole aggregated)",
+	}
+	if changes := diffRBACReport(RBACReport{"charts/app": actual}, report); !reflect.DeepEqual(changes, expectedChanges) {
+		t.Errorf("got changes\n%v\nwant\n%v", strings.Join(changes, "\n"), strings.Join(expectedChanges, "\n"))
+	}
+}
@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io/ioutil"
+)
+
+var (
+	// sarifOutput is the file TestManifestRules writes its results to in SARIF
+	sarifOutput = flag.String("sarif", "", "write the results of the manifest rules to this SARIF file")
+	// junitOutput is the file TestManifestRules writes its results to in JUnit XML
+	junitOutput = flag.String("junit", "", "write the results of the manifest rules to this JUnit XML file")
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	// sarifSourceRoot is the base of the artifact URIs, which are relative to the repository root
+	sarifSourceRoot = "%SRCROOT%"
+)
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// writeSARIF writes the results of the rules to path in SARIF, which code scanning annotates on the lines
+// of the pull request
+func writeSARIF(path string, rules []Rule, results []*Result) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "kubeflow-manifests-rules",
+			InformationURI: "https://github.com/awslabs/kubeflow-manifests/tree/main/tests/unit-tests",
+		}},
+		Results: []sarifResult{},
+	}
+	index := map[string]int{}
+	for i, r := range rules {
+		index[r.ID()] = i
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+			ID:                   r.ID(),
+			ShortDescription:     sarifMessage{Text: r.Description()},
+			DefaultConfiguration: sarifConfiguration{Level: string(r.Severity())},
+		})
+	}
+	for _, r := range results {
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    r.Rule.ID(),
+			RuleIndex: index[r.Rule.ID()],
+			Level:     string(r.Severity),
+			Message:   sarifMessage{Text: r.Message},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: r.Path, URIBaseID: sarifSourceRoot},
+				Region:           sarifRegion{StartLine: r.Line},
+			}}},
+		})
+	}
+
+	data, err := json.MarshalIndent(sarifLog{Version: sarifVersion, Schema: sarifSchema, Runs: []sarifRun{run}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	File      string        `xml:"file,attr,omitempty"`
+	Line      int           `xml:"line,attr,omitempty"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnit writes the results of the rules to path in JUnit XML. Every rule is a test suite with a failed
+// test case per error, which carries the file and line of the error, or a passed test case if it has none.
+// Warnings are only written to SARIF.
+func writeJUnit(path string, rules []Rule, results []*Result) error {
+	suites := junitTestSuites{}
+	for _, r := range rules {
+		suite := junitTestSuite{Name: r.ID()}
+		for _, result := range results {
+			if result.Rule.ID() != r.ID() || result.Severity != SeverityError {
+				continue
+			}
+			suite.Cases = append(suite.Cases, junitTestCase{
+				Name:      fmt.Sprintf("%v:%d", result.Path, result.Line),
+				Classname: r.ID(),
+				File:      result.Path,
+				Line:      result.Line,
+				Failure: &junitFailure{
+					Message: result.Message,
+					Type:    r.ID(),
+					Text:    result.String(),
+				},
+			})
+		}
+		suite.Failures = len(suite.Cases)
+		if len(suite.Cases) == 0 {
+			suite.Cases = append(suite.Cases, junitTestCase{Name: r.ID(), Classname: r.ID()})
+		}
+		suite.Tests = len(suite.Cases)
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	data, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/kubeflow/manifests/tests/manifests"
+)
+
+// Severity is how a violation of a rule is reported
+type Severity string
+
+const (
+	// SeverityError fails the test
+	SeverityError Severity = "error"
+	// SeverityWarning is logged
+	SeverityWarning Severity = "warning"
+)
+
+// Finding is a violation of a rule in a document
+type Finding struct {
+	// Line is the line of the file the finding refers to; 0 is the line of the document
+	Line    int
+	Message string
+	// Severity overrides the severity of the rule if set
+	Severity Severity
+}
+
+// Rule is a convention checked against every document of the repository
+type Rule interface {
+	// ID names the rule in subtests, in the rules of the IgnoreFile and in IgnoreAnnotation, e.g. webhook-audit
+	ID() string
+	Description() string
+	// Severity is the severity of the findings of the rule
+	Severity() Severity
+	// Check returns the violations of the rule in a document
+	Check(doc *manifests.Document) ([]Finding, error)
+}
+
+// funcRule is a Rule implemented by a function
+type funcRule struct {
+	id          string
+	description string
+	severity    Severity
+	check       func(doc *manifests.Document) ([]Finding, error)
+}
+
+// NewRule returns a Rule that checks documents with check
+func NewRule(id string, description string, severity Severity, check func(doc *manifests.Document) ([]Finding, error)) Rule {
+	return &funcRule{id: id, description: description, severity: severity, check: check}
+}
+
+func (r *funcRule) ID() string          { return r.id }
+func (r *funcRule) Description() string { return r.description }
+func (r *funcRule) Severity() Severity  { return r.severity }
+
+func (r *funcRule) Check(doc *manifests.Document) ([]Finding, error) {
+	return r.check(doc)
+}
+
+// rules are the registered rules by id
+var rules = map[string]Rule{}
+
+// RegisterRule adds a rule to the rules run by TestManifestRules. It panics if the id is taken.
+func RegisterRule(r Rule) {
+	if _, ok := rules[r.ID()]; ok {
+		panic(fmt.Sprintf("rule %v is registered twice", r.ID()))
+	}
+	rules[r.ID()] = r
+}
+
+// Rules returns the registered rules sorted by id
+func Rules() []Rule {
+	sorted := make([]Rule, 0, len(rules))
+	for _, r := range rules {
+		sorted = append(sorted, r)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID() < sorted[j].ID() })
+	return sorted
+}
+
+// Result is a finding of a rule at a line of a file
+type Result struct {
+	Rule Rule
+	// Path is the slash separated path of the file relative to the repository root
+	Path     string
+	Line     int
+	Message  string
+	Severity Severity
+}
+
+// String returns the result as <path>:<line>: <message>
+func (r *Result) String() string {
+	return fmt.Sprintf("%v:%d: %v", r.Path, r.Line, r.Message)
+}
+
+// RunRule checks every document of the inventory that isn't ignored for the rule in the IgnoreFile. Findings
+// suppressed by IgnoreAnnotation or a comment are dropped and a document that can't be checked is an error.
+func RunRule(inv *manifests.Inventory, r Rule) []*Result {
+	var results []*Result
+	for _, doc := range inv.Documents {
+		if inv.Ignore.Ignored(doc.Path, false, r.ID()) {
+			continue
+		}
+		findings, err := r.Check(doc)
+		if err != nil {
+			results = append(results, &Result{
+				Rule:     r,
+				Path:     doc.Path,
+				Line:     doc.Line,
+				Message:  fmt.Sprintf("could not check the document; error: %v", err),
+				Severity: SeverityError,
+			})
+			continue
+		}
+		for _, f := range findings {
+			line := f.Line
+			if line == 0 {
+				line = doc.Line
+			}
+			if doc.Suppressed(r.ID(), line) {
+				continue
+			}
+			severity := f.Severity
+			if severity == "" {
+				severity = r.Severity()
+			}
+			results = append(results, &Result{Rule: r, Path: doc.Path, Line: line, Message: f.Message, Severity: severity})
+		}
+	}
+	return results
+}
+
+var (
+	inventoryOnce sync.Once
+	inventory     *manifests.Inventory
+	inventoryErr  error
+)
+
+// loadInventory loads the documents of the repository once
+func loadInventory() (*manifests.Inventory, error) {
+	inventoryOnce.Do(func() {
+		inventory, inventoryErr = manifests.Load(filepath.Join(unitTestsDir(), RepoRoot))
+	})
+	return inventory, inventoryErr
+}
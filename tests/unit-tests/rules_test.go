@@ -0,0 +1,166 @@
+package tests
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kubeflow/manifests/tests/manifests"
+)
+
+// TestManifestRules runs every registered rule in parallel against the documents of the repository that
+// aren't ignored for it in the IgnoreFile, and reports the results of each rule as a subtest, e.g.
+// go test -run TestManifestRules/webhook-audit . The results are also written to -sarif and -junit.
+func TestManifestRules(t *testing.T) {
+	inv, err := loadInventory()
+	if err != nil {
+		t.Fatalf("Could not load the manifests of the repository; error: %v", err)
+	}
+	for _, e := range inv.Errors {
+		t.Errorf("Could not parse %v", e)
+	}
+
+	registered := Rules()
+	results := make([][]*Result, len(registered))
+	var wg sync.WaitGroup
+	for i, r := range registered {
+		wg.Add(1)
+		go func(i int, r Rule) {
+			defer wg.Done()
+			results[i] = RunRule(inv, r)
+		}(i, r)
+	}
+	wg.Wait()
+
+	var all []*Result
+	for i, r := range registered {
+		all = append(all, results[i]...)
+		t.Run(r.ID(), func(t *testing.T) {
+			for _, result := range results[i] {
+				if result.Severity == SeverityError {
+					t.Error(result)
+				} else {
+					t.Logf("Warning: %v", result)
+				}
+			}
+		})
+	}
+
+	if *sarifOutput != "" {
+		if err := writeSARIF(*sarifOutput, registered, all); err != nil {
+			t.Errorf("Could not write %v; error: %v", *sarifOutput, err)
+		}
+	}
+	if *junitOutput != "" {
+		if err := writeJUnit(*junitOutput, registered, all); err != nil {
+			t.Errorf("Could not write %v; error: %v", *junitOutput, err)
+		}
+	}
+}
+
+func TestRunRule(t *testing.T) {
+	root, err := ioutil.TempDir("", "rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	files := map[string]string{
+		manifests.IgnoreFile: "ignored.yaml webhook-audit\n",
+		"webhook.yaml": `apiVersion: admissionregistration.k8s.io/v1
+kind: MutatingWebhookConfiguration
+metadata:
+  name: webhook
+webhooks:
+- name: first
+  rules:
+  - resources: [pods]
+  failurePolicy: Ignore
+  timeoutSeconds: 5
+- name: second
+  rules:
+  # manifests.kubeflow.org/ignore: webhook-audit
+  - resources: ["*"]
+  failurePolicy: Ignore
+  timeoutSeconds: 5
+`,
+		"ignored.yaml": `apiVersion: admissionregistration.k8s.io/v1
+kind: MutatingWebhookConfiguration
+metadata:
+  name: ignored
+webhooks:
+- name: first
+  rules:
+  - resources: [pods]
+`,
+		"annotated.yaml": `apiVersion: admissionregistration.k8s.io/v1
+kind: MutatingWebhookConfiguration
+metadata:
+  name: annotated
+  annotations:
+    manifests.kubeflow.org/ignore: webhook-audit
+webhooks:
+- name: first
+  rules:
+  - resources: [pods]
+`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	inv, err := manifests.Load(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rule := rules["webhook-audit"]
+	results := RunRule(inv, rule)
+	if len(results) != 1 || results[0].Path != "webhook.yaml" || results[0].Line != 8 || results[0].Severity != SeverityError {
+		t.Fatalf("got results %v; want an error at webhook.yaml:8", results)
+	}
+
+	sarifPath := filepath.Join(root, "results.sarif")
+	if err := writeSARIF(sarifPath, []Rule{rule}, results); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(sarifPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := &sarifLog{}
+	if err := json.Unmarshal(data, log); err != nil {
+		t.Fatalf("Could not parse SARIF; error: %v", err)
+	}
+	if len(log.Runs) != 1 || len(log.Runs[0].Results) != 1 {
+		t.Fatalf("got SARIF\n%s\nwant a run with one result", data)
+	}
+	location := log.Runs[0].Results[0].Locations[0].PhysicalLocation
+	if location.ArtifactLocation.URI != "webhook.yaml" || location.Region.StartLine != 8 {
+		t.Errorf("got SARIF location %+v; want webhook.yaml:8", location)
+	}
+
+	junitPath := filepath.Join(root, "results.xml")
+	if err := writeJUnit(junitPath, []Rule{rule}, results); err != nil {
+		t.Fatal(err)
+	}
+	data, err = ioutil.ReadFile(junitPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	suites := &junitTestSuites{}
+	if err := xml.Unmarshal(data, suites); err != nil {
+		t.Fatalf("Could not parse JUnit XML; error: %v", err)
+	}
+	if len(suites.Suites) != 1 || suites.Suites[0].Failures != 1 {
+		t.Fatalf("got JUnit XML\n%s\nwant a suite with one failure", data)
+	}
+	if c := suites.Suites[0].Cases[0]; c.File != "webhook.yaml" || c.Line != 8 || !strings.Contains(c.Failure.Message, "intercepts pods") {
+		t.Errorf("got JUnit test case %+v; want a failure at webhook.yaml:8", c)
+	}
+}
@@ -0,0 +1,575 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// SchemaDir holds the schemas resources are validated against, see update_schemas.py
+	SchemaDir = "test_data/schemas"
+	// EnumsFile lists the allowed values of Kubernetes fields, relative to SchemaDir
+	EnumsFile = "kubernetes/enums.yaml"
+	// PinnedCRDDir holds the CRDs, relative to SchemaDir, of custom resources whose CRD isn't in the repository
+	PinnedCRDDir = "crds"
+
+	objectMetaRef = "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"
+	quantityRef   = "#/definitions/io.k8s.apimachinery.pkg.api.resource.Quantity"
+)
+
+// KubernetesVersions are the Kubernetes versions of the EKS versions we target, see
+// website/content/en/docs/about/eks-compatibility.md. Built-in resources are validated against
+// the schema of every version that serves their API.
+var KubernetesVersions = []string{
+	"1.23",
+	"1.24",
+	"1.25",
+}
+
+// CRDRoots are the directories, relative to the repository root, searched for the CRDs that
+// custom resources are validated against
+var CRDRoots = []string{
+	"awsconfigs",
+	"charts",
+}
+
+// schema is the subset of an OpenAPI schema the validation checks, see SCHEMA_KEYS in update_schemas.py
+type schema struct {
+	Ref                   string             `json:"$ref,omitempty"`
+	Type                  string             `json:"type,omitempty"`
+	Format                string             `json:"format,omitempty"`
+	Properties            map[string]*schema `json:"properties,omitempty"`
+	AdditionalProperties  *schemaOrBool      `json:"additionalProperties,omitempty"`
+	Items                 *schema            `json:"items,omitempty"`
+	Required              []string           `json:"required,omitempty"`
+	Enum                  []interface{}      `json:"enum,omitempty"`
+	AllOf                 []*schema          `json:"allOf,omitempty"`
+	AnyOf                 []*schema          `json:"anyOf,omitempty"`
+	OneOf                 []*schema          `json:"oneOf,omitempty"`
+	Not                   *schema            `json:"not,omitempty"`
+	PreserveUnknownFields bool               `json:"x-kubernetes-preserve-unknown-fields,omitempty"`
+	IntOrString           bool               `json:"x-kubernetes-int-or-string,omitempty"`
+	EmbeddedResource      bool               `json:"x-kubernetes-embedded-resource,omitempty"`
+	GroupVersionKind      []struct {
+		Group   string `json:"group"`
+		Version string `json:"version"`
+		Kind    string `json:"kind"`
+	} `json:"x-kubernetes-group-version-kind,omitempty"`
+}
+
+// schemaOrBool is the value of additionalProperties, either a schema or whether any value is allowed
+type schemaOrBool struct {
+	allowed bool
+	schema  *schema
+}
+
+func (s *schemaOrBool) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &s.allowed); err == nil {
+		return nil
+	}
+	s.allowed = true
+	s.schema = &schema{}
+	return json.Unmarshal(data, s.schema)
+}
+
+// kubernetesSchema holds the definitions of the OpenAPI spec of a Kubernetes version
+type kubernetesSchema struct {
+	version     string
+	definitions map[string]*schema
+	// kinds maps "<apiVersion> <kind>" to the schema of the resource
+	kinds map[string]*schema
+}
+
+// loadKubernetesSchema reads the schema of version written by update_schemas.py and applies the enums to it
+func loadKubernetesSchema(schemaDir string, version string, enums map[string]map[string][]interface{}) (*kubernetesSchema, error) {
+	path := filepath.Join(schemaDir, "kubernetes", "v"+version+".json")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var spec struct {
+		Definitions map[string]*schema `json:"definitions"`
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("could not parse %v; error: %v", path, err)
+	}
+
+	k := &kubernetesSchema{version: version, definitions: spec.Definitions, kinds: map[string]*schema{}}
+	for _, s := range spec.Definitions {
+		for _, gvk := range s.GroupVersionKind {
+			apiVersion := gvk.Version
+			if gvk.Group != "" {
+				apiVersion = gvk.Group + "/" + gvk.Version
+			}
+			k.kinds[apiVersion+" "+gvk.Kind] = s
+		}
+	}
+
+	for name, fields := range enums {
+		d, ok := k.definitions[name]
+		if !ok {
+			return nil, fmt.Errorf("%v: Kubernetes %v has no definition %v", EnumsFile, version, name)
+		}
+		for field, values := range fields {
+			p, ok := d.Properties[field]
+			if !ok {
+				return nil, fmt.Errorf("%v: definition %v of Kubernetes %v has no field %v", EnumsFile, name, version, field)
+			}
+			if p.Type == "array" && p.Items != nil {
+				p = p.Items
+			}
+			p.Enum = values
+		}
+	}
+	return k, nil
+}
+
+// loadEnums reads the enums file in schemaDir
+func loadEnums(schemaDir string) (map[string]map[string][]interface{}, error) {
+	path := filepath.Join(schemaDir, EnumsFile)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	enums := map[string]map[string][]interface{}{}
+	if err := yaml.Unmarshal(data, &enums); err != nil {
+		return nil, fmt.Errorf("could not parse %v; error: %v", path, err)
+	}
+	return enums, nil
+}
+
+// customResourceDefinition is the part of a CRD that describes the schema of its versions
+type customResourceDefinition struct {
+	Spec struct {
+		Group string `json:"group"`
+		Names struct {
+			Kind string `json:"kind"`
+		} `json:"names"`
+		Versions []struct {
+			Name   string `json:"name"`
+			Schema *struct {
+				OpenAPIV3Schema *schema `json:"openAPIV3Schema"`
+			} `json:"schema"`
+		} `json:"versions"`
+		// Validation is the schema of every version of an apiextensions.k8s.io/v1beta1 CRD
+		Validation *struct {
+			OpenAPIV3Schema *schema `json:"openAPIV3Schema"`
+		} `json:"validation"`
+	} `json:"spec"`
+}
+
+// addCRDs adds the schema of every version of the CRDs among resources to crds, which maps
+// "<apiVersion> <kind>" to the schema of the custom resource
+func addCRDs(crds map[string]*schema, resources []*builtResource) error {
+	for _, r := range resources {
+		if r.kind != "CustomResourceDefinition" {
+			continue
+		}
+		crd := &customResourceDefinition{}
+		if err := yaml.Unmarshal(r.yaml, crd); err != nil {
+			return fmt.Errorf("could not parse CRD %v; error: %v", r.name, err)
+		}
+		for _, v := range crd.Spec.Versions {
+			s := &schema{PreserveUnknownFields: true}
+			if v.Schema != nil && v.Schema.OpenAPIV3Schema != nil {
+				s = v.Schema.OpenAPIV3Schema
+			} else if crd.Spec.Validation != nil && crd.Spec.Validation.OpenAPIV3Schema != nil {
+				s = crd.Spec.Validation.OpenAPIV3Schema
+			}
+			crds[crd.Spec.Group+"/"+v.Name+" "+crd.Spec.Names.Kind] = s
+		}
+	}
+	return nil
+}
+
+// loadCRDs reads the CRDs in every YAML file below dirs. Helm templates that aren't valid YAML are skipped.
+func loadCRDs(crds map[string]*schema, dirs []string) error {
+	for _, dir := range dirs {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			ext := filepath.Ext(path)
+			if info.IsDir() || (ext != ".yaml" && ext != ".yml") {
+				return nil
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if !bytes.Contains(data, []byte("kind: CustomResourceDefinition")) {
+				return nil
+			}
+			resources, err := splitManifests(path, string(data))
+			if err != nil {
+				if bytes.Contains(data, []byte("{{")) {
+					return nil
+				}
+				return err
+			}
+			return addCRDs(crds, resources)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SchemaViolation is a field of a resource that doesn't match its schema
+type SchemaViolation struct {
+	// Resource is the key of the resource
+	Resource string
+	// Message names the field and describes the violation
+	Message string
+}
+
+// schemaValidator validates resources against the Kubernetes OpenAPI schemas and the schemas of CRDs
+type schemaValidator struct {
+	kubernetes []*kubernetesSchema
+	crds       map[string]*schema
+}
+
+// newSchemaValidator loads the schemas of the Kubernetes versions from schemaDir and the CRDs pinned
+// in schemaDir or found below the CRDRoots of repoRoot. CRDs in the repository take precedence.
+func newSchemaValidator(schemaDir string, repoRoot string, versions []string) (*schemaValidator, error) {
+	enums, err := loadEnums(schemaDir)
+	if err != nil {
+		return nil, err
+	}
+	v := &schemaValidator{crds: map[string]*schema{}}
+	for _, version := range versions {
+		k, err := loadKubernetesSchema(schemaDir, version, enums)
+		if err != nil {
+			return nil, err
+		}
+		v.kubernetes = append(v.kubernetes, k)
+	}
+
+	dirs := []string{filepath.Join(schemaDir, PinnedCRDDir)}
+	for _, root := range CRDRoots {
+		dirs = append(dirs, filepath.Join(repoRoot, root))
+	}
+	if err := loadCRDs(v.crds, dirs); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// validate validates each resource against the schema of its API. Custom resources are validated
+// against the CRDs among resources, which take precedence over the CRDs loaded by newSchemaValidator.
+// A violation that only occurs in some Kubernetes versions names them.
+func (v *schemaValidator) validate(resources []*builtResource) ([]SchemaViolation, error) {
+	crds := map[string]*schema{}
+	for k, s := range v.crds {
+		crds[k] = s
+	}
+	if err := addCRDs(crds, resources); err != nil {
+		return nil, err
+	}
+
+	var violations []SchemaViolation
+	for _, r := range resources {
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal(r.yaml, &obj); err != nil {
+			return nil, fmt.Errorf("could not parse resource %v; error: %v", r.Key(), err)
+		}
+		crd, isCustom := crds[r.apiVersion+" "+r.kind]
+
+		var served []string
+		messages := map[string][]string{}
+		for _, k := range v.kubernetes {
+			root := crd
+			if !isCustom {
+				if root = k.kinds[r.apiVersion+" "+r.kind]; root == nil {
+					continue
+				}
+			}
+			served = append(served, k.version)
+			for _, m := range validateResource(k.definitions, obj, root, isCustom) {
+				messages[m] = append(messages[m], k.version)
+			}
+		}
+
+		if len(served) == 0 {
+			violations = append(violations, SchemaViolation{r.Key(), fmt.Sprintf(
+				"%v is not served by Kubernetes %v and has no CRD in the repository; pin its CRD in update_schemas.py",
+				r.apiVersion, strings.Join(v.versions(), ", "))})
+			continue
+		}
+		for m, versions := range messages {
+			if len(versions) < len(served) {
+				m = fmt.Sprintf("%v (Kubernetes %v)", m, strings.Join(versions, ", "))
+			}
+			violations = append(violations, SchemaViolation{r.Key(), m})
+		}
+	}
+
+	sort.Slice(violations, func(i, j int) bool {
+		if violations[i].Resource != violations[j].Resource {
+			return violations[i].Resource < violations[j].Resource
+		}
+		return violations[i].Message < violations[j].Message
+	})
+	return violations, nil
+}
+
+// versions returns the Kubernetes versions the validator has schemas of
+func (v *schemaValidator) versions() []string {
+	versions := make([]string, 0, len(v.kubernetes))
+	for _, k := range v.kubernetes {
+		versions = append(versions, k.version)
+	}
+	return versions
+}
+
+// validateResource validates obj against root and returns the violations. The metadata of custom
+// resources is validated against ObjectMeta since CRDs rarely describe it.
+func validateResource(definitions map[string]*schema, obj map[string]interface{}, root *schema, isCustom bool) []string {
+	v := &validation{definitions: definitions, strict: true}
+	if isCustom {
+		custom := *root
+		custom.Properties = map[string]*schema{
+			"apiVersion": {Type: "string"},
+			"kind":       {Type: "string"},
+			"metadata":   {Ref: objectMetaRef},
+		}
+		for k, p := range root.Properties {
+			if k != "metadata" {
+				custom.Properties[k] = p
+			}
+		}
+		if len(root.Properties) == 0 && root.AdditionalProperties == nil {
+			// An object schema without properties allows any field
+			custom.PreserveUnknownFields = true
+		}
+		root = &custom
+	}
+	v.validate("", obj, root)
+	return v.errors
+}
+
+// validation collects the violations of a value against a schema
+type validation struct {
+	definitions map[string]*schema
+	// strict reports fields that aren't in the properties of an object schema. Fields unknown to a
+	// structural CRD schema are pruned by the API server and those of built-in resources are dropped.
+	strict bool
+	errors []string
+}
+
+func (v *validation) errorf(path string, format string, args ...interface{}) {
+	v.errors = append(v.errors, rootPath(path)+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *validation) validate(path string, value interface{}, s *schema) {
+	if s == nil || value == nil {
+		// null is the same as an unset field
+		return
+	}
+	if s.Ref != "" {
+		if s.Ref == quantityRef {
+			if _, ok := value.(float64); !ok {
+				v.checkType(path, value, "string")
+			}
+			return
+		}
+		ref, ok := v.definitions[strings.TrimPrefix(s.Ref, "#/definitions/")]
+		if !ok {
+			v.errorf(path, "schema references unknown definition %v", s.Ref)
+			return
+		}
+		s = ref
+	}
+
+	if s.IntOrString || s.Format == "int-or-string" {
+		if !isInteger(value) {
+			v.checkType(path, value, "string")
+		}
+	} else if !v.checkType(path, value, s.Type) {
+		return
+	}
+
+	if len(s.Enum) > 0 && !containsValue(s.Enum, value) {
+		v.errorf(path, "unsupported value %v; expected one of %v", formatValue(value), formatValues(s.Enum))
+	}
+	for _, sub := range s.AllOf {
+		v.validate(path, value, sub)
+	}
+	if len(s.AnyOf) > 0 && v.matching(path, value, s.AnyOf) == 0 {
+		v.errorf(path, "matches none of the anyOf schemas")
+	}
+	if n := v.matching(path, value, s.OneOf); len(s.OneOf) > 0 && n != 1 {
+		v.errorf(path, "matches %d of the oneOf schemas; expected exactly one", n)
+	}
+	if s.Not != nil && v.matching(path, value, []*schema{s.Not}) == 1 {
+		v.errorf(path, "matches the schema it must not match")
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(path, value, s)
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range value {
+				v.validate(fmt.Sprintf("%s[%d]", path, i), item, s.Items)
+			}
+		}
+	}
+}
+
+func (v *validation) validateObject(path string, obj map[string]interface{}, s *schema) {
+	for _, r := range s.Required {
+		if _, ok := obj[r]; !ok {
+			v.errorf(path, "missing required field %q", r)
+		}
+	}
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if p, ok := s.Properties[k]; ok {
+			v.validate(fieldPath(path, k), obj[k], p)
+			continue
+		}
+		if s.AdditionalProperties != nil {
+			if s.AdditionalProperties.schema != nil {
+				v.validate(fieldPath(path, k), obj[k], s.AdditionalProperties.schema)
+			} else if !s.AdditionalProperties.allowed {
+				v.errorf(fieldPath(path, k), "unknown field")
+			}
+			continue
+		}
+		if s.EmbeddedResource && (k == "apiVersion" || k == "kind" || k == "metadata") {
+			continue
+		}
+		if v.strict && len(s.Properties) > 0 && !s.PreserveUnknownFields {
+			v.errorf(fieldPath(path, k), "unknown field")
+		}
+	}
+}
+
+// matching returns the number of schemas that value matches. Unknown fields are allowed since
+// these schemas only add constraints to the properties of the enclosing schema.
+func (v *validation) matching(path string, value interface{}, schemas []*schema) int {
+	n := 0
+	for _, s := range schemas {
+		sub := &validation{definitions: v.definitions}
+		sub.validate(path, value, s)
+		if len(sub.errors) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// checkType reports whether value has the JSON type t, and records a violation if it doesn't.
+// An empty type allows any value.
+func (v *validation) checkType(path string, value interface{}, t string) bool {
+	ok := true
+	switch t {
+	case "object":
+		_, ok = value.(map[string]interface{})
+	case "array":
+		_, ok = value.([]interface{})
+	case "string":
+		_, ok = value.(string)
+	case "boolean":
+		_, ok = value.(bool)
+	case "number":
+		_, ok = value.(float64)
+	case "integer":
+		ok = isInteger(value)
+	}
+	if !ok {
+		v.errorf(path, "expected %v, got %v", t, formatValue(value))
+	}
+	return ok
+}
+
+func isInteger(value interface{}) bool {
+	f, ok := value.(float64)
+	return ok && f == float64(int64(f))
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, e := range values {
+		if fmt.Sprint(e) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatValue describes value in a violation, e.g. string "IfNotPresnt" or an object
+func formatValue(value interface{}) string {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case string:
+		return fmt.Sprintf("string %q", value)
+	case bool:
+		return fmt.Sprintf("boolean %v", value)
+	case float64:
+		return fmt.Sprintf("number %v", value)
+	}
+	return fmt.Sprint(value)
+}
+
+func formatValues(values []interface{}) string {
+	s := make([]string, 0, len(values))
+	for _, v := range values {
+		s = append(s, fmt.Sprintf("%q", fmt.Sprint(v)))
+	}
+	return strings.Join(s, ", ")
+}
+
+var (
+	defaultValidatorOnce sync.Once
+	defaultValidator     *schemaValidator
+	defaultValidatorErr  error
+)
+
+// unitTestsDir returns the directory of this package. The tests of the packages below awsconfigs
+// run in their own directory, so SchemaDir and RepoRoot are resolved relative to it.
+func unitTestsDir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}
+
+// validateSchemas fails the test for every resource that doesn't match its schema in each of the
+// KubernetesVersions, or the schema of its CRD
+func validateSchemas(t *testing.T, resources []*builtResource) {
+	t.Helper()
+	defaultValidatorOnce.Do(func() {
+		dir := unitTestsDir()
+		defaultValidator, defaultValidatorErr = newSchemaValidator(filepath.Join(dir, SchemaDir), filepath.Join(dir, RepoRoot), KubernetesVersions)
+	})
+	if defaultValidatorErr != nil {
+		t.Fatalf("Could not load schemas; error: %v", defaultValidatorErr)
+	}
+
+	violations, err := defaultValidator.validate(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range violations {
+		t.Errorf("Resource %v does not match its schema: %v", v.Resource, v.Message)
+	}
+}
@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSchemaValidator(t *testing.T) {
+	validator, err := newSchemaValidator(SchemaDir, RepoRoot, KubernetesVersions)
+	if err != nil {
+		t.Fatalf("Could not load schemas; error: %v", err)
+	}
+
+	resources := []*builtResource{
+		newBuiltResource("apps", "v1", "Deployment", "kubeflow", "app", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: kubeflow
+spec:
+  replicas: "1"
+  selector:
+    matchLabels:
+      app: app
+  template:
+    metadata:
+      creationTimestamp: null
+    spec:
+      hostUsers: false
+      containers:
+      - image: app
+        imagePullPolicy: IfNotPresnt
+        ports:
+        - containerPort: 8080
+        resources:
+          limits:
+            cpu: 1
+            memory: 1Gi
+        volumes:
+        - name: config
+`)),
+		newBuiltResource("apiextensions.k8s.io", "v1", "CustomResourceDefinition", "", "widgets.example.com", []byte(`apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+    plural: widgets
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            oneOf:
+            - required: [size]
+            - required: [preset]
+            properties:
+              size:
+                type: integer
+              preset:
+                type: string
+              labels:
+                type: object
+                additionalProperties:
+                  type: string
+              config:
+                type: object
+                x-kubernetes-preserve-unknown-fields: true
+`)),
+		newBuiltResource("example.com", "v1", "Widget", "kubeflow", "widget", []byte(`apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: widget
+  namespace: kubeflow
+  label:
+    app: widget
+spec:
+  size: large
+  preset: small
+  colour: blue
+  labels:
+    app: widget
+    replicas: 1
+  config:
+    anything: goes
+`)),
+		newBuiltResource("example.com", "v1", "Gadget", "kubeflow", "gadget", []byte(`apiVersion: example.com/v1
+kind: Gadget
+metadata:
+  name: gadget
+  namespace: kubeflow
+`)),
+		newBuiltResource("kubeflow.org", "v1alpha1", "PodDefault", "kubeflow", "access-ml-pipeline", []byte(`apiVersion: kubeflow.org/v1alpha1
+kind: PodDefault
+metadata:
+  name: access-ml-pipeline
+  namespace: kubeflow
+spec:
+  desc: Allow access to Kubeflow Pipelines
+  selector:
+    matchLabels:
+      access-ml-pipeline: "true"
+  env:
+  - name: KF_PIPELINES_SA_TOKEN_PATH
+    value: /var/run/secrets/kubeflow/pipelines/token
+`)),
+	}
+
+	violations, err := validator.validate(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual []string
+	for _, v := range violations {
+		actual = append(actual, v.Resource+": "+v.Message)
+	}
+	want := []string{
+		`apps/v1 Deployment kubeflow/app: spec.replicas: expected integer, got string "1"`,
+		`apps/v1 Deployment kubeflow/app: spec.template.spec.containers[0].imagePullPolicy: unsupported value string "IfNotPresnt"; expected one of "Always", "Never", "IfNotPresent"`,
+		`apps/v1 Deployment kubeflow/app: spec.template.spec.containers[0].volumes: unknown field`,
+		`apps/v1 Deployment kubeflow/app: spec.template.spec.containers[0]: missing required field "name"`,
+		`apps/v1 Deployment kubeflow/app: spec.template.spec.hostUsers: unknown field (Kubernetes 1.23, 1.24)`,
+		`example.com/v1 Gadget kubeflow/gadget: example.com/v1 is not served by Kubernetes 1.23, 1.24, 1.25 and has no CRD in the repository; pin its CRD in update_schemas.py`,
+		`example.com/v1 Widget kubeflow/widget: metadata.label: unknown field`,
+		`example.com/v1 Widget kubeflow/widget: spec.colour: unknown field`,
+		`example.com/v1 Widget kubeflow/widget: spec.labels.replicas: expected string, got number 1`,
+		`example.com/v1 Widget kubeflow/widget: spec.size: expected integer, got string "large"`,
+		`example.com/v1 Widget kubeflow/widget: spec: matches 2 of the oneOf schemas; expected exactly one`,
+	}
+	if strings.Join(actual, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got violations\n  %v\nwant\n  %v", strings.Join(actual, "\n  "), strings.Join(want, "\n  "))
+	}
+}
@@ -0,0 +1,211 @@
+package tests
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+// ServiceAllowlistFile lists the Services and Ingresses of packages and charts whose pods or backends are deployed
+// by another component
+const ServiceAllowlistFile = "service_wiring_allowlist.yaml"
+
+// ServiceException allows the Service or Ingress of a package or chart to reference pods or Services that aren't
+// in its build
+type ServiceException struct {
+	// Resource matches the key of the resource, e.g. "v1 Service istio-system/knative-local-gateway"
+	Resource string `json:"resource"`
+	// Reason names the component that deploys the other end
+	Reason string `json:"reason"`
+}
+
+func (e *ServiceException) validate() error {
+	if e.Resource == "" || e.Reason == "" {
+		return errors.New("needs a resource and a reason")
+	}
+	return nil
+}
+
+// loadServiceAllowlist reads the exceptions in path
+func loadServiceAllowlist(path string) ([]*ServiceException, error) {
+	var exceptions []*ServiceException
+	if err := loadAllowlist(path, &exceptions); err != nil {
+		return nil, err
+	}
+	return exceptions, nil
+}
+
+// WiringIssue is a Service or Ingress that wouldn't get endpoints
+type WiringIssue struct {
+	// Resource is the key of the Service or Ingress
+	Resource string
+	Message  string
+}
+
+// checkServiceWiring returns an issue for every Service and Ingress of a build that wouldn't get endpoints:
+//   - a Service whose selector matches no pod template in its namespace
+//   - a named targetPort of a Service that a matched pod template doesn't define as a container port
+//   - an Ingress backend that isn't a Service of the build, or not one of its ports
+//
+// Services without a selector, e.g. of type ExternalName or with manual endpoints, aren't checked.
+func checkServiceWiring(resources []*builtResource) ([]*WiringIssue, error) {
+	index, err := newBuildIndex(resources)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []*WiringIssue
+	for _, r := range resources {
+		var messages []string
+		switch {
+		case r.group == "" && r.kind == "Service":
+			messages = checkServiceEndpoints(index.services[r.namespace+"/"+r.name], index)
+		case (r.group == "networking.k8s.io" || r.group == "extensions") && r.kind == "Ingress":
+			object := map[string]interface{}{}
+			if err := yaml.Unmarshal(r.yaml, &object); err != nil {
+				return nil, fmt.Errorf("could not parse resource %v; error: %v", r.Key(), err)
+			}
+			messages = checkIngressBackends(r, object, index)
+		}
+		for _, m := range messages {
+			issues = append(issues, &WiringIssue{Resource: r.Key(), Message: m})
+		}
+	}
+	return issues, nil
+}
+
+// checkServiceEndpoints returns a message if the selector of the Service matches no pod template, and for every
+// named targetPort that a matched pod template doesn't define
+func checkServiceEndpoints(s *service, index *buildIndex) []string {
+	if len(s.selector) == 0 {
+		return nil
+	}
+	var matched []*workload
+	for _, w := range index.workloads {
+		if w.resource.namespace == s.resource.namespace && w.matches(s.selector) {
+			matched = append(matched, w)
+		}
+	}
+	if len(matched) == 0 {
+		return []string{fmt.Sprintf("Resource %v selects pods with %v at spec.selector, which match no pod template in the build",
+			s.resource.Key(), formatLabels(s.selector))}
+	}
+
+	var messages []string
+	for i, p := range s.ports {
+		if _, err := strconv.Atoi(p.targetPort); err == nil {
+			continue
+		}
+		for _, w := range matched {
+			if !w.hasPort(p.targetPort) {
+				messages = append(messages, fmt.Sprintf("Resource %v targets port %v at spec.ports[%d].targetPort, which no container of %v defines",
+					s.resource.Key(), p.targetPort, i, w.resource.Key()))
+			}
+		}
+	}
+	return messages
+}
+
+// hasPort reports whether a container of the pod template has a port with the name
+func (w *workload) hasPort(name string) bool {
+	for _, c := range w.template.containers() {
+		ports, _ := c.container["ports"].([]interface{})
+		for _, p := range ports {
+			if port, ok := p.(map[string]interface{}); ok && port["name"] == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkIngressBackends returns a message for every backend of the Ingress whose Service or port isn't in the build.
+// Backends are read in the format of networking.k8s.io/v1 and of extensions/v1beta1.
+func checkIngressBackends(r *builtResource, object map[string]interface{}, index *buildIndex) []string {
+	var messages []string
+	checkBackend := func(path string, backend interface{}) {
+		b, ok := backend.(map[string]interface{})
+		if !ok {
+			return
+		}
+		name, _ := nested(b, "service", "name").(string)
+		port := nested(b, "service", "port", "number")
+		if port == nil {
+			port = nested(b, "service", "port", "name")
+		}
+		if name == "" {
+			name, _ = b["serviceName"].(string)
+			port = b["servicePort"]
+		}
+		if name == "" {
+			// A resource backend, e.g. of a storage bucket
+			return
+		}
+		s, found := index.services[r.namespace+"/"+name]
+		if !found {
+			messages = append(messages, fmt.Sprintf("Resource %v routes to Service %v at %v, which isn't in the build", r.Key(), name, path))
+			return
+		}
+		if port == nil {
+			return
+		}
+		for _, p := range s.ports {
+			if n, isNumber := port.(float64); isNumber && p.port == int(n) || port == p.name {
+				return
+			}
+		}
+		messages = append(messages, fmt.Sprintf("Resource %v routes to port %v of Service %v at %v, which the Service doesn't expose",
+			r.Key(), port, name, path))
+	}
+
+	checkBackend("spec.defaultBackend", nested(object, "spec", "defaultBackend"))
+	checkBackend("spec.backend", nested(object, "spec", "backend"))
+	rules, _ := nested(object, "spec", "rules").([]interface{})
+	for i, e := range rules {
+		rule, _ := e.(map[string]interface{})
+		paths, _ := nested(rule, "http", "paths").([]interface{})
+		for j, p := range paths {
+			path, _ := p.(map[string]interface{})
+			checkBackend(fmt.Sprintf("spec.rules[%d].http.paths[%d].backend", i, j), path["backend"])
+		}
+	}
+	return messages
+}
+
+var (
+	defaultServiceAllowlistOnce sync.Once
+	defaultServiceAllowlist     []*ServiceException
+	defaultServiceAllowlistErr  error
+)
+
+// checkServices fails the test for every Service and Ingress of the resources that wouldn't get endpoints, see
+// checkServiceWiring. The resources of a package or chart may reference the pods and Services of other components
+// that are listed in ServiceAllowlistFile, while a deployment option has to resolve every reference.
+func checkServices(t *testing.T, resources []*builtResource, deployment bool) {
+	t.Helper()
+	defaultServiceAllowlistOnce.Do(func() {
+		defaultServiceAllowlist, defaultServiceAllowlistErr = loadServiceAllowlist(filepath.Join(unitTestsDir(), ServiceAllowlistFile))
+	})
+	if defaultServiceAllowlistErr != nil {
+		t.Fatalf("Could not load %v; error: %v", ServiceAllowlistFile, defaultServiceAllowlistErr)
+	}
+
+	issues, err := checkServiceWiring(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range issues {
+		allowed := false
+		for _, e := range defaultServiceAllowlist {
+			allowed = allowed || (!deployment && matchPattern(e.Resource, i.Resource))
+		}
+		if !allowed {
+			t.Error(i.Message)
+		}
+	}
+}
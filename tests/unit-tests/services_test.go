@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckServiceWiring(t *testing.T) {
+	resources := []*builtResource{
+		newBuiltResource("apps", "v1", "Deployment", "istio-system", "aws-authservice", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: aws-authservice
+  namespace: istio-system
+spec:
+  template:
+    metadata:
+      labels:
+        app: aws-authservice
+    spec:
+      containers:
+      - name: aws-authservice
+        ports:
+        - name: http-api
+          containerPort: 8082
+`)),
+		newBuiltResource("", "v1", "Service", "istio-system", "aws-authservice", []byte(`apiVersion: v1
+kind: Service
+metadata:
+  name: aws-authservice
+  namespace: istio-system
+spec:
+  selector:
+    app: aws-authservice
+  ports:
+  - name: http-api
+    port: 8082
+    targetPort: http-api
+  - name: metrics
+    port: 9090
+    targetPort: metrics
+  - name: http
+    port: 80
+    targetPort: 8080
+`)),
+		newBuiltResource("", "v1", "Service", "kubeflow", "aws-authservice", []byte(`apiVersion: v1
+kind: Service
+metadata:
+  name: aws-authservice
+  namespace: kubeflow
+spec:
+  selector:
+    app: aws-authservice
+  ports:
+  - port: 80
+`)),
+		newBuiltResource("", "v1", "Service", "kubeflow", "external", []byte(`apiVersion: v1
+kind: Service
+metadata:
+  name: external
+  namespace: kubeflow
+spec:
+  type: ExternalName
+  externalName: example.com
+`)),
+		newBuiltResource("networking.k8s.io", "v1", "Ingress", "istio-system", "istio-ingress", []byte(`apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: istio-ingress
+  namespace: istio-system
+spec:
+  defaultBackend:
+    service:
+      name: aws-authservice
+      port:
+        name: http-api
+  rules:
+  - http:
+      paths:
+      - path: /*
+        backend:
+          service:
+            name: istio-ingressgateway
+            port:
+              number: 80
+      - path: /authservice
+        backend:
+          service:
+            name: aws-authservice
+            port:
+              number: 8080
+`)),
+		newBuiltResource("extensions", "v1beta1", "Ingress", "istio-system", "legacy", []byte(`apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  name: legacy
+  namespace: istio-system
+spec:
+  backend:
+    serviceName: aws-authservice
+    servicePort: 8082
+`)),
+	}
+
+	expected := []string{
+		"Resource v1 Service istio-system/aws-authservice targets port metrics at spec.ports[1].targetPort, which no container of apps/v1 Deployment istio-system/aws-authservice defines",
+		"Resource v1 Service kubeflow/aws-authservice selects pods with app=aws-authservice at spec.selector, which match no pod template in the build",
+		"Resource networking.k8s.io/v1 Ingress istio-system/istio-ingress routes to Service istio-ingressgateway at spec.rules[0].http.paths[0].backend, which isn't in the build",
+		"Resource networking.k8s.io/v1 Ingress istio-system/istio-ingress routes to port 8080 of Service aws-authservice at spec.rules[0].http.paths[1].backend, which the Service doesn't expose",
+	}
+	issues, err := checkServiceWiring(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual []string
+	for _, i := range issues {
+		actual = append(actual, i.Message)
+	}
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got\n%v\nwant\n%v", strings.Join(actual, "\n"), strings.Join(expected, "\n"))
+	}
+}
@@ -1,44 +1,82 @@
 package tests
 
 import (
+	"flag"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/ghodss/yaml"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"sigs.k8s.io/kustomize/v3/k8sdeps/kunstruct"
-	"sigs.k8s.io/kustomize/v3/k8sdeps/transformer"
-	"sigs.k8s.io/kustomize/v3/pkg/fs"
-	"sigs.k8s.io/kustomize/v3/pkg/loader"
-	"sigs.k8s.io/kustomize/v3/pkg/plugins"
-	"sigs.k8s.io/kustomize/v3/pkg/resmap"
-	"sigs.k8s.io/kustomize/v3/pkg/resource"
-	"sigs.k8s.io/kustomize/v3/pkg/target"
-	"sigs.k8s.io/kustomize/v3/pkg/validators"
 )
 
+// update rewrites the expected resources from the actual output instead of comparing them.
+// It can also be enabled by setting UPDATE_GOLDEN=1, e.g. when running go test on several packages.
+var update = flag.Bool("update", false, "update the expected resources in test_data/expected")
+
+func updateGolden() bool {
+	return *update || os.Getenv("UPDATE_GOLDEN") == "1"
+}
+
 type KustomizeTestCase struct {
 	// Package is the path to the kustomize directory to run kustomize in
 	Package string
 	// Expected is a path to a directory containing the expected resources
 	Expected string
+	// Compare selects how actual and expected resources are compared; defaults to SemanticCompare
+	Compare CompareMode
+	// Engine selects the kustomize implementation; defaults to KrustyEngine
+	Engine Engine
 }
 
-// RunTestCase runs the specified test case
+// RunTestCase runs the specified test case. The built resources are also validated, see validateResources.
 func RunTestCase(t *testing.T, testCase *KustomizeTestCase) {
+	fmt.Println(testCase.Package)
+	actual := buildPackage(t, testCase.Package, testCase.Engine)
+	validateResources(t, actual)
+	checkIstio(t, actual, false)
+	checkServices(t, actual, false)
+	compareExpected(t, testCase.Expected, actual, testCase.Compare)
+}
+
+// validateResources validates built resources against their schemas and checks them for deprecated APIs,
+// against the policies in PolicyDir, for unresolved placeholders, against the ImagePolicyFile and for webhooks
+// whose Service or Certificate isn't in the build
+func validateResources(t *testing.T, resources []*builtResource) {
+	t.Helper()
+	validateSchemas(t, resources)
+	checkDeprecatedAPIs(t, resources)
+	checkPolicies(t, resources)
+	checkPlaceholders(t, resources)
+	checkImages(t, resources)
+	checkWebhooks(t, resources)
+}
+
+// compareExpected compares the actual resources to the expected resources in the directory expectedDir,
+// or rewrites the directory from the actual resources in update mode
+func compareExpected(t *testing.T, expectedDir string, actual []*builtResource, compare CompareMode) {
+	t.Helper()
+	if updateGolden() {
+		writeExpected(t, expectedDir, actual)
+		return
+	}
+
 	expected := map[string]*expectedResource{}
 
 	// Read all the YAML files containing expected resources and parse them.
-	files, err := ioutil.ReadDir(testCase.Expected)
+	files, err := ioutil.ReadDir(expectedDir)
+	if os.IsNotExist(err) {
+		t.Fatalf("No expected resources in %v; run the test with -update or UPDATE_GOLDEN=1 to create them", expectedDir)
+	}
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	for _, f := range files {
-		contents, err := ioutil.ReadFile(filepath.Join(testCase.Expected, f.Name()))
+		contents, err := ioutil.ReadFile(filepath.Join(expectedDir, f.Name()))
 		if err != nil {
 			t.Fatalf("Err: %v", err)
 		}
@@ -54,36 +92,18 @@ func RunTestCase(t *testing.T, testCase *KustomizeTestCase) {
 			u:        u,
 		}
 
+		if previous, ok := expected[r.Key()]; ok {
+			t.Errorf("Expected resources %v and %v have the same identity: %v", previous.fileName, r.fileName, r.Key())
+			continue
+		}
 		expected[r.Key()] = r
 	}
 
-	fsys := fs.MakeRealFS()
-	// We don't want to enforce the security check.
-	// This is equivalent to running:
-	// kustomize build --load_restrictor none
-	lrc := loader.RestrictionNone
-
-	_loader, loaderErr := loader.NewLoader(lrc, validators.MakeFakeValidator(), testCase.Package, fsys)
-	fmt.Println(testCase.Package)
-	if loaderErr != nil {
-		t.Fatalf("could not load kustomize loader: %v", loaderErr)
-	}
-	rf := resmap.NewFactory(resource.NewFactory(kunstruct.NewKunstructuredFactoryImpl()), transformer.NewFactoryImpl())
-	pc := plugins.DefaultPluginConfig()
-	kt, err := target.NewKustTarget(_loader, rf, transformer.NewFactoryImpl(), plugins.NewLoader(pc, rf))
-	if err != nil {
-		t.Fatalf("Unexpected construction error %v", err)
-	}
-	actual, err := kt.MakeCustomizedResMap()
-	if err != nil {
-		t.Fatalf("Err: %v", err)
-	}
-
 	actualNames := map[string]bool{}
 
 	// Check that all the actual resources match the expected resources
-	for _, r := range actual.Resources() {
-		rKey := key(r.GetKind(), r.GetName())
+	for _, r := range actual {
+		rKey := r.Key()
 		actualNames[rKey] = true
 
 		e, ok := expected[rKey]
@@ -93,16 +113,15 @@ func RunTestCase(t *testing.T, testCase *KustomizeTestCase) {
 			continue
 		}
 
-		actualYaml, err := r.AsYAML()
-
-		if err != nil {
-			t.Errorf("Could not generate YAML for resource: %v; error: %v", rKey, err)
-			continue
-		}
+		actualYaml := r.yaml
 		// Ensure the actual YAML matches.
-		if string(actualYaml) != e.yaml {
-			ReportDiffAndFail(t, actualYaml, e.yaml)
+		if compare == ByteCompare {
+			if string(actualYaml) != e.yaml {
+				ReportDiffAndFail(t, rKey, actualYaml, e.yaml)
+			}
+			continue
 		}
+		ReportSemanticDiff(t, rKey, actualYaml, e.yaml)
 	}
 
 	// Make sure we aren't missing any expected resources
@@ -114,6 +133,61 @@ func RunTestCase(t *testing.T, testCase *KustomizeTestCase) {
 
 }
 
+// writeExpected replaces the contents of the expected directory with the actual resources.
+// Files are named like the output of "kustomize build -o", so stale files of removed or
+// renamed resources are deleted, see expectedFileNames.
+func writeExpected(t *testing.T, dir string, actual []*builtResource) {
+	names, err := expectedFileNames(actual)
+	if err != nil {
+		t.Fatalf("Could not write expected resources to %v; error: %v", dir, err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatalf("Could not remove expected directory %v; error: %v", dir, err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Could not create expected directory %v; error: %v", dir, err)
+	}
+	for i, r := range actual {
+		if err := ioutil.WriteFile(filepath.Join(dir, names[i]), r.yaml, 0644); err != nil {
+			t.Fatalf("Could not write %v; error: %v", names[i], err)
+		}
+	}
+	t.Logf("Updated %v resources in %v", len(actual), dir)
+}
+
+// expectedFileNames returns the name of the expected file of each resource. Resources that
+// only differ in their namespace would get the same name from expectedFileName, so their
+// names get the namespace as well, i.e. <group>_<version>_<kind>_<namespace>_<name>.yaml.
+// It fails if two resources have the same identity.
+func expectedFileNames(resources []*builtResource) ([]string, error) {
+	count := map[string]int{}
+	keys := map[string]bool{}
+	for _, r := range resources {
+		if keys[r.Key()] {
+			return nil, fmt.Errorf("resource %v is built more than once", r.Key())
+		}
+		keys[r.Key()] = true
+		count[r.FileName()]++
+	}
+	names := make([]string, len(resources))
+	for i, r := range resources {
+		names[i] = r.FileName()
+		if count[names[i]] > 1 {
+			names[i] = expectedFileName(r.group, r.version, r.kind, r.namespace+"_"+r.name)
+		}
+	}
+	return names, nil
+}
+
+// expectedFileName returns the file name "kustomize build -o" uses for a resource,
+// i.e. <group>_<version>_<kind>_<name>.yaml with ~g as the group of core resources.
+func expectedFileName(group, version, kind, name string) string {
+	if group == "" {
+		group = "~g"
+	}
+	return strings.ToLower(fmt.Sprintf("%s_%s_%s_%s.yaml", group, version, kind, name))
+}
+
 func convertToArray(x string) ([]string, int) {
 	a := strings.Split(strings.TrimSuffix(x, "\n"), "\n")
 	maxLen := 0
@@ -136,8 +210,13 @@ type expectedResource struct {
 }
 
 // key generates a name to index resources by. It is used to match expected and actual resources.
-func key(kind string, name string) string {
-	return kind + "." + name
+// Resources are identified by group, version, kind, namespace and name, e.g.
+// "apps/v1 Deployment istio-system/aws-authservice" or "v1 Namespace kubeflow" for cluster scoped resources.
+func key(apiVersion string, kind string, namespace string, name string) string {
+	if namespace != "" {
+		name = namespace + "/" + name
+	}
+	return apiVersion + " " + kind + " " + name
 }
 
 // Key returns a unique identifier fo this resource that can be used to index it
@@ -146,13 +225,14 @@ func (r *expectedResource) Key() string {
 		return ""
 	}
 
-	return key(r.u.GetKind(), r.u.GetName())
+	return key(r.u.GetAPIVersion(), r.u.GetKind(), r.u.GetNamespace(), r.u.GetName())
 }
 
-// Pretty printing of file differences.
-func ReportDiffAndFail(t *testing.T, actual []byte, expected string) {
+// Pretty printing of file differences for the resource identified by rKey.
+func ReportDiffAndFail(t *testing.T, rKey string, actual []byte, expected string) {
 	sE, maxLen := convertToArray(expected)
 	sA, _ := convertToArray(string(actual))
+	fmt.Printf("===== RESOURCE %v\n", rKey)
 	fmt.Println("===== ACTUAL BEGIN ========================================")
 	fmt.Print(string(actual))
 	fmt.Println("===== ACTUAL END ==========================================")
@@ -177,7 +257,7 @@ func ReportDiffAndFail(t *testing.T, actual []byte, expected string) {
 			fmt.Printf(format, "X", sE[i], "")
 		}
 	}
-	t.Fatalf("Expected not equal to actual")
+	t.Fatalf("Expected not equal to actual for resource: %v", rKey)
 }
 
 func tabToSpace(input string) string {
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpectedFileName(t *testing.T) {
+	type testCase struct {
+		Group    string
+		Version  string
+		Kind     string
+		Name     string
+		Expected string
+	}
+
+	testCases := []testCase{
+		{
+			Version:  "v1",
+			Kind:     "ConfigMap",
+			Name:     "authservice-config-ck6577dfkd",
+			Expected: "~g_v1_configmap_authservice-config-ck6577dfkd.yaml",
+		},
+		{
+			Group:    "networking.istio.io",
+			Version:  "v1alpha3",
+			Kind:     "EnvoyFilter",
+			Name:     "kubeflow-userid",
+			Expected: "networking.istio.io_v1alpha3_envoyfilter_kubeflow-userid.yaml",
+		},
+	}
+
+	for _, c := range testCases {
+		actual := expectedFileName(c.Group, c.Version, c.Kind, c.Name)
+		if actual != c.Expected {
+			t.Errorf("got %v; want %v", actual, c.Expected)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	type testCase struct {
+		APIVersion string
+		Kind       string
+		Namespace  string
+		Name       string
+		Expected   string
+	}
+
+	testCases := []testCase{
+		{
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+			Namespace:  "istio-system",
+			Name:       "aws-authservice",
+			Expected:   "apps/v1 Deployment istio-system/aws-authservice",
+		},
+		{
+			APIVersion: "v1",
+			Kind:       "Namespace",
+			Name:       "kubeflow",
+			Expected:   "v1 Namespace kubeflow",
+		},
+	}
+
+	for _, c := range testCases {
+		actual := key(c.APIVersion, c.Kind, c.Namespace, c.Name)
+		if actual != c.Expected {
+			t.Errorf("got %v; want %v", actual, c.Expected)
+		}
+	}
+
+	// Resources that only differ in namespace or group must not collide.
+	if key("v1", "Secret", "kubeflow", "s") == key("v1", "Secret", "istio-system", "s") {
+		t.Errorf("keys of resources in different namespaces collide")
+	}
+	if key("v1beta1", "Ingress", "", "i") == key("networking.k8s.io/v1beta1", "Ingress", "", "i") {
+		t.Errorf("keys of resources in different groups collide")
+	}
+}
+
+func TestExpectedFileNames(t *testing.T) {
+	resources := []*builtResource{
+		newBuiltResource("", "v1", "ServiceAccount", "kubeflow", "default-editor", []byte("a")),
+		newBuiltResource("", "v1", "ServiceAccount", "istio-system", "default-editor", []byte("b")),
+		newBuiltResource("", "v1", "Namespace", "", "kubeflow", []byte("c")),
+	}
+	expected := []string{
+		"~g_v1_serviceaccount_kubeflow_default-editor.yaml",
+		"~g_v1_serviceaccount_istio-system_default-editor.yaml",
+		"~g_v1_namespace_kubeflow.yaml",
+	}
+	actual, err := expectedFileNames(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(actual, ",") != strings.Join(expected, ",") {
+		t.Errorf("got %v; want %v", actual, expected)
+	}
+
+	if _, err := expectedFileNames(append(resources, resources[0])); err == nil {
+		t.Errorf("got no error for a resource that is built twice")
+	}
+}
@@ -0,0 +1,152 @@
+"""Update the schemas in test_data/schemas that resources are validated against.
+
+The Kubernetes schemas are the definitions of the OpenAPI spec of each
+Kubernetes version we target, see KUBERNETES_VERSIONS. CRDs that aren't
+vendored in this repository are pinned in test_data/schemas/crds, see
+PINNED_CRDS. Descriptions and constraints the tests don't check are dropped
+to keep the files small and their diffs readable.
+
+Enums aren't part of the OpenAPI spec; they are maintained by hand in
+test_data/schemas/kubernetes/enums.yaml.
+"""
+
+import json
+import logging
+import os
+import urllib.request
+
+import yaml
+
+# The latest patch release of each Kubernetes minor version supported by the
+# EKS versions in website/content/en/docs/about/eks-compatibility.md
+KUBERNETES_VERSIONS = ["1.23.17", "1.24.17", "1.25.16"]
+
+SWAGGER_URL = ("https://raw.githubusercontent.com/kubernetes/kubernetes/"
+               "v{version}/api/openapi-spec/swagger.json")
+
+# CRDs of resources built by this repository that are installed from
+# elsewhere, e.g. by upstream kubeflow/manifests or a deployment guide
+PINNED_CRDS = [
+    # cert-manager version of kubeflow/manifests v1.7
+    "https://raw.githubusercontent.com/cert-manager/cert-manager/v1.10.1/"
+    "deploy/crds/crd-certificates.yaml",
+    "https://raw.githubusercontent.com/cert-manager/cert-manager/v1.10.1/"
+    "deploy/crds/crd-clusterissuers.yaml",
+    "https://raw.githubusercontent.com/cert-manager/cert-manager/v1.10.1/"
+    "deploy/crds/crd-issuers.yaml",
+    # secrets-store-csi-driver version of the RDS and S3 deployment guides
+    "https://raw.githubusercontent.com/kubernetes-sigs/secrets-store-csi-driver/"
+    "v1.3.2/deploy/secrets-store.csi.x-k8s.io_secretproviderclasses.yaml",
+]
+
+SCHEMA_DIR = os.path.join(os.path.dirname(os.path.abspath(__file__)),
+                          "test_data", "schemas")
+
+# The schema keywords the tests validate; everything else is dropped
+SCHEMA_KEYS = {
+    "$ref",
+    "additionalProperties",
+    "allOf",
+    "anyOf",
+    "enum",
+    "format",
+    "items",
+    "not",
+    "nullable",
+    "oneOf",
+    "properties",
+    "required",
+    "type",
+    "x-kubernetes-embedded-resource",
+    "x-kubernetes-group-version-kind",
+    "x-kubernetes-int-or-string",
+    "x-kubernetes-preserve-unknown-fields",
+}
+
+
+def fetch(url):
+    logging.info("Downloading %s", url)
+    with urllib.request.urlopen(url) as response:
+        return response.read()
+
+
+def trim(schema):
+    """Return schema with only the SCHEMA_KEYS, recursively."""
+    if not isinstance(schema, dict):
+        return schema
+    trimmed = {}
+    for key, value in schema.items():
+        if key not in SCHEMA_KEYS:
+            continue
+        if key == "properties":
+            value = {name: trim(s) for name, s in value.items()}
+        elif key in ("additionalProperties", "items", "not"):
+            value = trim(value)
+        elif key in ("allOf", "anyOf", "oneOf"):
+            value = [trim(s) for s in value]
+        trimmed[key] = value
+    return trimmed
+
+
+def update_kubernetes(version):
+    swagger = json.loads(fetch(SWAGGER_URL.format(version=version)))
+    definitions = {name: trim(d)
+                   for name, d in swagger["definitions"].items()}
+    minor = ".".join(version.split(".")[:2])
+    path = os.path.join(SCHEMA_DIR, "kubernetes", "v{}.json".format(minor))
+    logging.info("Writing %s", path)
+    # One definition per line so that diffs between versions stay readable
+    lines = ["    {}: {}".format(json.dumps(name),
+                               json.dumps(d, sort_keys=True))
+             for name, d in sorted(definitions.items())]
+    with open(path, "w") as f:
+        f.write("{{\n  \"version\": {},\n  \"definitions\": {{\n".format(
+            json.dumps(version)))
+        f.write(",\n".join(lines))
+        f.write("\n  }\n}\n")
+
+
+def update_crd(url):
+    for crd in yaml.safe_load_all(fetch(url)):
+        if not crd or crd.get("kind") != "CustomResourceDefinition":
+            continue
+        spec = crd["spec"]
+        pinned = {
+            "apiVersion": crd["apiVersion"],
+            "kind": crd["kind"],
+            "metadata": {"name": crd["metadata"]["name"]},
+            "spec": {
+                "group": spec["group"],
+                "names": {"kind": spec["names"]["kind"],
+                          "plural": spec["names"]["plural"]},
+                "scope": spec["scope"],
+                "versions": [{
+                    "name": v["name"],
+                    "schema": {"openAPIV3Schema": trim(
+                        v["schema"]["openAPIV3Schema"])},
+                } for v in spec["versions"]],
+            },
+        }
+        path = os.path.join(SCHEMA_DIR, "crds",
+                            crd["metadata"]["name"] + ".yaml")
+        logging.info("Writing %s", path)
+        with open(path, "w") as f:
+            f.write("# Source: {}\n".format(url))
+            f.write("# Updated by update_schemas.py; do not edit.\n")
+            yaml.safe_dump(pinned, f, default_flow_style=False)
+
+
+if __name__ == "__main__":
+    logging.basicConfig(
+        level=logging.INFO,
+        format=('%(levelname)s|%(asctime)s'
+                '|%(pathname)s|%(lineno)d| %(message)s'),
+        datefmt='%Y-%m-%dT%H:%M:%S',
+    )
+
+    os.makedirs(os.path.join(SCHEMA_DIR, "kubernetes"), exist_ok=True)
+    os.makedirs(os.path.join(SCHEMA_DIR, "crds"), exist_ok=True)
+    for v in KUBERNETES_VERSIONS:
+        update_kubernetes(v)
+    for u in PINNED_CRDS:
+        update_crd(u)
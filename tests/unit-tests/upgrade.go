@@ -0,0 +1,207 @@
+package tests
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// baseRef is the git revision TestUpgradeSafety checks upgrades from, also read from BASE_REF
+var baseRef = flag.String("base-ref", "", "git revision whose deployment options TestUpgradeSafety upgrades from, e.g. origin/main")
+
+// upgradeBaseRef returns the revision set with -base-ref or BASE_REF, or "" if upgrades aren't checked
+func upgradeBaseRef() string {
+	if *baseRef != "" {
+		return *baseRef
+	}
+	return os.Getenv("BASE_REF")
+}
+
+// immutableFields are the fields, by API group and kind, that the API server rejects changes to, so that applying
+// a changed manifest over the resource of a previous release fails and the resource has to be deleted first
+var immutableFields = map[string][]string{
+	"apps Deployment":  {"spec.selector"},
+	"apps ReplicaSet":  {"spec.selector"},
+	"apps DaemonSet":   {"spec.selector"},
+	"apps StatefulSet": {"spec.selector", "spec.serviceName", "spec.podManagementPolicy", "spec.volumeClaimTemplates"},
+	"batch Job":        {"spec.selector", "spec.template", "spec.completionMode"},
+	" Service":         {"spec.clusterIP"},
+	" PersistentVolumeClaim": {
+		"spec.accessModes", "spec.storageClassName", "spec.volumeName", "spec.volumeMode", "spec.selector",
+	},
+	"rbac.authorization.k8s.io RoleBinding":        {"roleRef"},
+	"rbac.authorization.k8s.io ClusterRoleBinding": {"roleRef"},
+}
+
+// upgradeKey identifies a resource across API versions, since a release may move a resource to a newer version.
+// Generated ConfigMaps and Secrets are identified without the content hash in their name, like in
+// normalizeGeneratedNames, since a change to their params renames them.
+func upgradeKey(r *builtResource) string {
+	name := r.name
+	if r.kind == "ConfigMap" || r.kind == "Secret" {
+		name = generatorHash.ReplaceAllString(name, "-<hash>")
+	}
+	return fmt.Sprintf("%v %v %v/%v", r.group, r.kind, r.namespace, name)
+}
+
+// checkUpgrade returns a message, sorted, for every change from the build of a deployment option at a previous
+// release, base, to its build at head that breaks applying head over base:
+//   - a change to one of the immutableFields of a resource
+//   - a CustomResourceDefinition that is removed, or a version that it no longer defines, which the custom
+//     resources of the cluster may still be stored in
+//   - a resource that is removed, which kubectl apply leaves in the cluster. If head adds resources of the same
+//     kind and namespace the resource was likely renamed, and they are named as candidates.
+func checkUpgrade(base []*builtResource, head []*builtResource) ([]string, error) {
+	headByKey := map[string]*builtResource{}
+	for _, r := range head {
+		headByKey[upgradeKey(r)] = r
+	}
+	baseByKey := map[string]*builtResource{}
+	for _, r := range base {
+		baseByKey[upgradeKey(r)] = r
+	}
+	// added holds the resources of head that aren't in base by group, kind and namespace
+	added := map[string][]string{}
+	for _, r := range head {
+		if _, ok := baseByKey[upgradeKey(r)]; !ok {
+			kind := fmt.Sprintf("%v %v %v", r.group, r.kind, r.namespace)
+			added[kind] = append(added[kind], r.Key())
+		}
+	}
+
+	var messages []string
+	for _, b := range base {
+		h, ok := headByKey[upgradeKey(b)]
+		if !ok {
+			if b.group == "apiextensions.k8s.io" && b.kind == "CustomResourceDefinition" {
+				messages = append(messages, fmt.Sprintf("Resource %v is removed, which deletes its custom resources if it is pruned and leaves them without an API otherwise",
+					b.Key()))
+				continue
+			}
+			message := fmt.Sprintf("Resource %v is removed, which kubectl apply leaves in the cluster", b.Key())
+			if candidates := added[fmt.Sprintf("%v %v %v", b.group, b.kind, b.namespace)]; len(candidates) > 0 {
+				sort.Strings(candidates)
+				message += fmt.Sprintf("; if it was renamed to %v, delete it on upgrade", strings.Join(candidates, " or "))
+			}
+			messages = append(messages, message)
+			continue
+		}
+
+		var baseObject, headObject map[string]interface{}
+		if err := yaml.Unmarshal(b.yaml, &baseObject); err != nil {
+			return nil, fmt.Errorf("could not parse resource %v; error: %v", b.Key(), err)
+		}
+		if err := yaml.Unmarshal(h.yaml, &headObject); err != nil {
+			return nil, fmt.Errorf("could not parse resource %v; error: %v", h.Key(), err)
+		}
+		for _, field := range immutableFields[b.group+" "+b.kind] {
+			path := strings.Split(field, ".")
+			changed := diffPaths(field, nested(headObject, path...), nested(baseObject, path...))
+			if len(changed) > 0 {
+				messages = append(messages, fmt.Sprintf("Resource %v changes the immutable field %v at %v, so it has to be deleted on upgrade",
+					h.Key(), field, strings.Join(changed, ", ")))
+			}
+		}
+		if b.group == "apiextensions.k8s.io" && b.kind == "CustomResourceDefinition" {
+			headVersions := crdVersions(headObject)
+			for _, v := range crdVersions(baseObject) {
+				if !contains(headVersions, v) {
+					messages = append(messages, fmt.Sprintf("Resource %v removes version %v, in which custom resources of the cluster may still be stored",
+						h.Key(), v))
+				}
+			}
+		}
+	}
+	sort.Strings(messages)
+	return messages, nil
+}
+
+// crdVersions returns the versions a CustomResourceDefinition defines in spec.versions, or in spec.version of
+// apiextensions.k8s.io/v1beta1
+func crdVersions(crd map[string]interface{}) []string {
+	var versions []string
+	if v, ok := nested(crd, "spec", "version").(string); ok && v != "" {
+		versions = append(versions, v)
+	}
+	list, _ := nested(crd, "spec", "versions").([]interface{})
+	for _, e := range list {
+		version, _ := e.(map[string]interface{})
+		if name, ok := version["name"].(string); ok && !contains(versions, name) {
+			versions = append(versions, name)
+		}
+	}
+	return versions
+}
+
+// addWorktree checks out ref of the git repository at repoRoot into a temporary worktree and returns its path
+// and a function that removes it. The UpstreamDir isn't tracked, see cloneUpstream.
+func addWorktree(repoRoot string, ref string) (string, func(), error) {
+	root, err := filepath.Abs(repoRoot)
+	if err != nil {
+		return "", nil, err
+	}
+	dir, err := ioutil.TempDir("", "upgrade")
+	if err != nil {
+		return "", nil, err
+	}
+	worktree := filepath.Join(dir, "manifests")
+	git := func(args ...string) error {
+		out, err := exec.Command("git", append([]string{"-C", root}, args...)...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("git %v failed; error: %v\n%s", strings.Join(args, " "), err, out)
+		}
+		return nil
+	}
+	remove := func() {
+		git("worktree", "remove", "--force", worktree)
+		os.RemoveAll(dir)
+	}
+	if err := git("worktree", "add", "--detach", worktree, ref); err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+	return worktree, remove, nil
+}
+
+// cloneUpstream clones the kubeflow/manifests release that the revision checked out in worktree is built on into
+// its UpstreamDir, with the upstream target of its own Makefile. KUBEFLOW_RELEASE_VERSION is removed from the
+// environment so that the release the revision pins is cloned.
+func cloneUpstream(worktree string) error {
+	dir := filepath.Join(worktree, "tests", "unit-tests")
+	makefile, err := ioutil.ReadFile(filepath.Join(dir, "Makefile"))
+	if err != nil {
+		return err
+	}
+	if !regexp.MustCompile(`(?m)^upstream:`).Match(makefile) {
+		return fmt.Errorf("%v has no upstream target to clone kubeflow/manifests with", filepath.Join(dir, "Makefile"))
+	}
+	cmd := exec.Command("make", "-C", dir, "upstream")
+	for _, env := range os.Environ() {
+		if !strings.HasPrefix(env, "KUBEFLOW_RELEASE_VERSION=") {
+			cmd.Env = append(cmd.Env, env)
+		}
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("make upstream failed; error: %v\n%s", err, out)
+	}
+	return nil
+}
+
+// buildUpgradeBase builds the deployment option at rpath of the worktree with the params fixtures of fixtureDir,
+// the same the working tree is built with. Fixtures of a params.env that the base revision doesn't have yet are
+// skipped.
+func buildUpgradeBase(worktree string, rpath string, fixtureDir string) ([]*builtResource, error) {
+	fSys, err := newParamsFs(worktree, fixtureDir, true)
+	if err != nil {
+		return nil, err
+	}
+	return buildKrustyFs(fSys, filepath.Join(worktree, rpath))
+}
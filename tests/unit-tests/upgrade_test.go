@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestUpgradeSafety builds each of the DeploymentOptions at the revision set with -base-ref or BASE_REF, in a
+// temporary git worktree with the kubeflow/manifests release of that revision, and at the working tree, and fails
+// on every change that breaks upgrading from the base, see checkUpgrade. Both are built with the fixtures of
+// ParamsFixtureDir. It is skipped unless a base revision is set.
+func TestUpgradeSafety(t *testing.T) {
+	ref := upgradeBaseRef()
+	if ref == "" {
+		t.Skip("Set -base-ref or BASE_REF to the revision of a previous release to check upgrades from it")
+	}
+	skipWithoutUpstream(t, "Deployment options")
+
+	worktree, remove, err := addWorktree(RepoRoot, ref)
+	if err != nil {
+		t.Fatalf("Could not check out %v; error: %v", ref, err)
+	}
+	defer remove()
+	if err := cloneUpstream(worktree); err != nil {
+		t.Fatalf("Could not clone kubeflow/manifests for %v; error: %v", ref, err)
+	}
+
+	fixtureDir := filepath.Join(unitTestsDir(), ParamsFixtureDir)
+	for _, rpath := range DeploymentOptions {
+		rpath := rpath
+		t.Run(rpath, func(t *testing.T) {
+			if !dirExists(filepath.Join(worktree, rpath)) {
+				t.Skipf("%v doesn't exist at %v", rpath, ref)
+			}
+			base, err := buildUpgradeBase(worktree, rpath, fixtureDir)
+			if err != nil {
+				t.Fatalf("Could not build %v at %v; error: %v", rpath, ref, err)
+			}
+			head, err := buildDeployment(RepoRoot, rpath, fixtureDir)
+			if err != nil {
+				t.Fatalf("Could not build %v; error: %v", rpath, err)
+			}
+
+			messages, err := checkUpgrade(base, head)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, m := range messages {
+				t.Error(m)
+			}
+		})
+	}
+}
+
+func TestCheckUpgrade(t *testing.T) {
+	base := []*builtResource{
+		newBuiltResource("apps", "v1", "Deployment", "kubeflow", "controller", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: controller
+  namespace: kubeflow
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: controller
+`)),
+		newBuiltResource("", "v1", "Service", "kubeflow", "controller", []byte(`apiVersion: v1
+kind: Service
+metadata:
+  name: controller
+  namespace: kubeflow
+spec:
+  ports:
+  - port: 80
+`)),
+		newBuiltResource("", "v1", "ConfigMap", "kubeflow", "config-abc", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config-abc
+  namespace: kubeflow
+`)),
+		newBuiltResource("apiextensions.k8s.io", "v1", "CustomResourceDefinition", "", "notebooks.kubeflow.org", []byte(`apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: notebooks.kubeflow.org
+spec:
+  versions:
+  - name: v1alpha1
+  - name: v1
+`)),
+		newBuiltResource("apiextensions.k8s.io", "v1beta1", "CustomResourceDefinition", "", "viewers.kubeflow.org", []byte(`apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: viewers.kubeflow.org
+spec:
+  version: v1beta1
+`)),
+	}
+	head := []*builtResource{
+		newBuiltResource("apps", "v1", "Deployment", "kubeflow", "controller", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: controller
+  namespace: kubeflow
+spec:
+  replicas: 2
+  selector:
+    matchLabels:
+      app: controller
+      app.kubernetes.io/version: v1.7.0
+`)),
+		newBuiltResource("", "v1", "Service", "kubeflow", "controller", []byte(`apiVersion: v1
+kind: Service
+metadata:
+  name: controller
+  namespace: kubeflow
+spec:
+  clusterIP: None
+  ports:
+  - port: 80
+`)),
+		newBuiltResource("", "v1", "ConfigMap", "kubeflow", "config-def", []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config-def
+  namespace: kubeflow
+`)),
+		newBuiltResource("apiextensions.k8s.io", "v1", "CustomResourceDefinition", "", "notebooks.kubeflow.org", []byte(`apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: notebooks.kubeflow.org
+spec:
+  versions:
+  - name: v1
+`)),
+	}
+
+	expected := []string{
+		"Resource apiextensions.k8s.io/v1 CustomResourceDefinition notebooks.kubeflow.org removes version v1alpha1, in which custom resources of the cluster may still be stored",
+		"Resource apiextensions.k8s.io/v1beta1 CustomResourceDefinition viewers.kubeflow.org is removed, which deletes its custom resources if it is pruned and leaves them without an API otherwise",
+		"Resource apps/v1 Deployment kubeflow/controller changes the immutable field spec.selector at spec.selector.matchLabels[\"app.kubernetes.io/version\"], so it has to be deleted on upgrade",
+		"Resource v1 ConfigMap kubeflow/config-abc is removed, which kubectl apply leaves in the cluster; if it was renamed to v1 ConfigMap kubeflow/config-def, delete it on upgrade",
+		"Resource v1 Service kubeflow/controller changes the immutable field spec.clusterIP at spec.clusterIP, so it has to be deleted on upgrade",
+	}
+	actual, err := checkUpgrade(base, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got messages\n%v\nwant\n%v", strings.Join(actual, "\n"), strings.Join(expected, "\n"))
+	}
+
+	if actual, err := checkUpgrade(head, head); err != nil || len(actual) > 0 {
+		t.Errorf("got messages %v, error %v for an unchanged build; want none", actual, err)
+	}
+}
+
+func TestCheckUpgradeGeneratedNames(t *testing.T) {
+	configMap := func(name string, value string) *builtResource {
+		return newBuiltResource("", "v1", "ConfigMap", "kubeflow", name, []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: `+name+`
+  namespace: kubeflow
+data:
+  value: `+value+`
+`))
+	}
+
+	// A change to the params of a configMapGenerator only changes the hash in the name of the ConfigMap
+	base := []*builtResource{configMap("pipeline-install-config-9t8hf2k7bm", "a")}
+	head := []*builtResource{configMap("pipeline-install-config-6g4k8mt2dc", "b")}
+	if actual, err := checkUpgrade(base, head); err != nil || len(actual) > 0 {
+		t.Errorf("got messages %v, error %v for a changed generator input; want none", actual, err)
+	}
+
+	// Renaming the generator still removes the ConfigMap
+	head = []*builtResource{configMap("pipeline-config-6g4k8mt2dc", "a")}
+	expected := []string{
+		"Resource v1 ConfigMap kubeflow/pipeline-install-config-9t8hf2k7bm is removed, which kubectl apply leaves in the cluster; if it was renamed to v1 ConfigMap kubeflow/pipeline-config-6g4k8mt2dc, delete it on upgrade",
+	}
+	actual, err := checkUpgrade(base, head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got messages\n%v\nwant\n%v", strings.Join(actual, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestAddWorktree(t *testing.T) {
+	worktree, remove, err := addWorktree(RepoRoot, "HEAD")
+	if err != nil {
+		t.Fatalf("Could not check out HEAD; error: %v", err)
+	}
+	defer remove()
+	for _, rpath := range DeploymentOptions {
+		if !fileExists(filepath.Join(worktree, rpath, "kustomization.yaml")) {
+			t.Errorf("%v isn't checked out in %v", rpath, worktree)
+		}
+	}
+}
@@ -1,51 +1,37 @@
 package tests
 
 import (
-	"bytes"
-	"io/ioutil"
-	"os"
-	"path/filepath"
+	"fmt"
 	"strings"
 	"testing"
 
-	"github.com/ghodss/yaml"
-	"sigs.k8s.io/kustomize/kyaml/kio"
+	"github.com/kubeflow/manifests/tests/manifests"
 	kyaml "sigs.k8s.io/kustomize/kyaml/yaml"
-	"sigs.k8s.io/kustomize/v3/pkg/types"
 )
 
 const (
-	VersionLabel      = "app.kubernetes.io/version"
-	InstanceLabel     = "app.kubernetes.io/instance"
-	ManagedByLabel    = "app.kubernetes.io/managed-by"
-	PartOfLabel       = "app.kubernetes.io/part-of"
-	KustomizationFile = "kustomization.yaml"
+	VersionLabel   = "app.kubernetes.io/version"
+	InstanceLabel  = "app.kubernetes.io/instance"
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	PartOfLabel    = "app.kubernetes.io/part-of"
 )
 
-// readKustomization will read a kustomization.yaml and return the kustomize object
-func readKustomization(kfDefFile string) (*types.Kustomization, error) {
-	data, err := ioutil.ReadFile(kfDefFile)
-	if err != nil {
-		return nil, err
-	}
-	def := &types.Kustomization{}
-	if err = yaml.Unmarshal(data, def); err != nil {
-		return nil, err
-	}
-	return def, nil
+func init() {
+	RegisterRule(NewRule("common-labels-immutable", "kustomizations don't set mutable labels in commonLabels", SeverityError, checkCommonLabelsImmutable))
+	RegisterRule(NewRule("valid-resources", "resources have no status, no empty annotations and no removed API", SeverityError, checkValidK8sResource))
+	RegisterRule(NewRule("webhook-audit", "webhooks on pods have a selector, fail open or skip kube-system and set a timeout", SeverityError, checkWebhookAudit))
+	RegisterRule(NewRule("obsolete-kustomization", "kustomizations don't use obsolete syntax", SeverityError, checkObsoleteKustomization))
 }
 
-// TestCommonLabelsImmutable is a test to try to ensure we don't have mutable labels which will
+// checkCommonLabelsImmutable is a rule to try to ensure we don't have mutable labels which will
 // cause problems on upgrades per https://github.com/kubeflow/manifests/issues/1131.
-func TestCommonLabelsImmutable(t *testing.T) {
-	rootDir := ".."
-
-	// Directories to exclude. Thee paths should be relative to rootDir.
-	// Subdirectories won't be searched
-	excludes := map[string]bool{
-		"tests":   true,
-		".git":    true,
-		".github": true,
+func checkCommonLabelsImmutable(doc *manifests.Document) ([]Finding, error) {
+	if !doc.IsKustomization() {
+		return nil, nil
+	}
+	commonLabels := doc.Node.Field("commonLabels")
+	if commonLabels.IsNilOrEmpty() {
+		return nil, nil
 	}
 
 	// These labels are likely to be mutable and should not be part of commonLabels
@@ -55,367 +41,219 @@ func TestCommonLabelsImmutable(t *testing.T) {
 	// and allow applications to start using these labels but in an immutable fashion.
 	forbiddenLabels := []string{VersionLabel, ManagedByLabel, InstanceLabel, PartOfLabel}
 
-	err := filepath.Walk("..", func(path string, info os.FileInfo, err error) error {
-		relPath, err := filepath.Rel(rootDir, path)
-
-		if err != nil {
-			t.Fatalf("Could not compute relative path(%v, %v); error: %v", rootDir, path, err)
-		}
-
-		if _, ok := excludes[relPath]; ok {
-			t.Logf("Skipping directory %v", path)
-			return filepath.SkipDir
-		}
-
-		// skip directories
-		if info.IsDir() {
-			return nil
-		}
-
-		if info.Name() != KustomizationFile {
-			return nil
-		}
-
-		k, err := readKustomization(path)
-
-		if err != nil {
-			t.Errorf("Error reading file: %v; error: %v", path, err)
-			return nil
-		}
-
-		if k.CommonLabels == nil {
-			return nil
-		}
-
-		for _, l := range forbiddenLabels {
-			if _, ok := k.CommonLabels[l]; ok {
-				t.Errorf("%v has forbidden commonLabel %v", path, l)
-			}
+	var findings []Finding
+	for _, l := range forbiddenLabels {
+		if f := commonLabels.Value.Field(l); f != nil {
+			findings = append(findings, Finding{
+				Line:    f.Key.YNode().Line,
+				Message: fmt.Sprintf("has forbidden commonLabel %v", l),
+			})
 		}
-		return nil
-	})
-
-	if err != nil {
-		t.Errorf("error walking the path %v; error: %v", rootDir, err)
 	}
+	return findings, nil
 }
 
-// deprecatedK8s represents a K8s resource that should be replaced by a new type.
-type deprecatedK8s struct {
-	oldVersion string
-	oldKind    string
-	newVersion string
-	newKind    string
-}
-
-func versionAndKind(version string, kind string) string {
-	return version + "/" + kind
-}
-
-// TestValidK8sResources reads all the K8s resources and performs a bunch of validation checks.
+// checkValidK8sResource performs a bunch of validation checks on a K8s resource.
 //
 // Currently the following checks are performed:
-//  i) ensure we don't include status in resources
-//     as this causes validation issues: https://github.com/kubeflow/manifests/issues/1174
 //
-//  ii) ensure that if annotations are present it is not empty.
-//  Having empty annotations https://github.com/GoogleContainerTools/kpt/issues/541 causes problems for kpt and
-//  ACM.  Offending YAML looks like
-//      metadata:
-// 		 name: kf-admin-iap
-//       annotations:
-//      rules:
-//        ...
-func TestValidK8sResources(t *testing.T) {
-	rootDir := ".."
-
-	// Directories to exclude. Thee paths should be relative to rootDir.
-	// Subdirectories won't be searched
-	excludes := map[string]bool{
-		"tests":                  true,
-		".git":                   true,
-		".github":                true,
-		"profiles/overlays/test": true,
-		// Skip cnrm-install. We don't install this with ACM so we don't need to fix it.
-		// It seems like if this is an issue it should eventually get fixed in upstream cnrm configs.
-		// The CNRM directory has lots of CRDS with non empty status.
-		"distributions/gcp/v2/management/cnrm-install": true,
+//	 i) ensure we don't include status in resources
+//	    as this causes validation issues: https://github.com/kubeflow/manifests/issues/1174
+//
+//	 ii) ensure that if annotations are present it is not empty.
+//	 Having empty annotations https://github.com/GoogleContainerTools/kpt/issues/541 causes problems for kpt and
+//	 ACM.  Offending YAML looks like
+//	     metadata:
+//			 name: kf-admin-iap
+//	      annotations:
+//	     rules:
+//	       ...
+//
+//	 iii) ensure resources don't use an API that is removed in a target version; see deprecated_apis.yaml
+func checkValidK8sResource(doc *manifests.Document) ([]Finding, error) {
+	m, err := doc.Node.GetMeta()
+	// Skip objects with no metadata
+	if err != nil {
+		return nil, nil
 	}
 
-	deprecated := []deprecatedK8s{
-		{
-			oldVersion: "extensions/v1beta1",
-			oldKind:    "Ingress",
-			newVersion: "networking.k8s.io/v1beta1",
-			newKind:    "Ingress",
-		},
-		{
-			oldVersion: "extensions/v1beta1",
-			oldKind:    "Deployment",
-			newVersion: "apps/v1",
-			newKind:    "Deployment",
-		},
+	// Skip Kustomization
+	if strings.ToLower(m.Kind) == "kustomization" {
+		return nil, nil
 	}
-
-	deprecatedMap := map[string]string{}
-
-	for _, d := range deprecated {
-		deprecatedMap[versionAndKind(d.oldVersion, d.oldKind)] = versionAndKind(d.newVersion, d.newKind)
+	if m.Name == "" || m.Kind == "" {
+		return nil, nil
 	}
 
-	err := filepath.Walk("..", func(path string, info os.FileInfo, err error) error {
-		relPath, err := filepath.Rel(rootDir, path)
-
-		if err != nil {
-			t.Fatalf("Could not compute relative path(%v, %v); error: %v", rootDir, path, err)
-		}
-
-		if _, ok := excludes[relPath]; ok {
-			return filepath.SkipDir
-		}
-
-		// skip directories
-		if info.IsDir() {
-			return nil
-		}
-
-		// Skip non YAML files
-		ext := filepath.Ext(info.Name())
-
-		if ext != ".yaml" && ext != ".yml" {
-			return nil
-		}
-		data, err := ioutil.ReadFile(path)
-
-		if err != nil {
-			t.Errorf("Error reading %v; error: %v", path, err)
-		}
+	catalog, err := loadDefaultAPICatalog()
+	if err != nil {
+		return nil, fmt.Errorf("could not load %v; error: %v", DeprecatedAPIsFile, err)
+	}
 
-		input := bytes.NewReader(data)
-		reader := kio.ByteReader{
-			Reader: input,
-			// We need to disable adding reader annotations because
-			// we want to run some checks about whether annotations are set and
-			// adding those annotations interferes with that.
-			OmitReaderAnnotations: true,
-		}
+	var findings []Finding
+	// Check if it uses a removed or deprecated API, see deprecated_apis.yaml
+	removed, deprecated := catalog.check(m.APIVersion, m.Kind)
+	if removed != "" {
+		findings = append(findings, Finding{Message: fmt.Sprintf("resource %v; %v", m.Name, removed)})
+	}
+	if deprecated != "" {
+		findings = append(findings, Finding{Message: fmt.Sprintf("resource %v; %v", m.Name, deprecated), Severity: SeverityWarning})
+	}
 
-		nodes, err := reader.Read()
+	// Ensure status isn't set
+	if f := doc.Node.Field("status"); !f.IsNilOrEmpty() {
+		findings = append(findings, Finding{
+			Line:    f.Key.YNode().Line,
+			Message: fmt.Sprintf("resource %v; has status field", m.Name),
+		})
+	}
 
-		if err != nil {
-			t.Errorf("Error unmarshaling %v; error: %v", path, err)
+	if metadata := doc.Node.Field("metadata"); metadata != nil {
+		if annotations := metadata.Value.Field("annotations"); annotations != nil && annotations.IsNilOrEmpty() {
+			findings = append(findings, Finding{
+				Line:    annotations.Key.YNode().Line,
+				Message: fmt.Sprintf("resource %v; has empty annotations; if no annotations are present the field shouldn't be present", m.Name),
+			})
 		}
+	}
+	return findings, nil
+}
 
-		for _, n := range nodes {
-			//root := n
-
-			m, err := n.GetMeta()
-			// Skip objects with no metadata
-			if err != nil {
-				continue
-			}
-
-			// Skip Kustomization
-			if strings.ToLower(m.Kind) == "kustomization" {
-				continue
-			}
-			if m.Name == "" || m.Kind == "" {
-				continue
-			}
-
-			// Check if its a deprecated K8s resource
-			vAndK := versionAndKind(m.APIVersion, m.Kind)
-			if v, ok := deprecatedMap[vAndK]; ok {
-				t.Errorf("Path %v; resource %v; has version and kind %v which should be changed to %v", path, m.Name, vAndK, v)
-			}
-
-			// Ensure status isn't set
-			f := n.Field("status")
-
-			if !kyaml.IsFieldEmpty(f) {
-				t.Errorf("Path %v; resource %v; has status field", path, m.Name)
-			}
-
-			metadata := n.Field("metadata")
-
-			checkEmptyAnnotations := func() {
-				annotations := metadata.Value.Field("annotations")
-
-				if annotations == nil {
-					return
-				}
+// kubeSystemLabels are the labels of the kube-system namespace, which namespaceSelectors are evaluated against
+var kubeSystemLabels = map[string]string{"kubernetes.io/metadata.name": "kube-system"}
 
-				if kyaml.IsFieldEmpty(annotations) {
-					t.Errorf("Path %v; resource %v; has empty annotations; if no annotations are present the field shouldn't be present", path, m.Name)
-					return
-				}
-			}
+// checkWebhookAudit is a rule for the webhooks of MutatingWebhookConfigurations and ValidatingWebhookConfigurations:
+//   - webhooks on pods have either namespaceSelector or objectSelector to avoid issues per
+//     https://github.com/kubeflow/manifests/issues/1213.
+//   - webhooks that fail closed don't intercept kube-system, where a webhook that is down keeps the cluster from
+//     recovering. This is a warning.
+//   - webhooks set timeoutSeconds instead of holding up requests for the default timeout. This is a warning.
+//
+// The Services and Certificates of the webhooks are resolved in builds, see checkWebhookReferences.
+func checkWebhookAudit(doc *manifests.Document) ([]Finding, error) {
+	m, err := doc.Node.GetMeta()
+	// Skip objects with no metadata
+	if err != nil {
+		return nil, nil
+	}
 
-			checkEmptyAnnotations()
-		}
-		return nil
-	})
+	// Skip objects with no name and objects that aren't webhook configurations
+	if m.Name == "" || !isWebhookConfiguration(m.Kind) {
+		return nil, nil
+	}
 
+	webhooks := doc.Node.Field("webhooks")
+	if webhooks == nil {
+		return nil, nil
+	}
+	webhookElements, err := webhooks.Value.Elements()
+	// Skip webhooks with no element
 	if err != nil {
-		t.Errorf("error walking the path %v; error: %v", rootDir, err)
+		return nil, nil
 	}
-}
 
-// TestCheckWebhookSelector is a test to try to ensure all the mutating webhooks
-// have either namespaceSeletor or objectSelector to avoid issues per
-// https://github.com/kubeflow/manifests/issues/1213.
-func TestCheckWebhookSelector(t *testing.T) {
-	rootDir := ".."
-
-	// Directories to exclude. Thee paths should be relative to rootDir.
-	// Subdirectories won't be searched
-	excludes := map[string]bool{
-		"tests":   true,
-		".git":    true,
-		".github": true,
+	// admissionregistration.k8s.io/v1beta1 defaults to failurePolicy: Ignore and 30s, v1 to Fail and 10s
+	defaultPolicy, defaultTimeout := "Fail", 10
+	if m.APIVersion == admissionGroup+"/v1beta1" {
+		defaultPolicy, defaultTimeout = "Ignore", 30
 	}
 
-	err := filepath.Walk("..", func(path string, info os.FileInfo, err error) error {
-		relPath, err := filepath.Rel(rootDir, path)
-
-		if err != nil {
-			t.Fatalf("Could not compute relative path(%v, %v); error: %v", rootDir, path, err)
+	var findings []Finding
+	for _, w := range webhookElements {
+		name := ""
+		if n := w.Field("name"); n != nil {
+			name = n.Value.YNode().Value
 		}
+		findings = append(findings, checkWebhookPodSelector(w, name, m.Kind, m.Name)...)
 
-		if _, ok := excludes[relPath]; ok {
-			return filepath.SkipDir
+		policy, line := defaultPolicy, w.YNode().Line
+		if f := w.Field("failurePolicy"); f != nil {
+			policy, line = f.Value.YNode().Value, f.Key.YNode().Line
 		}
-
-		// skip directories
-		if info.IsDir() {
-			return nil
+		selector := &labelSelector{}
+		if f := w.Field("namespaceSelector"); f != nil {
+			if err := f.Value.YNode().Decode(selector); err != nil {
+				return nil, err
+			}
 		}
-
-		// Skip non YAML files
-		ext := filepath.Ext(info.Name())
-
-		if ext != ".yaml" && ext != ".yml" {
-			return nil
+		if policy == "Fail" && selector.matches(kubeSystemLabels) {
+			findings = append(findings, Finding{
+				Line:     line,
+				Severity: SeverityWarning,
+				Message: fmt.Sprintf("webhook %v of %v %v fails closed and intercepts kube-system; exclude kube-system with a namespaceSelector or set failurePolicy: Ignore",
+					name, m.Kind, m.Name),
+			})
 		}
-		data, err := ioutil.ReadFile(path)
 
-		if err != nil {
-			t.Errorf("Error reading %v; error: %v", path, err)
+		if w.Field("timeoutSeconds") == nil {
+			findings = append(findings, Finding{
+				Line:     w.YNode().Line,
+				Severity: SeverityWarning,
+				Message: fmt.Sprintf("webhook %v of %v %v has no timeoutSeconds, so the requests it intercepts can wait for the default of %ds",
+					name, m.Kind, m.Name, defaultTimeout),
+			})
 		}
+	}
+	return findings, nil
+}
 
-		input := bytes.NewReader(data)
-		reader := kio.ByteReader{
-			Reader: input,
+// checkWebhookPodSelector returns a finding for every rule of a webhook without namespaceSelector or objectSelector
+// that intercepts pods
+func checkWebhookPodSelector(w *kyaml.RNode, name string, kind string, configuration string) []Finding {
+	if !w.Field("namespaceSelector").IsNilOrEmpty() || !w.Field("objectSelector").IsNilOrEmpty() {
+		return nil
+	}
+	// If there's no objectSelector or namespaceSelector, make sure the webhook doesn't
+	// have any rule for pods.
+	rules := w.Field("rules")
+	if rules == nil {
+		return nil
+	}
+	ruleElements, err := rules.Value.Elements()
+	if err != nil {
+		return nil
+	}
+	var findings []Finding
+	for _, rule := range ruleElements {
+		resources := rule.Field("resources")
+		if resources == nil {
+			continue
 		}
-
-		nodes, err := reader.Read()
-
+		resourceElements, err := resources.Value.Elements()
 		if err != nil {
-			if strings.Contains(err.Error(), "wrong Node Kind for") {
-				t.Logf("Skipping non SequenceNode yaml %v", path)
-				return nil
-			}
-			t.Errorf("Error unmarshaling %v; error: %v", path, err)
+			continue
 		}
-
-		for _, n := range nodes {
-			//root := n
-
-			m, err := n.GetMeta()
-			// Skip objects with no metadata
-			if err != nil {
-				continue
-			}
-
-			// Skip objects with no name or kind
-			if m.Name == "" || m.Kind == "" {
-				continue
-			}
-
-			// Skip non-mutating webhook files
-			if strings.ToLower(m.Kind) != "mutatingwebhookconfiguration" {
-				continue
-			}
-
-			// Ensure objectSelector or namespaceSelector is set for pod resource
-			if webhooks := n.Field("webhooks"); webhooks != nil {
-				webhookElements, err := webhooks.Value.Elements()
-				// Skip webhooks with no element
-				if err != nil {
-					continue
-				}
-				for _, w := range webhookElements {
-					if kyaml.IsFieldEmpty(w.Field("namespaceSelector")) && kyaml.IsFieldEmpty(w.Field("objectSelector")) {
-						// If there's no objectSelector or namespaceSelector, make sure the mutating webhook doesn't
-						// have any rule for pods.
-						if rules := w.Field("rules"); rules != nil {
-							ruleElements, err := rules.Value.Elements()
-							if err != nil {
-								continue
-							}
-							for _, rule := range ruleElements {
-								if resources := rule.Field("resources"); resources != nil {
-									resourceElements, err := resources.Value.Elements()
-									if err != nil {
-										continue
-									}
-									for _, resource := range resourceElements {
-										resourceString, err := resource.String()
-										if err != nil {
-											continue
-										}
-										if strings.TrimSpace(resourceString) == "pods" || strings.TrimSpace(resourceString) == "*" {
-											t.Errorf("Path %v; resource %v; does not have objectSelector or namespaceSelector is for mutating webhook on pods", path, m.Name)
-										}
-									}
-								}
-							}
-						}
-					}
-				}
+		for _, resource := range resourceElements {
+			resourceString := strings.TrimSpace(resource.YNode().Value)
+			if resourceString == "pods" || resourceString == "*" {
+				findings = append(findings, Finding{
+					Line:    resource.YNode().Line,
+					Message: fmt.Sprintf("webhook %v of %v %v intercepts pods but has no objectSelector or namespaceSelector", name, kind, configuration),
+				})
 			}
 		}
-		return nil
-	})
+	}
+	return findings
+}
 
-	if err != nil {
-		t.Errorf("error walking the path %v; error: %v", rootDir, err)
+// checkObsoleteKustomization is a rule to ensure kustomization files aren't using deprecated/obsolete features,
+// see findObsoleteFields
+func checkObsoleteKustomization(doc *manifests.Document) ([]Finding, error) {
+	if !doc.IsKustomization() {
+		return nil, nil
 	}
+	return findObsoleteFields(doc.Node.YNode()), nil
 }
 
 // kustomizationHasDeprecatedEnv checks if the node has the depracted format of configmap generator
 // see https://github.com/kubeflow/manifests/issues/538
-func kustomizationHasDeprecatedEnv(t *testing.T, n *kyaml.RNode) bool {
-	configMaps, err := n.Pipe(kyaml.Lookup("configMapGenerator"))
-	if err != nil {
-		s, _ := n.String()
-		t.Errorf("%v: %s", err, s)
-		return false
-	}
-
-	if configMaps == nil {
-		// doesn't have any configmap generators, skip the Resource
-		return false
-	}
-
-	// visit each container and apply the cpu and memory reservations
-
-	hasDeprecated := false
-	err = configMaps.VisitElements(func(cm *kyaml.RNode) error {
-		// Ensure env field isn't set
-		f := cm.Field("env")
-
-		if !kyaml.IsFieldEmpty(f) {
-			hasDeprecated = true
+func kustomizationHasDeprecatedEnv(n *kyaml.RNode) (bool, error) {
+	for _, f := range findObsoleteFields(n.YNode()) {
+		if f.Severity == SeverityError {
+			return true, nil
 		}
-		return nil
-	})
-
-	if err != nil {
-		t.Errorf("Error chcecking if deprecated envs are set; error %v", err)
 	}
-
-	return hasDeprecated
+	return false, nil
 }
 
 // TestKustomizationHasDeprecatedEnv verifies that kustomizationHasDeprecatedEnv correctly
@@ -461,7 +299,12 @@ configMapGenerator:
 			continue
 		}
 
-		actual := kustomizationHasDeprecatedEnv(t, n)
+		actual, err := kustomizationHasDeprecatedEnv(n)
+
+		if err != nil {
+			t.Errorf("Could not check yaml:\n%v\nerror: %v", c.Raw, err)
+			continue
+		}
 
 		if actual != c.Expected {
 			t.Errorf("got %v; want %v; YAML\n:%v", actual, c.Expected, c.Raw)
@@ -469,87 +312,58 @@ configMapGenerator:
 	}
 }
 
-// TestNoObsoleteKustomizations verifies that all kustomization files aren't using
-// deprecated/obsolete features
-func TestNoObsoleteKustomizations(t *testing.T) {
-	rootDir := ".."
-
-	// Directories to exclude. Thee paths should be relative to rootDir.
-	// Subdirectories won't be searched
-	excludes := map[string]bool{
-		"tests":                  true,
-		".git":                   true,
-		".github":                true,
-		"profiles/overlays/test": true,
-		// Skip cnrm-install. We don't install this with ACM so we don't need to fix it.
-		// It seems like if this is an issue it should eventually get fixed in upstream cnrm configs.
-		// The CNRM directory has lots of CRDS with non empty status.
-		"distributions/gcp/v2/management/cnrm-install": true,
+// TestCheckWebhookAudit verifies the findings of checkWebhookAudit for mutating and validating webhooks
+func TestCheckWebhookAudit(t *testing.T) {
+	raw := `apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingWebhookConfiguration
+metadata:
+  name: webhook
+webhooks:
+- name: pods
+  rules:
+  - resources: [pods]
+  failurePolicy: Ignore
+  timeoutSeconds: 5
+- name: kube-system
+  namespaceSelector:
+    matchExpressions:
+    - key: control-plane
+      operator: DoesNotExist
+  failurePolicy: Fail
+  timeoutSeconds: 5
+- name: excluded
+  namespaceSelector:
+    matchExpressions:
+    - key: kubernetes.io/metadata.name
+      operator: NotIn
+      values: [kube-system]
+  timeoutSeconds: 5
+- name: default
+  objectSelector:
+    matchLabels:
+      app: webhook
+`
+	n, err := kyaml.Parse(raw)
+	if err != nil {
+		t.Fatalf("Could not parse yaml:\n%v\nerror: %v", raw, err)
+	}
+	actual, err := checkWebhookAudit(&manifests.Document{Path: "webhook.yaml", Line: 1, Node: n})
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	err := filepath.Walk("..", func(path string, info os.FileInfo, err error) error {
-		relPath, err := filepath.Rel(rootDir, path)
-
-		if err != nil {
-			t.Fatalf("Could not compute relative path(%v, %v); error: %v", rootDir, path, err)
-		}
-
-		if _, ok := excludes[relPath]; ok {
-			return filepath.SkipDir
-		}
-
-		// skip directories
-		if info.IsDir() {
-			return nil
-		}
-
-		if strings.ToLower(info.Name()) != "kustomization.yaml" {
-			return nil
-		}
-
-		data, err := ioutil.ReadFile(path)
-
-		if err != nil {
-			t.Errorf("Error reading %v; error: %v", path, err)
-		}
-
-		input := bytes.NewReader(data)
-		reader := kio.ByteReader{
-			Reader: input,
-			// We need to disable adding reader annotations because
-			// we want to run some checks about whether annotations are set and
-			// adding those annotations interferes with that.
-			OmitReaderAnnotations: true,
-		}
-
-		nodes, err := reader.Read()
-
-		if err != nil {
-			t.Errorf("Error unmarshaling %v; error: %v", path, err)
-		}
-
-		for _, n := range nodes {
-			m, err := n.GetMeta()
-			// Skip objects with no metadata
-			if err != nil {
-				continue
-			}
-
-			// Skip Kustomization
-			if strings.ToLower(m.Kind) != "kustomization" {
-				continue
-			}
-
-			hasDeprecated := kustomizationHasDeprecatedEnv(t, n)
-
-			if hasDeprecated {
-				t.Errorf("Kustomization %v is using obsolete syntax for configMapGenerate; you must use envs not env", path)
-			}
+	expected := []Finding{
+		{Line: 8, Message: "webhook pods of ValidatingWebhookConfiguration webhook intercepts pods but has no objectSelector or namespaceSelector"},
+		{Line: 16, Severity: SeverityWarning, Message: "webhook kube-system of ValidatingWebhookConfiguration webhook fails closed and intercepts kube-system; exclude kube-system with a namespaceSelector or set failurePolicy: Ignore"},
+		{Line: 25, Severity: SeverityWarning, Message: "webhook default of ValidatingWebhookConfiguration webhook fails closed and intercepts kube-system; exclude kube-system with a namespaceSelector or set failurePolicy: Ignore"},
+		{Line: 25, Severity: SeverityWarning, Message: "webhook default of ValidatingWebhookConfiguration webhook has no timeoutSeconds, so the requests it intercepts can wait for the default of 10s"},
+	}
+	if len(actual) != len(expected) {
+		t.Fatalf("got findings %v; want %v", actual, expected)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Errorf("got finding %+v; want %+v", actual[i], expected[i])
 		}
-		return nil
-	})
-
-	if err != nil {
-		t.Errorf("error walking the path %v; error: %v", rootDir, err)
 	}
 }
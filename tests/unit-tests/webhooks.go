@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	// admissionGroup is the API group of MutatingWebhookConfigurations and ValidatingWebhookConfigurations
+	admissionGroup = "admissionregistration.k8s.io"
+	// InjectCAFromAnnotation is the annotation with which the CA injector of cert-manager sets the caBundle of the
+	// webhooks to the CA of a Certificate, as namespace/name
+	InjectCAFromAnnotation = "cert-manager.io/inject-ca-from"
+	// defaultWebhookPort is the port of the Service of a webhook if clientConfig.service.port isn't set
+	defaultWebhookPort = 443
+)
+
+// isWebhookConfiguration reports whether the kind is a configuration of admission webhooks
+func isWebhookConfiguration(kind string) bool {
+	return kind == "MutatingWebhookConfiguration" || kind == "ValidatingWebhookConfiguration"
+}
+
+// checkWebhookReferences returns a message for every webhook of the Mutating and ValidatingWebhookConfigurations
+// in a build whose clientConfig.service isn't a Service of the build, or isn't one of its ports, and for every
+// cert-manager.io/inject-ca-from annotation that doesn't name a Certificate of the build. Webhooks with a
+// clientConfig.url aren't checked.
+func checkWebhookReferences(resources []*builtResource) ([]string, error) {
+	index, err := newBuildIndex(resources)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []string
+	for _, r := range resources {
+		if r.group != admissionGroup || !isWebhookConfiguration(r.kind) {
+			continue
+		}
+		object := struct {
+			Metadata struct {
+				Annotations map[string]string `json:"annotations,omitempty"`
+			} `json:"metadata"`
+			Webhooks []struct {
+				Name         string `json:"name"`
+				ClientConfig struct {
+					Service *struct {
+						Namespace string `json:"namespace"`
+						Name      string `json:"name"`
+						Port      *int   `json:"port,omitempty"`
+					} `json:"service,omitempty"`
+				} `json:"clientConfig"`
+			} `json:"webhooks,omitempty"`
+		}{}
+		if err := yaml.Unmarshal(r.yaml, &object); err != nil {
+			return nil, fmt.Errorf("could not parse resource %v; error: %v", r.Key(), err)
+		}
+
+		if from, ok := object.Metadata.Annotations[InjectCAFromAnnotation]; ok {
+			parts := strings.SplitN(from, "/", 2)
+			if len(parts) != 2 || !index.has("Certificate", parts[0], parts[1]) {
+				messages = append(messages, fmt.Sprintf("Resource %v injects the CA of Certificate %v with %v, which isn't in the build",
+					r.Key(), from, InjectCAFromAnnotation))
+			}
+		}
+		for i, w := range object.Webhooks {
+			s := w.ClientConfig.Service
+			if s == nil {
+				continue
+			}
+			path := fmt.Sprintf("webhooks[%d].clientConfig.service", i)
+			target, found := index.services[s.Namespace+"/"+s.Name]
+			if !found {
+				messages = append(messages, fmt.Sprintf("Resource %v calls webhook %v on Service %v/%v at %v, which isn't in the build",
+					r.Key(), w.Name, s.Namespace, s.Name, path))
+				continue
+			}
+			port := defaultWebhookPort
+			if s.Port != nil {
+				port = *s.Port
+			}
+			exposed := false
+			for _, p := range target.ports {
+				exposed = exposed || p.port == port
+			}
+			if !exposed {
+				messages = append(messages, fmt.Sprintf("Resource %v calls webhook %v on port %d of Service %v/%v at %v, which the Service doesn't expose",
+					r.Key(), w.Name, port, s.Namespace, s.Name, path))
+			}
+		}
+	}
+	return messages, nil
+}
+
+// checkWebhooks fails the test for every webhook whose Service or Certificate isn't in the build, see
+// checkWebhookReferences
+func checkWebhooks(t *testing.T, resources []*builtResource) {
+	t.Helper()
+	messages, err := checkWebhookReferences(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range messages {
+		t.Error(m)
+	}
+}
+
+// labelSelector is a selector of labels, like the namespaceSelector of a webhook
+type labelSelector struct {
+	MatchLabels      map[string]string `json:"matchLabels,omitempty" yaml:"matchLabels,omitempty"`
+	MatchExpressions []struct {
+		Key      string   `json:"key" yaml:"key"`
+		Operator string   `json:"operator" yaml:"operator"`
+		Values   []string `json:"values,omitempty" yaml:"values,omitempty"`
+	} `json:"matchExpressions,omitempty" yaml:"matchExpressions,omitempty"`
+}
+
+// matches reports whether the selector selects an object with the labels; an empty selector selects everything
+func (s *labelSelector) matches(labels map[string]string) bool {
+	if !matchLabels(s.MatchLabels, labels) {
+		return false
+	}
+	for _, e := range s.MatchExpressions {
+		value, ok := labels[e.Key]
+		switch e.Operator {
+		case "In":
+			if !ok || !contains(e.Values, value) {
+				return false
+			}
+		case "NotIn":
+			if ok && contains(e.Values, value) {
+				return false
+			}
+		case "Exists":
+			if !ok {
+				return false
+			}
+		case "DoesNotExist":
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
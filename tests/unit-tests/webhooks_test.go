@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheckWebhookReferences(t *testing.T) {
+	resources := []*builtResource{
+		newBuiltResource("", "v1", "Service", "kubeflow", "webhook", []byte(`apiVersion: v1
+kind: Service
+metadata:
+  name: webhook
+  namespace: kubeflow
+spec:
+  selector:
+    app: webhook
+  ports:
+  - port: 443
+    targetPort: 4443
+`)),
+		newBuiltResource("cert-manager.io", "v1", "Certificate", "kubeflow", "webhook-cert", []byte(`apiVersion: cert-manager.io/v1
+kind: Certificate
+metadata:
+  name: webhook-cert
+  namespace: kubeflow
+`)),
+		newBuiltResource("admissionregistration.k8s.io", "v1", "MutatingWebhookConfiguration", "", "resolved", []byte(`apiVersion: admissionregistration.k8s.io/v1
+kind: MutatingWebhookConfiguration
+metadata:
+  name: resolved
+  annotations:
+    cert-manager.io/inject-ca-from: kubeflow/webhook-cert
+webhooks:
+- name: resolved.kubeflow.org
+  clientConfig:
+    service:
+      name: webhook
+      namespace: kubeflow
+- name: url.kubeflow.org
+  clientConfig:
+    url: https://webhook.example.com
+`)),
+		newBuiltResource("admissionregistration.k8s.io", "v1", "ValidatingWebhookConfiguration", "", "dangling", []byte(`apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingWebhookConfiguration
+metadata:
+  name: dangling
+  annotations:
+    cert-manager.io/inject-ca-from: kubeflow/missing-cert
+webhooks:
+- name: missing.kubeflow.org
+  clientConfig:
+    service:
+      name: missing
+      namespace: kubeflow
+- name: port.kubeflow.org
+  clientConfig:
+    service:
+      name: webhook
+      namespace: kubeflow
+      port: 8443
+`)),
+	}
+
+	expected := []string{
+		"Resource admissionregistration.k8s.io/v1 ValidatingWebhookConfiguration dangling injects the CA of Certificate kubeflow/missing-cert with cert-manager.io/inject-ca-from, which isn't in the build",
+		"Resource admissionregistration.k8s.io/v1 ValidatingWebhookConfiguration dangling calls webhook missing.kubeflow.org on Service kubeflow/missing at webhooks[0].clientConfig.service, which isn't in the build",
+		"Resource admissionregistration.k8s.io/v1 ValidatingWebhookConfiguration dangling calls webhook port.kubeflow.org on port 8443 of Service kubeflow/webhook at webhooks[1].clientConfig.service, which the Service doesn't expose",
+	}
+	actual, err := checkWebhookReferences(resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got messages\n%v\nwant\n%v", actual, expected)
+	}
+}